@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/logpulse/backend/internal/config"
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/storage"
+)
+
+// runFsck implements "logpulse fsck", which checks every chunk against its
+// metadata and the index. The server must be stopped while it runs. It
+// returns the process exit code: 1 if problems were left unresolved.
+func runFsck(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "rebuild missing chunk metadata and fix the index")
+	quarantineDir := flags.String("quarantine", "", "move corrupt chunks and orphaned files to this directory")
+	flags.Parse(args)
+
+	chunkStore, _, err := openChunkStore(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Invalid storage config: %v", err)
+	}
+
+	labelIndex, err := index.LoadIndex(cfg.Storage.IndexPath)
+	if err == index.ErrIndexNotFound {
+		// The server rebuilds a missing index on start, so only the chunks
+		// themselves are worth checking
+		log.Printf("No index at %s, checking chunks only", cfg.Storage.IndexPath)
+		labelIndex = index.NewIndex()
+		if err := storage.RecoverIndex(storage.NewStoreReader(chunkStore), labelIndex); err != nil {
+			log.Fatalf("Failed to read chunks: %v", err)
+		}
+	} else if err != nil {
+		log.Fatalf("Failed to load index: %v", err)
+	}
+
+	opts := storage.FsckOptions{Repair: *repair}
+	if *quarantineDir != "" {
+		opts.Quarantine = storage.NewFSStore(*quarantineDir)
+	}
+
+	report, err := storage.Fsck(chunkStore, labelIndex, opts)
+	if err != nil {
+		log.Fatalf("fsck failed: %v", err)
+	}
+	if err := labelIndex.Close(); err != nil {
+		log.Fatalf("Failed to persist index: %v", err)
+	}
+
+	for _, issue := range report.Issues {
+		if issue.Action != "" {
+			fmt.Printf("%s: %s [%s]\n", issue.Key, issue.Problem, issue.Action)
+		} else {
+			fmt.Printf("%s: %s\n", issue.Key, issue.Problem)
+		}
+	}
+	unresolved := report.Unresolved()
+	fmt.Printf("%d chunks checked, %d problems found, %d unresolved\n", report.Chunks, len(report.Issues), unresolved)
+
+	if unresolved > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -12,7 +13,10 @@ import (
 	"github.com/logpulse/backend/internal/config"
 	"github.com/logpulse/backend/internal/index"
 	"github.com/logpulse/backend/internal/ingest"
+	"github.com/logpulse/backend/internal/query"
 	"github.com/logpulse/backend/internal/storage"
+	"github.com/logpulse/backend/internal/syslog"
+	"github.com/logpulse/backend/internal/wal"
 )
 
 func main() {
@@ -22,26 +26,141 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		os.Exit(runFsck(cfg, os.Args[2:]))
+	}
+
 	log.Printf("Starting LokiLite server on port %s", cfg.Server.Port)
 
 	// Initialize components
-	labelIndex := index.NewIndex()
-	storageWriter := storage.NewWriter(cfg.Storage.Path, cfg.Storage.ChunkSizeBytes)
-	storageReader := storage.NewReader(cfg.Storage.Path)
-	
+	compression, err := storage.ParseCompression(cfg.Storage.Compression)
+	if err != nil {
+		log.Fatalf("Invalid storage config: %v", err)
+	}
+	chunkStore, tieredStore, err := openChunkStore(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Invalid storage config: %v", err)
+	}
+	if removed, err := storage.CleanupTempFiles(chunkStore); err != nil {
+		log.Fatalf("Failed to clean up temp files: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d temp files left by interrupted chunk writes", removed)
+	}
+
+	// Move chunks written under label pair directories into hash directories
+	if _, err := storage.MigrateLayout(chunkStore); err != nil {
+		log.Fatalf("Failed to migrate storage layout: %v", err)
+	}
+
+	storageWriter := storage.NewStoreWriter(chunkStore, cfg.Storage.ChunkSizeBytes, compression)
+	storageReader := storage.NewStoreReader(chunkStore)
+
+	labelIndex, err := index.LoadIndex(cfg.Storage.IndexPath)
+	if err != nil {
+		if err != index.ErrIndexNotFound {
+			log.Printf("Failed to load persisted index, rebuilding: %v", err)
+		}
+
+		// Rebuild the index from chunks already on disk before serving queries
+		labelIndex = index.NewIndex()
+		if err := storage.RecoverIndex(storageReader, labelIndex); err != nil {
+			log.Fatalf("Failed to recover index: %v", err)
+		}
+		if err := labelIndex.PersistIndex(cfg.Storage.IndexPath); err != nil {
+			log.Fatalf("Failed to persist index: %v", err)
+		}
+	} else if _, _, err := storage.ReconcileIndex(storageReader, labelIndex); err != nil {
+		// Drop index entries of chunks removed from the store behind its back
+		log.Printf("Failed to reconcile index with chunk store: %v", err)
+	}
+
 	// Initialize streaming hub
 	streamHub := api.NewStreamHub()
 	go streamHub.Run()
 
 	// Initialize ingestor with stream hub for live broadcasting
-	ingestor := ingest.NewIngestor(labelIndex, storageWriter, cfg.Ingest.BufferSize, streamHub)
+	ingestor := ingest.NewIngestor(labelIndex, storageWriter, ingest.ChunkLimits{
+		MaxBytes:      cfg.Storage.ChunkSizeBytes,
+		MaxEntries:    cfg.Ingest.BufferSize,
+		MaxAge:        time.Duration(cfg.Ingest.MaxChunkAgeMs) * time.Millisecond,
+		IdleTimeout:   time.Duration(cfg.Ingest.ChunkIdleTimeoutMs) * time.Millisecond,
+		CheckInterval: time.Duration(cfg.Ingest.FlushInterval) * time.Millisecond,
+	}, streamHub)
+
+	// Restore entries that were buffered but not flushed before the last exit
+	if cfg.Ingest.WALDir != "" {
+		ingestWAL, err := wal.Open(cfg.Ingest.WALDir, wal.Options{
+			SegmentSize:  cfg.Ingest.WALSegmentSizeBytes,
+			Sync:         wal.SyncPolicy(cfg.Ingest.WALSync),
+			SyncInterval: time.Duration(cfg.Ingest.WALSyncIntervalMs) * time.Millisecond,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open WAL: %v", err)
+		}
+		if err := ingestor.ReplayWAL(ingestWAL); err != nil {
+			log.Fatalf("Failed to replay WAL: %v", err)
+		}
+	}
 
 	// Start background workers
 	go ingestor.Start()
-	go storage.StartRetentionWorker(cfg.Storage.Path, cfg.Storage.RetentionDays)
+	retentionPolicy, err := buildRetentionPolicy(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Invalid retention config: %v", err)
+	}
+	retention := storage.NewRetention(labelIndex, chunkStore, retentionPolicy)
+	retention.Start()
+	ingestor.SetCapacityChecker(retention)
+	storageWriter.SetUsageRecorder(retention)
+
+	var compactor *storage.Compactor
+	if cfg.Storage.CompactionIntervalMs > 0 {
+		compactor = storage.NewCompactor(storageReader, storageWriter, labelIndex, storage.CompactorOptions{
+			TargetSize: int64(cfg.Storage.ChunkSizeBytes),
+			Interval:   time.Duration(cfg.Storage.CompactionIntervalMs) * time.Millisecond,
+		})
+		compactor.Start()
+	}
+
+	var migrator *storage.Migrator
+	if tieredStore != nil {
+		migrator = storage.NewMigrator(tieredStore, labelIndex, storage.MigratorOptions{
+			MinAge:   time.Duration(cfg.Storage.Cold.MinAgeHours) * time.Hour,
+			Interval: time.Duration(cfg.Storage.Cold.MigrationIntervalMs) * time.Millisecond,
+		})
+		migrator.Start()
+	}
+
+	// Delete requests keep applying to entries flushed up to a max chunk
+	// age after their end
+	deleter, err := storage.NewDeleter(storageReader, storageWriter, labelIndex, storage.DeleterOptions{
+		Parse:      query.ParseDeleteSelector,
+		Interval:   time.Duration(cfg.Storage.DeleteIntervalMs) * time.Millisecond,
+		FlushGrace: time.Duration(cfg.Ingest.MaxChunkAgeMs) * time.Millisecond,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load delete requests: %v", err)
+	}
+	deleter.Start()
+
+	// Syslog listeners hand batches of messages to the ingestor
+	var syslogServer *syslog.Server
+	if cfg.Syslog.TCPAddress != "" || cfg.Syslog.UDPAddress != "" {
+		syslogServer = syslog.NewServer(ingestor, syslog.Options{
+			TCPAddress:     cfg.Syslog.TCPAddress,
+			UDPAddress:     cfg.Syslog.UDPAddress,
+			MaxMessageSize: cfg.Syslog.MaxMessageSize,
+			BatchSize:      cfg.Syslog.BatchSize,
+			FlushInterval:  time.Duration(cfg.Syslog.FlushIntervalMs) * time.Millisecond,
+			Labels:         cfg.Syslog.Labels,
+		})
+		if err := syslogServer.Start(); err != nil {
+			log.Fatalf("Failed to start syslog listener: %v", err)
+		}
+	}
 
 	// Setup HTTP server
-	router := api.NewRouter(ingestor, storageReader, labelIndex, cfg, streamHub)
+	router := api.NewRouter(ingestor, storageReader, labelIndex, cfg, streamHub, retention, deleter)
 
 	server := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
@@ -58,7 +177,21 @@ func main() {
 		<-sigChan
 
 		log.Println("Shutting down server...")
+		if syslogServer != nil {
+			syslogServer.Stop()
+		}
 		ingestor.Stop()
+		retention.Stop()
+		if compactor != nil {
+			compactor.Stop()
+		}
+		if migrator != nil {
+			migrator.Stop()
+		}
+		deleter.Stop()
+		if err := labelIndex.Close(); err != nil {
+			log.Printf("Failed to persist index: %v", err)
+		}
 		server.Close()
 	}()
 
@@ -69,3 +202,74 @@ func main() {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// openChunkStore creates the chunk store selected by the storage config.
+// With a cold tier configured it also returns the tiered store, whose old
+// chunks move to the cold tier while reads find them in either tier.
+func openChunkStore(cfg config.StorageConfig) (storage.ChunkStore, *storage.TieredStore, error) {
+	chunkStore, err := newChunkStore(cfg.Backend, cfg.Path, cfg.S3)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Cold.Backend == "" {
+		return chunkStore, nil, nil
+	}
+
+	coldStore, err := newChunkStore(cfg.Cold.Backend, cfg.Cold.Path, cfg.Cold.S3)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cold tier: %w", err)
+	}
+	tieredStore := storage.NewTieredStore(chunkStore, coldStore)
+	return tieredStore, tieredStore, nil
+}
+
+// newChunkStore creates the chunk store selected by a storage backend name
+func newChunkStore(backend, path string, s3 config.S3Config) (storage.ChunkStore, error) {
+	switch backend {
+	case "", "filesystem":
+		if path == "" {
+			return nil, fmt.Errorf("filesystem backend needs a path")
+		}
+		return storage.NewFSStore(path), nil
+	case "s3":
+		return storage.NewS3Store(storage.S3Options{
+			Endpoint:        s3.Endpoint,
+			Bucket:          s3.Bucket,
+			Region:          s3.Region,
+			AccessKeyID:     s3.AccessKeyID,
+			SecretAccessKey: s3.SecretAccessKey,
+			Prefix:          s3.Prefix,
+		})
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
+
+// buildRetentionPolicy parses the per-stream retention rules in the storage
+// config
+func buildRetentionPolicy(cfg config.StorageConfig) (storage.RetentionPolicy, error) {
+	policy := storage.RetentionPolicy{
+		Period:   time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		MaxBytes: cfg.MaxStorageBytes,
+	}
+
+	for _, rule := range cfg.RetentionRules {
+		parsed, err := query.ParseAdvancedQuery(rule.Selector)
+		if err != nil {
+			return policy, fmt.Errorf("retention rule %q: %w", rule.Selector, err)
+		}
+		if len(parsed.LabelMatchers) == 0 {
+			return policy, fmt.Errorf("retention rule %q: selector has no label matchers", rule.Selector)
+		}
+		if rule.Days <= 0 {
+			return policy, fmt.Errorf("retention rule %q: days must be positive", rule.Selector)
+		}
+
+		policy.Rules = append(policy.Rules, storage.RetentionRule{
+			Selector: rule.Selector,
+			Matchers: parsed.IndexMatchers(),
+			Period:   time.Duration(rule.Days) * 24 * time.Hour,
+		})
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/logpulse/backend/internal/storage"
+)
+
+// DeleteHandler serves the Loki-compatible log deletion API
+type DeleteHandler struct {
+	deleter *storage.Deleter
+}
+
+// NewDeleteHandler creates a new delete handler
+func NewDeleteHandler(deleter *storage.Deleter) *DeleteHandler {
+	return &DeleteHandler{deleter: deleter}
+}
+
+// DeleteRequestResponse describes a delete request the way Loki does, with
+// times in Unix seconds
+type DeleteRequestResponse struct {
+	RequestID      string  `json:"request_id"`
+	StartTime      float64 `json:"start_time"`
+	EndTime        float64 `json:"end_time"`
+	Query          string  `json:"query"`
+	Status         string  `json:"status"`
+	CreatedAt      float64 `json:"created_at"`
+	DeletedEntries int64   `json:"deleted_entries"`
+}
+
+// Create handles POST /loki/api/v1/delete?query=...&start=...&end=...
+func (h *DeleteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if h.deleter == nil {
+		http.Error(w, "Deletion is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	params := r.URL.Query()
+	queryStr := params.Get("query")
+	if queryStr == "" {
+		http.Error(w, "query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	start := time.Unix(0, 0)
+	if s := params.Get("start"); s != "" {
+		t, err := parseDeleteTime(s)
+		if err != nil {
+			http.Error(w, "Invalid start time format", http.StatusBadRequest)
+			return
+		}
+		start = t
+	}
+	end := time.Now()
+	if s := params.Get("end"); s != "" {
+		t, err := parseDeleteTime(s)
+		if err != nil {
+			http.Error(w, "Invalid end time format", http.StatusBadRequest)
+			return
+		}
+		end = t
+	}
+
+	req, err := h.deleter.Add(queryStr, start, end)
+	if err != nil {
+		http.Error(w, "Invalid delete request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Delete request %s received for %s from %s to %s", req.ID, req.Query,
+		req.Start.UTC().Format(time.RFC3339), req.End.UTC().Format(time.RFC3339))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List handles GET /loki/api/v1/delete
+func (h *DeleteHandler) List(w http.ResponseWriter, r *http.Request) {
+	response := make([]DeleteRequestResponse, 0)
+	if h.deleter != nil {
+		for _, req := range h.deleter.Requests() {
+			response = append(response, DeleteRequestResponse{
+				RequestID:      req.ID,
+				StartTime:      unixSeconds(req.Start),
+				EndTime:        unixSeconds(req.End),
+				Query:          req.Query,
+				Status:         req.Status,
+				CreatedAt:      unixSeconds(req.CreatedAt),
+				DeletedEntries: req.DeletedEntries,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Cancel handles DELETE /loki/api/v1/delete?request_id=...
+func (h *DeleteHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	if h.deleter == nil {
+		http.Error(w, "Deletion is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	err := h.deleter.Cancel(r.URL.Query().Get("request_id"))
+	switch {
+	case errors.Is(err, storage.ErrDeleteNotFound):
+		http.Error(w, "Delete request not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrDeleteStarted):
+		http.Error(w, "Delete request has already removed entries", http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// parseDeleteTime parses a time in Unix seconds, as Loki's delete API
+// takes it, or RFC3339
+func parseDeleteTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		whole, frac := math.Modf(secs)
+		return time.Unix(int64(whole), int64(frac*1e9)), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// unixSeconds converts t to fractional Unix seconds
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/logpulse/backend/internal/ingest"
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/push"
+)
+
+// esVersion is the Elasticsearch version reported to shippers, which check
+// it before sending bulk requests
+const esVersion = "8.11.0"
+
+// ElasticsearchHandler serves the parts of the Elasticsearch API that log
+// shippers need to send documents with the bulk API
+type ElasticsearchHandler struct {
+	ingestor *ingest.Ingestor
+	decoder  *push.ESBulkDecoder
+}
+
+// NewElasticsearchHandler creates a new Elasticsearch handler that turns
+// the given document fields into labels
+func NewElasticsearchHandler(ingestor *ingest.Ingestor, labelFields []string) *ElasticsearchHandler {
+	return &ElasticsearchHandler{
+		ingestor: ingestor,
+		decoder:  push.NewESBulkDecoder(labelFields),
+	}
+}
+
+// esBulkResponse is the response of the bulk API
+type esBulkResponse struct {
+	Took   int64                        `json:"took"`
+	Errors bool                         `json:"errors"`
+	Items  []map[string]*esBulkItemResp `json:"items"`
+}
+
+type esBulkItemResp struct {
+	Index   string   `json:"_index"`
+	ID      string   `json:"_id"`
+	Version int      `json:"_version,omitempty"`
+	Result  string   `json:"result,omitempty"`
+	Status  int      `json:"status"`
+	Error   *esError `json:"error,omitempty"`
+}
+
+type esError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// Info handles GET /, which shippers call to detect the Elasticsearch
+// version
+func (h *ElasticsearchHandler) Info(w http.ResponseWriter, r *http.Request) {
+	writeESJSON(w, http.StatusOK, map[string]any{
+		"name":         "logpulse",
+		"cluster_name": "logpulse",
+		"version": map[string]any{
+			"number":                              esVersion,
+			"build_flavor":                        "default",
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+// Bulk handles POST /_bulk and /{index}/_bulk. Each document is ingested
+// as an entry of the stream for its index and label fields; the response
+// reports a status per item as Elasticsearch does.
+func (h *ElasticsearchHandler) Bulk(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	body, err := readPushBody(r, false)
+	if err != nil {
+		writeESError(w, pushBodyErrorStatus(err), "parse_exception", err.Error())
+		return
+	}
+	items, err := h.decoder.Decode(body, mux.Vars(r)["index"], start)
+	if err != nil {
+		writeESError(w, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return
+	}
+
+	resp := esBulkResponse{Items: make([]map[string]*esBulkItemResp, len(items))}
+	req := &models.IngestRequest{}
+	streams := make(map[string]int) // label hash to index in req.Streams
+	var accepted []*esBulkItemResp
+
+	for i := range items {
+		item := &items[i]
+		result := &esBulkItemResp{Index: item.Index, ID: item.ID}
+		resp.Items[i] = map[string]*esBulkItemResp{item.Action: result}
+
+		if item.Err == nil {
+			item.Err = ingest.ValidateStream(&models.Stream{Labels: item.Labels, Entries: []models.Entry{item.Entry}})
+		}
+		if item.Err != nil {
+			result.Status = http.StatusBadRequest
+			result.Error = &esError{Type: "mapper_parsing_exception", Reason: item.Err.Error()}
+			if errors.Is(item.Err, push.ErrBulkUnsupported) {
+				result.Error.Type = "action_request_validation_exception"
+			}
+			resp.Errors = true
+			continue
+		}
+
+		key := models.Labels(item.Labels).Hash()
+		pos, ok := streams[key]
+		if !ok {
+			pos = len(req.Streams)
+			streams[key] = pos
+			req.Streams = append(req.Streams, models.Stream{Labels: item.Labels})
+		}
+		req.Streams[pos].Entries = append(req.Streams[pos].Entries, item.Entry)
+		accepted = append(accepted, result)
+	}
+
+	status, result := http.StatusCreated, "created"
+	var ingestErr *esError
+	if len(req.Streams) > 0 {
+		if _, err := h.ingestor.Ingest(req); err != nil {
+			status, result = ingestErrorStatus(w, err), ""
+			ingestErr = &esError{Type: "exception", Reason: err.Error()}
+			if status == http.StatusTooManyRequests {
+				ingestErr.Type = "es_rejected_execution_exception"
+			}
+			resp.Errors = true
+		}
+	}
+	for _, item := range accepted {
+		item.Status, item.Result, item.Error = status, result, ingestErr
+		if ingestErr == nil {
+			item.Version = 1
+		}
+	}
+
+	resp.Took = time.Since(start).Milliseconds()
+	writeESJSON(w, http.StatusOK, resp)
+}
+
+// writeESError writes an error response shaped like Elasticsearch's
+func writeESError(w http.ResponseWriter, status int, errType, reason string) {
+	cause := esError{Type: errType, Reason: reason}
+	writeESJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"root_cause": []esError{cause},
+			"type":       cause.Type,
+			"reason":     cause.Reason,
+		},
+		"status": status,
+	})
+}
+
+func writeESJSON(w http.ResponseWriter, status int, v any) {
+	// Elasticsearch clients from 7.14 check the product header
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
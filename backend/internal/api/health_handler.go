@@ -94,4 +94,174 @@ lokiclone_storage_bytes %d
 # TYPE lokiclone_uptime_seconds gauge
 lokiclone_uptime_seconds %d
 `, bytes, lines, chunkCount, storageUsed, int64(time.Since(startTime).Seconds()))
+
+	chunkMetrics := h.ingestor.GetChunkMetrics()
+
+	fmt.Fprintf(w, `
+# HELP lokiclone_head_chunks Open head chunks holding unflushed entries
+# TYPE lokiclone_head_chunks gauge
+lokiclone_head_chunks %d
+
+# HELP lokiclone_head_chunk_bytes Uncompressed bytes held in open head chunks
+# TYPE lokiclone_head_chunk_bytes gauge
+lokiclone_head_chunk_bytes %d
+
+# HELP lokiclone_chunk_target_size_bytes Size at which head chunks are cut
+# TYPE lokiclone_chunk_target_size_bytes gauge
+lokiclone_chunk_target_size_bytes %d
+
+# HELP lokiclone_chunk_max_age_seconds Age at which head chunks are cut
+# TYPE lokiclone_chunk_max_age_seconds gauge
+lokiclone_chunk_max_age_seconds %f
+
+# HELP lokiclone_chunk_idle_timeout_seconds Idle time after which head chunks are cut
+# TYPE lokiclone_chunk_idle_timeout_seconds gauge
+lokiclone_chunk_idle_timeout_seconds %f
+
+# HELP lokiclone_chunks_cut_total Chunks cut to storage by reason
+# TYPE lokiclone_chunks_cut_total counter
+`, chunkMetrics.HeadChunks, chunkMetrics.HeadBytes, chunkMetrics.Limits.MaxBytes,
+		chunkMetrics.Limits.MaxAge.Seconds(), chunkMetrics.Limits.IdleTimeout.Seconds())
+
+	for _, reason := range []string{ingest.CutReasonSize, ingest.CutReasonEntries, ingest.CutReasonAge, ingest.CutReasonIdle, ingest.CutReasonShutdown} {
+		fmt.Fprintf(w, "lokiclone_chunks_cut_total{reason=%q} %d\n", reason, chunkMetrics.Cuts[reason])
+	}
+
+	storageStats := storage.GetStats()
+
+	fmt.Fprintf(w, `
+# HELP lokiclone_index_recovery_duration_seconds Time spent rebuilding the index at startup
+# TYPE lokiclone_index_recovery_duration_seconds gauge
+lokiclone_index_recovery_duration_seconds %f
+
+# HELP lokiclone_index_recovered_chunks Chunks indexed during startup recovery
+# TYPE lokiclone_index_recovered_chunks gauge
+lokiclone_index_recovered_chunks %d
+
+# HELP lokiclone_index_recovery_skipped_chunks Chunks skipped during startup recovery
+# TYPE lokiclone_index_recovery_skipped_chunks gauge
+lokiclone_index_recovery_skipped_chunks %d
+`, storageStats.RecoveryDuration.Seconds(), storageStats.RecoveredChunks, storageStats.SkippedChunks)
+
+	compactionRunning := 0
+	if storageStats.CompactionRunning {
+		compactionRunning = 1
+	}
+
+	fmt.Fprintf(w, `
+# HELP lokiclone_compaction_runs_total Completed compaction passes
+# TYPE lokiclone_compaction_runs_total counter
+lokiclone_compaction_runs_total %d
+
+# HELP lokiclone_compaction_running Whether a compaction pass is in progress
+# TYPE lokiclone_compaction_running gauge
+lokiclone_compaction_running %d
+
+# HELP lokiclone_compaction_streams Streams in the current or last compaction pass
+# TYPE lokiclone_compaction_streams gauge
+lokiclone_compaction_streams %d
+
+# HELP lokiclone_compaction_streams_done Streams processed in the current or last compaction pass
+# TYPE lokiclone_compaction_streams_done gauge
+lokiclone_compaction_streams_done %d
+
+# HELP lokiclone_compacted_chunks_total Small chunks merged into larger chunks
+# TYPE lokiclone_compacted_chunks_total counter
+lokiclone_compacted_chunks_total %d
+
+# HELP lokiclone_compaction_bytes_saved_total Disk bytes saved by compaction
+# TYPE lokiclone_compaction_bytes_saved_total counter
+lokiclone_compaction_bytes_saved_total %d
+
+# HELP lokiclone_compaction_last_duration_seconds Duration of the last compaction pass
+# TYPE lokiclone_compaction_last_duration_seconds gauge
+lokiclone_compaction_last_duration_seconds %f
+`, storageStats.CompactionRuns, compactionRunning, storageStats.CompactionStreams, storageStats.CompactionStreamsDone,
+		storageStats.CompactedChunks, storageStats.CompactionBytesSaved, storageStats.CompactionLastDuration.Seconds())
+
+	fmt.Fprintf(w, `
+# HELP lokiclone_retention_deleted_chunks_total Chunks deleted by retention
+# TYPE lokiclone_retention_deleted_chunks_total counter
+lokiclone_retention_deleted_chunks_total %d
+
+# HELP lokiclone_retention_deleted_bytes_total Bytes freed by retention
+# TYPE lokiclone_retention_deleted_bytes_total counter
+lokiclone_retention_deleted_bytes_total %d
+`, storageStats.RetentionDeletedChunks, storageStats.RetentionDeletedBytes)
+
+	storageFull := 0
+	if storageStats.StorageFull {
+		storageFull = 1
+	}
+
+	fmt.Fprintf(w, `
+# HELP lokiclone_storage_evicted_chunks_total Chunks evicted to stay under max_storage_bytes
+# TYPE lokiclone_storage_evicted_chunks_total counter
+lokiclone_storage_evicted_chunks_total %d
+
+# HELP lokiclone_storage_evicted_bytes_total Bytes freed by storage cap eviction
+# TYPE lokiclone_storage_evicted_bytes_total counter
+lokiclone_storage_evicted_bytes_total %d
+
+# HELP lokiclone_storage_full Whether max_storage_bytes is exceeded with nothing left to evict
+# TYPE lokiclone_storage_full gauge
+lokiclone_storage_full %d
+`, storageStats.EvictedChunks, storageStats.EvictedBytes, storageFull)
+
+	fmt.Fprintf(w, `
+# HELP lokiclone_corrupt_chunks_read_total Chunks that failed checksum or decoding when read
+# TYPE lokiclone_corrupt_chunks_read_total counter
+lokiclone_corrupt_chunks_read_total %d
+`, storageStats.CorruptChunksRead)
+
+	migrationRunning := 0
+	if storageStats.MigrationRunning {
+		migrationRunning = 1
+	}
+
+	fmt.Fprintf(w, `
+# HELP lokiclone_tier_migration_runs_total Completed passes moving chunks to the cold tier
+# TYPE lokiclone_tier_migration_runs_total counter
+lokiclone_tier_migration_runs_total %d
+
+# HELP lokiclone_tier_migration_running Whether a migration pass is in progress
+# TYPE lokiclone_tier_migration_running gauge
+lokiclone_tier_migration_running %d
+
+# HELP lokiclone_tier_migration_pending_chunks Chunks left to move in the current pass
+# TYPE lokiclone_tier_migration_pending_chunks gauge
+lokiclone_tier_migration_pending_chunks %d
+
+# HELP lokiclone_tier_migrated_chunks_total Chunks moved to the cold tier
+# TYPE lokiclone_tier_migrated_chunks_total counter
+lokiclone_tier_migrated_chunks_total %d
+
+# HELP lokiclone_tier_migrated_bytes_total Bytes moved to the cold tier
+# TYPE lokiclone_tier_migrated_bytes_total counter
+lokiclone_tier_migrated_bytes_total %d
+
+# HELP lokiclone_tier_migration_failures_total Chunks that failed to move to the cold tier
+# TYPE lokiclone_tier_migration_failures_total counter
+lokiclone_tier_migration_failures_total %d
+`, storageStats.MigrationRuns, migrationRunning, storageStats.MigrationPending,
+		storageStats.MigratedChunks, storageStats.MigratedBytes, storageStats.MigrationFailures)
+
+	fmt.Fprintf(w, `
+# HELP lokiclone_delete_requests_pending Delete requests not yet fully processed
+# TYPE lokiclone_delete_requests_pending gauge
+lokiclone_delete_requests_pending %d
+
+# HELP lokiclone_deleted_entries_total Log entries removed by delete requests
+# TYPE lokiclone_deleted_entries_total counter
+lokiclone_deleted_entries_total %d
+
+# HELP lokiclone_delete_rewritten_chunks_total Chunks rewritten to remove deleted entries
+# TYPE lokiclone_delete_rewritten_chunks_total counter
+lokiclone_delete_rewritten_chunks_total %d
+
+# HELP lokiclone_delete_removed_chunks_total Chunks removed because every entry was deleted
+# TYPE lokiclone_delete_removed_chunks_total counter
+lokiclone_delete_removed_chunks_total %d
+`, storageStats.DeleteRequestsPending, storageStats.DeletedEntries,
+		storageStats.DeleteRewrittenChunks, storageStats.DeleteRemovedChunks)
 }
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logpulse/backend/internal/ingest"
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/push"
+)
+
+// hecPathPrefix is the prefix of the HEC endpoints, which check HEC tokens
+// instead of the API key
+const hecPathPrefix = "/services/collector"
+
+// hecChannelIdle is how long a channel with no requests keeps its
+// acknowledgement IDs
+const hecChannelIdle = time.Hour
+
+// maxHECAckBodySize is the largest acknowledgement request accepted
+const maxHECAckBodySize = 1 << 20
+
+// HEC status codes reported in response bodies
+const (
+	hecSuccess        = 0
+	hecTokenRequired  = 2
+	hecInvalidAuth    = 3
+	hecInvalidToken   = 4
+	hecNoData         = 5
+	hecInvalidFormat  = 6
+	hecServerError    = 8
+	hecServerBusy     = 9
+	hecChannelMissing = 10
+	hecEventRequired  = 12
+	hecEventBlank     = 13
+	hecHealthy        = 17
+)
+
+// HECHandler serves the Splunk HTTP Event Collector API
+type HECHandler struct {
+	ingestor     *ingest.Ingestor
+	tokens       []string
+	defaultIndex string
+	acks         *hecAcks
+}
+
+// NewHECHandler creates a new HEC handler accepting the given tokens
+func NewHECHandler(ingestor *ingest.Ingestor, tokens []string, defaultIndex string) *HECHandler {
+	return &HECHandler{
+		ingestor:     ingestor,
+		tokens:       tokens,
+		defaultIndex: defaultIndex,
+		acks:         &hecAcks{channels: make(map[string]*hecChannel)},
+	}
+}
+
+// hecResponse is the body of every HEC response
+type hecResponse struct {
+	Text               string  `json:"text"`
+	Code               int     `json:"code"`
+	InvalidEventNumber *int    `json:"invalid-event-number,omitempty"`
+	AckID              *uint64 `json:"ackId,omitempty"`
+}
+
+// Event handles POST /services/collector/event, whose body holds JSON
+// events with their own time, host, source, sourcetype and index
+func (h *HECHandler) Event(w http.ResponseWriter, r *http.Request) {
+	h.handle(w, r, push.DecodeHECEvents)
+}
+
+// Raw handles POST /services/collector/raw, where each line of the body is
+// an event described by the query string
+func (h *HECHandler) Raw(w http.ResponseWriter, r *http.Request) {
+	h.handle(w, r, push.DecodeHECRaw)
+}
+
+func (h *HECHandler) handle(w http.ResponseWriter, r *http.Request, decode func([]byte, push.HECDefaults, time.Time) (*models.IngestRequest, error)) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	defaults, err := h.queryDefaults(r)
+	if err != nil {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecInvalidFormat})
+		return
+	}
+	body, err := readPushBody(r, false)
+	if err != nil {
+		writeHEC(w, pushBodyErrorStatus(err), hecResponse{Text: err.Error(), Code: hecInvalidFormat})
+		return
+	}
+
+	req, err := decode(body, defaults, time.Now())
+	if err != nil {
+		writeHEC(w, http.StatusBadRequest, hecDecodeError(err))
+		return
+	}
+	if err := ingest.ValidateIngestRequest(req); err != nil {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecInvalidFormat})
+		return
+	}
+
+	if _, err := h.ingestor.Ingest(req); err != nil {
+		status := ingestErrorStatus(w, err)
+		resp := hecResponse{Text: "Internal server error", Code: hecServerError}
+		if status == http.StatusTooManyRequests {
+			status, resp = http.StatusServiceUnavailable, hecResponse{Text: "Server is busy", Code: hecServerBusy}
+		}
+		writeHEC(w, status, resp)
+		return
+	}
+
+	resp := hecResponse{Text: "Success", Code: hecSuccess}
+	if channel := hecChannelOf(r); channel != "" {
+		id := h.acks.issue(channel)
+		resp.AckID = &id
+	}
+	writeHEC(w, http.StatusOK, resp)
+}
+
+// Ack handles POST /services/collector/ack. Events are ingested before a
+// request is answered, so every ID issued on the channel is acknowledged.
+func (h *HECHandler) Ack(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	channel := hecChannelOf(r)
+	if channel == "" {
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Data channel is missing", Code: hecChannelMissing})
+		return
+	}
+
+	var req struct {
+		Acks []uint64 `json:"acks"`
+	}
+	body := http.MaxBytesReader(w, r.Body, maxHECAckBodySize)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeHEC(w, http.StatusRequestEntityTooLarge, hecResponse{Text: "Request too large", Code: hecInvalidFormat})
+			return
+		}
+		writeHEC(w, http.StatusBadRequest, hecResponse{Text: "Invalid data format", Code: hecInvalidFormat})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"acks": h.acks.status(channel, req.Acks)})
+}
+
+// Health handles GET /services/collector/health
+func (h *HECHandler) Health(w http.ResponseWriter, r *http.Request) {
+	writeHEC(w, http.StatusOK, hecResponse{Text: "HEC is healthy", Code: hecHealthy})
+}
+
+// authorize checks the HEC token, sent as "Authorization: Splunk <token>"
+// or as the password of basic auth, and writes the error response if it is
+// missing or not accepted
+func (h *HECHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		writeHEC(w, http.StatusUnauthorized, hecResponse{Text: "Token is required", Code: hecTokenRequired})
+		return false
+	}
+
+	token, ok := strings.CutPrefix(header, "Splunk ")
+	if !ok {
+		if _, token, ok = r.BasicAuth(); !ok {
+			writeHEC(w, http.StatusUnauthorized, hecResponse{Text: "Invalid authorization", Code: hecInvalidAuth})
+			return false
+		}
+	}
+
+	for _, accepted := range h.tokens {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(accepted)) == 1 {
+			return true
+		}
+	}
+	writeHEC(w, http.StatusForbidden, hecResponse{Text: "Invalid token", Code: hecInvalidToken})
+	return false
+}
+
+// queryDefaults reads the event metadata given in the query string
+func (h *HECHandler) queryDefaults(r *http.Request) (push.HECDefaults, error) {
+	q := r.URL.Query()
+	defaults := push.HECDefaults{
+		Host:       q.Get("host"),
+		Source:     q.Get("source"),
+		SourceType: q.Get("sourcetype"),
+		Index:      q.Get("index"),
+	}
+	if defaults.Host == "" {
+		// Splunk defaults the host to the client's address
+		defaults.Host = clientHost(r)
+	}
+	if defaults.Index == "" {
+		defaults.Index = h.defaultIndex
+	}
+	if t := q.Get("time"); t != "" {
+		ts, err := push.ParseHECTime(t)
+		if err != nil {
+			return defaults, err
+		}
+		defaults.Time = ts
+	}
+	return defaults, nil
+}
+
+// clientHost returns the address a request came from, without the port
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hecChannelOf returns the data channel of a request, which clients that
+// want acknowledgements send
+func hecChannelOf(r *http.Request) string {
+	if channel := r.Header.Get("X-Splunk-Request-Channel"); channel != "" {
+		return channel
+	}
+	return r.URL.Query().Get("channel")
+}
+
+// hecDecodeError maps a decoding error to its HEC response
+func hecDecodeError(err error) hecResponse {
+	resp := hecResponse{Text: "Invalid data format", Code: hecInvalidFormat}
+	switch {
+	case errors.Is(err, push.ErrHECNoData):
+		resp = hecResponse{Text: "No data", Code: hecNoData}
+	case errors.Is(err, push.ErrHECEventRequired):
+		resp = hecResponse{Text: "Event field is required", Code: hecEventRequired}
+	case errors.Is(err, push.ErrHECEventBlank):
+		resp = hecResponse{Text: "Event field cannot be blank", Code: hecEventBlank}
+	}
+
+	var eventErr *push.HECEventError
+	if errors.As(err, &eventErr) {
+		resp.InvalidEventNumber = &eventErr.Event
+	}
+	return resp
+}
+
+func writeHEC(w http.ResponseWriter, status int, resp hecResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// hecAcks hands out acknowledgement IDs per channel
+type hecAcks struct {
+	mu        sync.Mutex
+	channels  map[string]*hecChannel
+	lastPrune time.Time
+}
+
+type hecChannel struct {
+	next     uint64
+	lastUsed time.Time
+}
+
+// issue returns the next acknowledgement ID of a channel
+func (a *hecAcks) issue(channel string) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(a.lastPrune) > time.Minute {
+		for name, c := range a.channels {
+			if now.Sub(c.lastUsed) > hecChannelIdle {
+				delete(a.channels, name)
+			}
+		}
+		a.lastPrune = now
+	}
+
+	c, ok := a.channels[channel]
+	if !ok {
+		c = &hecChannel{}
+		a.channels[channel] = c
+	}
+	id := c.next
+	c.next++
+	c.lastUsed = now
+	return id
+}
+
+// status reports which of the given IDs have been issued on a channel
+func (a *hecAcks) status(channel string, ids []uint64) map[string]bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c := a.channels[channel]
+	acks := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		acks[strconv.FormatUint(id, 10)] = c != nil && id < c.next
+	}
+	return acks
+}
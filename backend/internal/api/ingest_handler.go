@@ -2,10 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/logpulse/backend/internal/ingest"
 	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/storage"
 )
 
 // IngestHandler handles log ingestion
@@ -34,7 +36,7 @@ func (h *IngestHandler) Ingest(w http.ResponseWriter, r *http.Request) {
 
 	accepted, err := h.ingestor.Ingest(&req)
 	if err != nil {
-		http.Error(w, "Ingestion error: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Ingestion error: "+err.Error(), ingestErrorStatus(w, err))
 		return
 	}
 
@@ -43,3 +45,16 @@ func (h *IngestHandler) Ingest(w http.ResponseWriter, r *http.Request) {
 		Accepted: accepted,
 	})
 }
+
+// ingestErrorStatus maps an ingestion error to an HTTP status, asking
+// clients to back off while old chunks are evicted
+func ingestErrorStatus(w http.ResponseWriter, err error) int {
+	switch {
+	case errors.Is(err, storage.ErrStorageFull):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, storage.ErrStorageOverCapacity):
+		w.Header().Set("Retry-After", "60")
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
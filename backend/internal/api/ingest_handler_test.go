@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/ingest"
+	"github.com/logpulse/backend/internal/storage"
+)
+
+// capacityError is a capacity checker that always fails with err
+type capacityError struct {
+	err error
+}
+
+func (c capacityError) CheckCapacity() error {
+	return c.err
+}
+
+func TestIngest_StorageCapacityStatus(t *testing.T) {
+	tests := []struct {
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{nil, http.StatusOK, ""},
+		{storage.ErrStorageOverCapacity, http.StatusTooManyRequests, "60"},
+		{storage.ErrStorageFull, http.StatusInsufficientStorage, ""},
+	}
+
+	for _, tt := range tests {
+		writer := storage.NewWriter(t.TempDir(), 0, storage.CompressionSnappy)
+		ingestor := ingest.NewIngestor(index.NewIndex(), writer, ingest.ChunkLimits{}, nil)
+		ingestor.SetCapacityChecker(capacityError{tt.err})
+
+		body := `{"streams":[{"labels":{"app":"api"},"entries":[{"ts":"2024-01-15T10:00:00Z","line":"hello"}]}]}`
+		req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		NewIngestHandler(ingestor).Ingest(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%v: expected status %d, got %d: %s", tt.err, tt.status, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("%v: expected Retry-After %q, got %q", tt.err, tt.retryAfter, got)
+		}
+	}
+}
@@ -19,11 +19,11 @@ type LokiHandler struct {
 }
 
 // NewLokiHandler creates a new Loki-compatible handler
-func NewLokiHandler(idx *index.Index, reader *storage.Reader) *LokiHandler {
+func NewLokiHandler(idx *index.Index, reader *storage.Reader, executor *query.Executor) *LokiHandler {
 	return &LokiHandler{
 		index:    idx,
 		reader:   reader,
-		executor: query.NewExecutor(idx, reader),
+		executor: executor,
 	}
 }
 
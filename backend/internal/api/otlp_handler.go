@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/logpulse/backend/internal/ingest"
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/protowire"
+	"github.com/logpulse/backend/internal/push"
+)
+
+// gRPC status codes used in OTLP error responses
+const (
+	grpcInvalidArgument   = 3
+	grpcResourceExhausted = 8
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+)
+
+// OTLPHandler receives OpenTelemetry logs over OTLP/HTTP
+type OTLPHandler struct {
+	ingestor *ingest.Ingestor
+	decoder  *push.OTLPDecoder
+}
+
+// NewOTLPHandler creates a new OTLP handler that turns the given resource
+// and scope attributes into labels
+func NewOTLPHandler(ingestor *ingest.Ingestor, labelAttributes []string) *OTLPHandler {
+	return &OTLPHandler{
+		ingestor: ingestor,
+		decoder:  push.NewOTLPDecoder(labelAttributes),
+	}
+}
+
+// Export handles POST /v1/logs with a protobuf or JSON
+// ExportLogsServiceRequest. Responses use the encoding of the request.
+func (h *OTLPHandler) Export(w http.ResponseWriter, r *http.Request) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != "application/x-protobuf" && contentType != "application/json" {
+		http.Error(w, "unsupported Content-Type "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := readPushBody(r, false)
+	if err != nil {
+		writeOTLPError(w, contentType, pushBodyErrorStatus(err), err.Error())
+		return
+	}
+
+	var req *models.IngestRequest
+	if contentType == "application/json" {
+		req, err = h.decoder.DecodeJSON(body)
+	} else {
+		req, err = h.decoder.DecodeProtobuf(body)
+	}
+	if err != nil {
+		writeOTLPError(w, contentType, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validatePush(req); err != nil {
+		writeOTLPError(w, contentType, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Streams) > 0 {
+		if _, err := h.ingestor.Ingest(req); err != nil {
+			writeOTLPError(w, contentType, ingestErrorStatus(w, err), err.Error())
+			return
+		}
+	}
+
+	// An empty ExportLogsServiceResponse reports full success
+	w.Header().Set("Content-Type", contentType)
+	if contentType == "application/json" {
+		w.Write([]byte("{}"))
+	}
+}
+
+// writeOTLPError writes a google.rpc.Status body, which OTLP/HTTP clients
+// expect with every error status
+func writeOTLPError(w http.ResponseWriter, contentType string, status int, message string) {
+	code := grpcInternal
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		code = grpcInvalidArgument
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		code = grpcUnavailable
+	case http.StatusInsufficientStorage:
+		code = grpcResourceExhausted
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if contentType == "application/json" {
+		json.NewEncoder(w).Encode(map[string]any{"code": code, "message": message})
+		return
+	}
+	var body []byte
+	body = protowire.AppendVarint(body, 1, uint64(code))
+	body = protowire.AppendString(body, 2, message)
+	w.Write(body)
+}
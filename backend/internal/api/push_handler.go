@@ -0,0 +1,139 @@
+package api
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/logpulse/backend/internal/ingest"
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/push"
+)
+
+// maxPushBodySize limits the decompressed body of a push request
+const maxPushBodySize = 64 << 20
+
+// errPushTooLarge is returned for a push body over maxPushBodySize
+var errPushTooLarge = fmt.Errorf("request body too large, limit is %d bytes", maxPushBodySize)
+
+// PushHandler serves the Loki push API, so that Promtail, Grafana Alloy and
+// other Loki clients can ship logs directly
+type PushHandler struct {
+	ingestor *ingest.Ingestor
+}
+
+// NewPushHandler creates a new push handler
+func NewPushHandler(ingestor *ingest.Ingestor) *PushHandler {
+	return &PushHandler{ingestor: ingestor}
+}
+
+// Push handles POST /loki/api/v1/push with either a JSON body or a snappy
+// compressed protobuf body
+func (h *PushHandler) Push(w http.ResponseWriter, r *http.Request) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	protobuf := contentType == "" || contentType == "application/x-protobuf"
+	if !protobuf && contentType != "application/json" {
+		http.Error(w, "unsupported Content-Type "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Protobuf bodies are snappy compressed, so the decoder handles that
+	// encoding itself
+	body, err := readPushBody(r, protobuf)
+	if err != nil {
+		http.Error(w, err.Error(), pushBodyErrorStatus(err))
+		return
+	}
+
+	var req *models.IngestRequest
+	if protobuf {
+		req, err = push.DecodeLokiProtobuf(body, maxPushBodySize)
+	} else {
+		req, err = push.DecodeLokiJSON(body)
+	}
+	if errors.Is(err, push.ErrDecodedTooLarge) {
+		http.Error(w, errPushTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePush(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Streams) > 0 {
+		if _, err := h.ingestor.Ingest(req); err != nil {
+			http.Error(w, err.Error(), ingestErrorStatus(w, err))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validatePush checks every stream of a decoded push request, so that a bad
+// stream rejects the whole request as it does in Loki
+func validatePush(req *models.IngestRequest) error {
+	for i := range req.Streams {
+		if err := ingest.ValidateStream(&req.Streams[i]); err != nil {
+			return fmt.Errorf("error at stream %s: %w", push.FormatLabels(req.Streams[i].Labels), err)
+		}
+	}
+	return nil
+}
+
+// readPushBody reads a request body, decompressing it according to its
+// Content-Encoding. A snappy body is returned as it is if allowSnappy is
+// set, for a caller that decodes it, and rejected otherwise.
+func readPushBody(r *http.Request, allowSnappy bool) ([]byte, error) {
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "snappy":
+		if !allowSnappy {
+			return nil, errUnsupportedEncoding
+		}
+	case "gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer zr.Close()
+		body = zr
+	case "deflate":
+		zr := flate.NewReader(r.Body)
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, errUnsupportedEncoding
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxPushBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %w", err)
+	}
+	if len(data) > maxPushBodySize {
+		return nil, errPushTooLarge
+	}
+	return data, nil
+}
+
+// errUnsupportedEncoding is returned for an unknown Content-Encoding
+var errUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+// pushBodyErrorStatus maps an error from readPushBody to an HTTP status
+func pushBodyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errPushTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
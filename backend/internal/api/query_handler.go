@@ -20,11 +20,11 @@ type QueryHandler struct {
 }
 
 // NewQueryHandler creates a new query handler
-func NewQueryHandler(idx *index.Index, reader *storage.Reader) *QueryHandler {
+func NewQueryHandler(idx *index.Index, reader *storage.Reader, executor *query.Executor) *QueryHandler {
 	return &QueryHandler{
 		index:    idx,
 		reader:   reader,
-		executor: query.NewExecutor(idx, reader),
+		executor: executor,
 	}
 }
 
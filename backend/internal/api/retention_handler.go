@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/logpulse/backend/internal/storage"
+)
+
+// RetentionHandler reports on retention
+type RetentionHandler struct {
+	retention *storage.Retention
+}
+
+// NewRetentionHandler creates a new retention handler
+func NewRetentionHandler(retention *storage.Retention) *RetentionHandler {
+	return &RetentionHandler{retention: retention}
+}
+
+// DryRunChunk is a chunk the next retention pass would delete
+type DryRunChunk struct {
+	ID        string            `json:"id"`
+	Labels    map[string]string `json:"labels"`
+	EndTime   time.Time         `json:"endTime"`
+	Rule      string            `json:"rule,omitempty"` // empty for the default retention
+	Retention string            `json:"retention"`
+	Bytes     int64             `json:"bytes"`
+}
+
+// DryRunResponse lists what retention would delete
+type DryRunResponse struct {
+	Chunks      []DryRunChunk `json:"chunks"`
+	TotalChunks int           `json:"totalChunks"`
+	TotalBytes  int64         `json:"totalBytes"`
+}
+
+// DryRun handles GET /retention/dry-run
+func (h *RetentionHandler) DryRun(w http.ResponseWriter, r *http.Request) {
+	if h.retention == nil {
+		http.Error(w, "Retention is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	at := time.Now()
+	if atStr := r.URL.Query().Get("at"); atStr != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			http.Error(w, "Invalid at time format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	response := DryRunResponse{Chunks: make([]DryRunChunk, 0)}
+	for _, chunk := range h.retention.Plan(at) {
+		response.Chunks = append(response.Chunks, DryRunChunk{
+			ID:        chunk.Meta.ID,
+			Labels:    chunk.Meta.Labels,
+			EndTime:   time.Unix(chunk.Meta.EndTime, 0).UTC(),
+			Rule:      chunk.Selector,
+			Retention: chunk.Period.String(),
+			Bytes:     chunk.Bytes,
+		})
+		response.TotalBytes += chunk.Bytes
+	}
+	response.TotalChunks = len(response.Chunks)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/logpulse/backend/internal/config"
@@ -18,15 +19,27 @@ func NewRouter(
 	labelIndex *index.Index,
 	cfg *config.Config,
 	streamHub *StreamHub,
+	retention *storage.Retention,
+	deleter *storage.Deleter,
 ) *mux.Router {
 	router := mux.NewRouter()
 
+	// Chunk reads are limited across all queries
+	fetchPool := query.NewFetchPool(cfg.Query.MaxConcurrency, cfg.Query.PerQueryConcurrency)
+	executor := query.NewExecutor(labelIndex, reader, fetchPool, deleter)
+
 	// Create handlers
 	healthHandler := NewHealthHandler(ingestor, reader, labelIndex)
 	ingestHandler := NewIngestHandler(ingestor)
-	queryHandler := NewQueryHandler(labelIndex, reader)
+	pushHandler := NewPushHandler(ingestor)
+	otlpHandler := NewOTLPHandler(ingestor, cfg.OTLP.LabelAttributes)
+	esHandler := NewElasticsearchHandler(ingestor, cfg.Elastic.LabelFields)
+	hecHandler := NewHECHandler(ingestor, cfg.HEC.Tokens, cfg.HEC.DefaultIndex)
+	queryHandler := NewQueryHandler(labelIndex, reader, executor)
 	streamHandler := NewStreamHandler(streamHub)
-	lokiHandler := NewLokiHandler(labelIndex, reader)
+	lokiHandler := NewLokiHandler(labelIndex, reader, executor)
+	retentionHandler := NewRetentionHandler(retention)
+	deleteHandler := NewDeleteHandler(deleter)
 
 	// Apply middleware
 	router.Use(corsMiddleware)
@@ -42,19 +55,42 @@ func NewRouter(
 
 	router.HandleFunc("/ingest", ingestHandler.Ingest).Methods("POST", "OPTIONS")
 
+	// OpenTelemetry OTLP/HTTP logs receiver
+	router.HandleFunc("/v1/logs", otlpHandler.Export).Methods("POST", "OPTIONS")
+
+	// Elasticsearch bulk API for Filebeat, Logstash and Vector
+	router.HandleFunc("/", esHandler.Info).Methods("GET", "HEAD")
+	router.HandleFunc("/_bulk", esHandler.Bulk).Methods("POST", "PUT", "OPTIONS")
+	router.HandleFunc("/{index}/_bulk", esHandler.Bulk).Methods("POST", "PUT", "OPTIONS")
+
+	// Splunk HTTP Event Collector
+	router.HandleFunc(hecPathPrefix, hecHandler.Event).Methods("POST", "OPTIONS")
+	router.HandleFunc(hecPathPrefix+"/event", hecHandler.Event).Methods("POST", "OPTIONS")
+	router.HandleFunc(hecPathPrefix+"/event/1.0", hecHandler.Event).Methods("POST", "OPTIONS")
+	router.HandleFunc(hecPathPrefix+"/raw", hecHandler.Raw).Methods("POST", "OPTIONS")
+	router.HandleFunc(hecPathPrefix+"/raw/1.0", hecHandler.Raw).Methods("POST", "OPTIONS")
+	router.HandleFunc(hecPathPrefix+"/ack", hecHandler.Ack).Methods("POST", "OPTIONS")
+	router.HandleFunc(hecPathPrefix+"/health", hecHandler.Health).Methods("GET", "OPTIONS")
+
 	router.HandleFunc("/query", queryHandler.Query).Methods("GET", "OPTIONS")
 	router.HandleFunc("/labels", queryHandler.Labels).Methods("GET", "OPTIONS")
 	router.HandleFunc("/labels/{name}/values", queryHandler.LabelValues).Methods("GET", "OPTIONS")
 
+	router.HandleFunc("/retention/dry-run", retentionHandler.DryRun).Methods("GET", "OPTIONS")
+
 	// WebSocket endpoint for live streaming
 	router.HandleFunc("/stream", streamHandler.HandleStream).Methods("GET")
 
 	// Loki-compatible API endpoints (for Grafana integration)
 	router.HandleFunc("/ready", lokiHandler.Ready).Methods("GET", "OPTIONS")
+	router.HandleFunc("/loki/api/v1/push", pushHandler.Push).Methods("POST", "OPTIONS")
 	router.HandleFunc("/loki/api/v1/query_range", lokiHandler.QueryRange).Methods("GET", "OPTIONS")
 	router.HandleFunc("/loki/api/v1/query", lokiHandler.Query).Methods("GET", "OPTIONS")
 	router.HandleFunc("/loki/api/v1/labels", lokiHandler.Labels).Methods("GET", "OPTIONS")
 	router.HandleFunc("/loki/api/v1/label/{name}/values", lokiHandler.LabelValues).Methods("GET", "OPTIONS")
+	router.HandleFunc("/loki/api/v1/delete", deleteHandler.Create).Methods("POST", "PUT", "OPTIONS")
+	router.HandleFunc("/loki/api/v1/delete", deleteHandler.List).Methods("GET")
+	router.HandleFunc("/loki/api/v1/delete", deleteHandler.Cancel).Methods("DELETE")
 
 	return router
 }
@@ -91,6 +127,12 @@ func authMiddleware(apiKey string) mux.MiddlewareFunc {
 				return
 			}
 
+			// HEC clients authenticate with HEC tokens
+			if strings.HasPrefix(r.URL.Path, hecPathPrefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Skip auth for WebSocket upgrade
 			if r.Header.Get("Upgrade") == "websocket" {
 				next.ServeHTTP(w, r)
@@ -10,6 +10,11 @@ type Config struct {
 	Server  ServerConfig  `yaml:"server"`
 	Storage StorageConfig `yaml:"storage"`
 	Ingest  IngestConfig  `yaml:"ingest"`
+	Query   QueryConfig   `yaml:"query"`
+	OTLP    OTLPConfig    `yaml:"otlp"`
+	Syslog  SyslogConfig  `yaml:"syslog"`
+	Elastic ElasticConfig `yaml:"elasticsearch"`
+	HEC     HECConfig     `yaml:"splunk_hec"`
 	Auth    AuthConfig    `yaml:"auth"`
 }
 
@@ -19,13 +24,111 @@ type ServerConfig struct {
 
 type StorageConfig struct {
 	Path           string `yaml:"path"`
+	IndexPath      string `yaml:"index_path"`
 	ChunkSizeBytes int    `yaml:"chunk_size_bytes"`
 	RetentionDays  int    `yaml:"retention_days"`
+	Compression    string `yaml:"compression"` // gzip, snappy, zstd or none
+
+	// Where chunks are kept; path is only used by the filesystem backend
+	Backend string   `yaml:"backend"` // filesystem or s3
+	S3      S3Config `yaml:"s3"`
+
+	// Per-stream overrides of retention_days; the longest matching rule wins
+	RetentionRules []RetentionRule `yaml:"retention_rules"`
+
+	// Oldest chunks are evicted once chunks under path exceed
+	// max_storage_bytes; 0 for no cap
+	MaxStorageBytes int64 `yaml:"max_storage_bytes"`
+
+	// Small chunks of a stream are merged up to chunk_size_bytes on disk;
+	// 0 disables compaction
+	CompactionIntervalMs int `yaml:"compaction_interval_ms"`
+
+	// Time between passes applying delete requests to chunks
+	DeleteIntervalMs int `yaml:"delete_interval_ms"`
+
+	// Chunks older than cold.min_age_hours move to a cheaper tier
+	Cold ColdTierConfig `yaml:"cold"`
+}
+
+// ColdTierConfig locates the cold storage tier; an empty backend disables it
+type ColdTierConfig struct {
+	Backend             string   `yaml:"backend"` // filesystem or s3
+	Path                string   `yaml:"path"`
+	S3                  S3Config `yaml:"s3"`
+	MinAgeHours         int      `yaml:"min_age_hours"` // by chunk end time
+	MigrationIntervalMs int      `yaml:"migration_interval_ms"`
+}
+
+// S3Config locates an S3-compatible bucket for chunks
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"` // e.g. https://s3.eu-west-1.amazonaws.com
+	Bucket          string `yaml:"bucket"`
+	Region          string `yaml:"region"`
+	Prefix          string `yaml:"prefix"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+}
+
+// RetentionRule keeps streams matching a LogQL selector for Days
+type RetentionRule struct {
+	Selector string `yaml:"selector"` // e.g. {level="debug"}
+	Days     int    `yaml:"days"`
 }
 
 type IngestConfig struct {
-	BufferSize    int `yaml:"buffer_size"`
-	FlushInterval int `yaml:"flush_interval_ms"`
+	BufferSize    int `yaml:"buffer_size"`       // max entries per chunk, 0 for no limit
+	FlushInterval int `yaml:"flush_interval_ms"` // how often chunk age and idleness are checked
+
+	// Head chunks are also cut at storage.chunk_size_bytes
+	MaxChunkAgeMs      int `yaml:"max_chunk_age_ms"`
+	ChunkIdleTimeoutMs int `yaml:"chunk_idle_timeout_ms"`
+
+	// Write-ahead log for buffered entries; an empty wal_dir disables it
+	WALDir              string `yaml:"wal_dir"`
+	WALSync             string `yaml:"wal_sync"` // always, interval or never
+	WALSyncIntervalMs   int    `yaml:"wal_sync_interval_ms"`
+	WALSegmentSizeBytes int64  `yaml:"wal_segment_size_bytes"`
+}
+
+// QueryConfig limits how many chunks queries read and decode at once
+type QueryConfig struct {
+	MaxConcurrency      int `yaml:"max_concurrency"`       // across all queries, 0 for half the CPUs
+	PerQueryConcurrency int `yaml:"per_query_concurrency"` // 0 for max_concurrency
+}
+
+// OTLPConfig controls how OpenTelemetry logs are mapped to streams
+type OTLPConfig struct {
+	// Resource and scope attributes that become stream labels, with
+	// invalid characters replaced by underscores; all other attributes are
+	// kept as entry metadata
+	LabelAttributes []string `yaml:"label_attributes"`
+}
+
+// ElasticConfig controls how documents sent to the Elasticsearch bulk API
+// are mapped to streams
+type ElasticConfig struct {
+	// Document fields, by dotted path, that become labels next to the
+	// index name; other fields are kept as entry metadata
+	LabelFields []string `yaml:"label_fields"`
+}
+
+// HECConfig configures the Splunk HTTP Event Collector endpoints, which
+// authenticate with their own tokens rather than the API key
+type HECConfig struct {
+	Tokens       []string `yaml:"tokens"`        // accepted tokens; with none every request is rejected
+	DefaultIndex string   `yaml:"default_index"` // for events that name no index
+}
+
+// SyslogConfig configures the syslog listeners; an empty address disables
+// a listener
+type SyslogConfig struct {
+	TCPAddress      string            `yaml:"tcp_address"` // e.g. ":1514"
+	UDPAddress      string            `yaml:"udp_address"`
+	MaxMessageSize  int               `yaml:"max_message_size"`
+	BatchSize       int               `yaml:"batch_size"`        // messages per ingest call
+	FlushIntervalMs int               `yaml:"flush_interval_ms"` // longest a message waits for its batch
+	Labels          map[string]string `yaml:"labels"`            // added to every syslog stream
 }
 
 type AuthConfig struct {
@@ -40,8 +143,9 @@ func Load(path string) (*Config, error) {
 		return DefaultConfig(), nil
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	// Start from defaults so options missing from the file keep sane values
+	cfg := DefaultConfig()
+	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
 
@@ -56,8 +160,17 @@ func Load(path string) (*Config, error) {
 	if storagePath := os.Getenv("LOKILITE_STORAGE_PATH"); storagePath != "" {
 		cfg.Storage.Path = storagePath
 	}
+	if accessKey := os.Getenv("LOKILITE_S3_ACCESS_KEY_ID"); accessKey != "" {
+		cfg.Storage.S3.AccessKeyID = accessKey
+	}
+	if secretKey := os.Getenv("LOKILITE_S3_SECRET_ACCESS_KEY"); secretKey != "" {
+		cfg.Storage.S3.SecretAccessKey = secretKey
+	}
+	if hecToken := os.Getenv("LOKILITE_HEC_TOKEN"); hecToken != "" {
+		cfg.HEC.Tokens = append(cfg.HEC.Tokens, hecToken)
+	}
 
-	return &cfg, nil
+	return cfg, nil
 }
 
 func DefaultConfig() *Config {
@@ -66,13 +179,55 @@ func DefaultConfig() *Config {
 			Port: "8080",
 		},
 		Storage: StorageConfig{
+			Backend:        "filesystem",
 			Path:           "./data/logs",
+			IndexPath:      "./data/index",
 			ChunkSizeBytes: 1024 * 1024, // 1MB
 			RetentionDays:  7,
+			Compression:    "gzip",
+
+			CompactionIntervalMs: 10 * 60 * 1000, // 10m
+			DeleteIntervalMs:     5 * 60 * 1000,  // 5m
+
+			Cold: ColdTierConfig{
+				MinAgeHours:         24,
+				MigrationIntervalMs: 10 * 60 * 1000, // 10m
+			},
 		},
 		Ingest: IngestConfig{
-			BufferSize:    1000,
-			FlushInterval: 5000,
+			BufferSize:          0,
+			FlushInterval:       5000,
+			MaxChunkAgeMs:       60 * 60 * 1000, // 1h
+			ChunkIdleTimeoutMs:  5 * 60 * 1000,  // 5m
+			WALDir:              "./data/wal",
+			WALSync:             "always",
+			WALSyncIntervalMs:   1000,
+			WALSegmentSizeBytes: 64 * 1024 * 1024, // 64MB
+		},
+		Query: QueryConfig{
+			MaxConcurrency:      0,
+			PerQueryConcurrency: 4,
+		},
+		OTLP: OTLPConfig{
+			LabelAttributes: []string{
+				"service.name",
+				"service.namespace",
+				"deployment.environment",
+				"k8s.namespace.name",
+				"k8s.pod.name",
+				"k8s.container.name",
+			},
+		},
+		Elastic: ElasticConfig{
+			LabelFields: []string{"host.name", "service.name", "log.level"},
+		},
+		HEC: HECConfig{
+			DefaultIndex: "main",
+		},
+		Syslog: SyslogConfig{
+			MaxMessageSize:  64 * 1024,
+			BatchSize:       1000,
+			FlushIntervalMs: 1000,
 		},
 		Auth: AuthConfig{
 			Enabled: false,
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -22,6 +23,22 @@ type Index struct {
 
 	// labelValues tracks all values for each label key
 	labelValues map[string]map[string]struct{}
+
+	// postings maps label name -> value -> sorted chunk IDs
+	postings map[string]map[string][]string
+
+	// allPostings holds every chunk ID, sorted
+	allPostings []string
+
+	// timeBuckets maps a bucket number -> sorted IDs of chunks overlapping it
+	timeBuckets map[int64][]string
+
+	// wideChunks holds sorted IDs of chunks spanning too many buckets to be
+	// bucketed; they are candidates for every time range
+	wideChunks []string
+
+	// store persists changes to disk, nil for a purely in-memory index
+	store *indexStore
 }
 
 // NewIndex creates a new in-memory index
@@ -31,6 +48,8 @@ func NewIndex() *Index {
 		chunkMeta:   make(map[string]*models.ChunkMeta),
 		labelKeys:   make(map[string]struct{}),
 		labelValues: make(map[string]map[string]struct{}),
+		postings:    make(map[string]map[string][]string),
+		timeBuckets: make(map[int64][]string),
 	}
 }
 
@@ -39,15 +58,7 @@ func (idx *Index) AddChunk(chunkID string, labels map[string]string, startTime,
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	// Create label hash
-	l := models.Labels(labels)
-	hash := l.Hash()
-
-	// Add to label index
-	idx.labelIndex[hash] = append(idx.labelIndex[hash], chunkID)
-
-	// Store chunk metadata
-	idx.chunkMeta[chunkID] = &models.ChunkMeta{
+	meta := &models.ChunkMeta{
 		ID:         chunkID,
 		Labels:     labels,
 		StartTime:  startTime.Unix(),
@@ -55,36 +66,96 @@ func (idx *Index) AddChunk(chunkID string, labels map[string]string, startTime,
 		EntryCount: entryCount,
 	}
 
-	// Track label keys and values
-	for k, v := range labels {
+	idx.addChunkLocked(meta)
+	idx.persist(logRecord{Op: opAdd, ID: chunkID, Chunk: meta})
+}
+
+// addChunkLocked adds chunk metadata to the in-memory structures.
+// Caller must hold idx.mu.
+func (idx *Index) addChunkLocked(meta *models.ChunkMeta) {
+	if _, exists := idx.chunkMeta[meta.ID]; exists {
+		idx.removeChunkLocked(meta.ID)
+	}
+
+	// Create label hash
+	hash := models.Labels(meta.Labels).Hash()
+
+	// Add to label index
+	idx.labelIndex[hash] = insertPosting(idx.labelIndex[hash], meta.ID)
+
+	// Store chunk metadata
+	idx.chunkMeta[meta.ID] = meta
+	idx.allPostings = insertPosting(idx.allPostings, meta.ID)
+
+	// Track label keys, values and postings
+	for k, v := range meta.Labels {
 		idx.labelKeys[k] = struct{}{}
 		if idx.labelValues[k] == nil {
 			idx.labelValues[k] = make(map[string]struct{})
 		}
 		idx.labelValues[k][v] = struct{}{}
+
+		if idx.postings[k] == nil {
+			idx.postings[k] = make(map[string][]string)
+		}
+		idx.postings[k][v] = insertPosting(idx.postings[k][v], meta.ID)
+	}
+
+	// Track time buckets
+	first, last, ok := chunkBuckets(meta)
+	if !ok {
+		idx.wideChunks = insertPosting(idx.wideChunks, meta.ID)
+		return
+	}
+	for b := first; b <= last; b++ {
+		idx.timeBuckets[b] = insertPosting(idx.timeBuckets[b], meta.ID)
 	}
 }
 
 // FindChunks returns chunk IDs matching the query labels and time range
 func (idx *Index) FindChunks(query map[string]string, startTime, endTime time.Time) []string {
+	matchers := make([]Matcher, 0, len(query))
+	for name, value := range query {
+		matchers = append(matchers, Matcher{Name: name, Value: value, Type: MatchEqual})
+	}
+	return idx.FindChunksMatching(matchers, startTime, endTime)
+}
+
+// FindChunksMatching returns sorted chunk IDs satisfying all matchers whose
+// time range overlaps [startTime, endTime]
+func (idx *Index) FindChunksMatching(matchers []Matcher, startTime, endTime time.Time) []string {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	var matchingChunks []string
 	startUnix := startTime.Unix()
 	endUnix := endTime.Unix()
+	if startUnix > endUnix {
+		return []string{}
+	}
 
-	// Iterate all chunks and check matches
-	for chunkID, meta := range idx.chunkMeta {
-		// Check time overlap
-		if meta.EndTime < startUnix || meta.StartTime > endUnix {
-			continue
+	candidates := idx.postingsForTimeRange(startUnix, endUnix)
+
+	// Positive matchers shrink the candidate set fastest, so apply them first
+	for _, m := range matchers {
+		if m.isPositive() {
+			candidates = idx.applyMatcher(candidates, m)
 		}
+	}
+	for _, m := range matchers {
+		if !m.isPositive() {
+			candidates = idx.applyMatcher(candidates, m)
+		}
+	}
 
-		// Check label match
-		if models.Labels(meta.Labels).Match(models.Labels(query)) {
-			matchingChunks = append(matchingChunks, chunkID)
+	// Buckets are coarse, so check exact chunk bounds. This also copies the
+	// result out of the shared postings lists.
+	matchingChunks := make([]string, 0, len(candidates))
+	for _, chunkID := range candidates {
+		meta := idx.chunkMeta[chunkID]
+		if meta == nil || meta.EndTime < startUnix || meta.StartTime > endUnix {
+			continue
 		}
+		matchingChunks = append(matchingChunks, chunkID)
 	}
 
 	return matchingChunks
@@ -123,11 +194,140 @@ func (idx *Index) GetLabelValues(labelKey string) []string {
 	return values
 }
 
-// RemoveChunk removes a chunk from the index
-func (idx *Index) RemoveChunk(chunkID string) {
+// RemoveChunk removes a chunk from the index and reports whether it was
+// indexed
+func (idx *Index) RemoveChunk(chunkID string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if _, exists := idx.chunkMeta[chunkID]; !exists {
+		return false
+	}
+
+	idx.removeChunkLocked(chunkID)
+	idx.persist(logRecord{Op: opRemove, ID: chunkID})
+	return true
+}
+
+// ReplaceChunks atomically swaps the chunks in replaced for a single new
+// chunk. It reports false and leaves the index unchanged if any replaced
+// chunk is no longer indexed.
+func (idx *Index) ReplaceChunks(replaced []string, chunkID string, labels map[string]string, startTime, endTime time.Time, entryCount int) bool {
+	return idx.ReplaceChunksInTier(replaced, chunkID, "", labels, startTime, endTime, entryCount)
+}
+
+// ReplaceChunksInTier is ReplaceChunks for a new chunk stored in the given
+// storage tier
+func (idx *Index) ReplaceChunksInTier(replaced []string, chunkID, tier string, labels map[string]string, startTime, endTime time.Time, entryCount int) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, id := range replaced {
+		if _, exists := idx.chunkMeta[id]; !exists {
+			return false
+		}
+	}
+
+	meta := &models.ChunkMeta{
+		ID:         chunkID,
+		Labels:     labels,
+		StartTime:  startTime.Unix(),
+		EndTime:    endTime.Unix(),
+		EntryCount: entryCount,
+		Tier:       tier,
+	}
+
+	idx.replaceChunksLocked(replaced, meta)
+	idx.persist(logRecord{Op: opReplace, ID: chunkID, Chunk: meta, Replaced: replaced})
+	return true
+}
+
+// replaceChunksLocked removes replaced and adds meta. Caller must hold idx.mu.
+func (idx *Index) replaceChunksLocked(replaced []string, meta *models.ChunkMeta) {
+	for _, id := range replaced {
+		idx.removeChunkLocked(id)
+	}
+	idx.addChunkLocked(meta)
+}
+
+// StreamChunks returns copies of the metadata of every chunk, grouped by
+// label hash and sorted by start time
+func (idx *Index) StreamChunks() map[string][]models.ChunkMeta {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	streams := make(map[string][]models.ChunkMeta, len(idx.labelIndex))
+	for hash, ids := range idx.labelIndex {
+		metas := make([]models.ChunkMeta, 0, len(ids))
+		for _, id := range ids {
+			metas = append(metas, *idx.chunkMeta[id])
+		}
+		sort.SliceStable(metas, func(i, j int) bool {
+			return metas[i].StartTime < metas[j].StartTime
+		})
+		streams[hash] = metas
+	}
+	return streams
+}
+
+// SetChunkTier records the storage tier holding a chunk. It reports false
+// if the chunk is no longer indexed.
+func (idx *Index) SetChunkTier(chunkID, tier string) bool {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
+	meta, exists := idx.chunkMeta[chunkID]
+	if !exists {
+		return false
+	}
+	if meta.Tier == tier {
+		return true
+	}
+
+	// Swap in a copy so metadata handed out earlier stays unchanged
+	updated := *meta
+	updated.Tier = tier
+	idx.chunkMeta[chunkID] = &updated
+	idx.persist(logRecord{Op: opAdd, ID: chunkID, Chunk: &updated})
+	return true
+}
+
+// ChunksEndingBefore returns copies of the metadata of chunks whose newest
+// entry is older than cutoff, oldest first
+func (idx *Index) ChunksEndingBefore(cutoff time.Time) []models.ChunkMeta {
+	return idx.chunksByEndTime(func(meta *models.ChunkMeta) bool {
+		return meta.EndTime < cutoff.Unix()
+	})
+}
+
+// ChunksByEndTime returns copies of the metadata of every chunk, ordered by
+// end time
+func (idx *Index) ChunksByEndTime() []models.ChunkMeta {
+	return idx.chunksByEndTime(func(*models.ChunkMeta) bool { return true })
+}
+
+func (idx *Index) chunksByEndTime(keep func(*models.ChunkMeta) bool) []models.ChunkMeta {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var metas []models.ChunkMeta
+	for _, meta := range idx.chunkMeta {
+		if keep(meta) {
+			metas = append(metas, *meta)
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].EndTime != metas[j].EndTime {
+			return metas[i].EndTime < metas[j].EndTime
+		}
+		return metas[i].ID < metas[j].ID
+	})
+	return metas
+}
+
+// removeChunkLocked removes a chunk from the in-memory structures.
+// Caller must hold idx.mu.
+func (idx *Index) removeChunkLocked(chunkID string) {
 	meta, exists := idx.chunkMeta[chunkID]
 	if !exists {
 		return
@@ -135,15 +335,41 @@ func (idx *Index) RemoveChunk(chunkID string) {
 
 	// Remove from label index
 	hash := models.Labels(meta.Labels).Hash()
-	chunks := idx.labelIndex[hash]
-	for i, id := range chunks {
-		if id == chunkID {
-			idx.labelIndex[hash] = append(chunks[:i], chunks[i+1:]...)
-			break
+	idx.labelIndex[hash] = removePosting(idx.labelIndex[hash], chunkID)
+	if len(idx.labelIndex[hash]) == 0 {
+		delete(idx.labelIndex, hash)
+	}
+
+	// Remove from postings, dropping label values and keys no chunk uses
+	for k, v := range meta.Labels {
+		if values, ok := idx.postings[k]; ok {
+			values[v] = removePosting(values[v], chunkID)
+			if len(values[v]) == 0 {
+				delete(values, v)
+				delete(idx.labelValues[k], v)
+			}
+			if len(values) == 0 {
+				delete(idx.postings, k)
+				delete(idx.labelValues, k)
+				delete(idx.labelKeys, k)
+			}
+		}
+	}
+
+	// Remove from time buckets
+	if first, last, ok := chunkBuckets(meta); ok {
+		for b := first; b <= last; b++ {
+			idx.timeBuckets[b] = removePosting(idx.timeBuckets[b], chunkID)
+			if len(idx.timeBuckets[b]) == 0 {
+				delete(idx.timeBuckets, b)
+			}
 		}
+	} else {
+		idx.wideChunks = removePosting(idx.wideChunks, chunkID)
 	}
 
 	// Remove chunk metadata
+	idx.allPostings = removePosting(idx.allPostings, chunkID)
 	delete(idx.chunkMeta, chunkID)
 }
 
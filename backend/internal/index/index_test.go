@@ -0,0 +1,154 @@
+package index
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func newTestIndex() *Index {
+	idx := NewIndex()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	idx.AddChunk("chunk_1", map[string]string{"app": "nginx", "level": "error"}, base, base.Add(time.Minute), 10)
+	idx.AddChunk("chunk_2", map[string]string{"app": "nginx", "level": "info"}, base, base.Add(time.Minute), 10)
+	idx.AddChunk("chunk_3", map[string]string{"app": "api"}, base.Add(3*time.Hour), base.Add(3*time.Hour+time.Minute), 10)
+	return idx
+}
+
+func assertChunks(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected chunks %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected chunks %v, got %v", want, got)
+		}
+	}
+}
+
+func TestFindChunksMatching_Operators(t *testing.T) {
+	idx := newTestIndex()
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		matchers []Matcher
+		want     []string
+	}{
+		{"equal", []Matcher{{Name: "app", Value: "nginx", Type: MatchEqual}}, []string{"chunk_1", "chunk_2"}},
+		{"not equal", []Matcher{{Name: "level", Value: "error", Type: MatchNotEqual}}, []string{"chunk_2", "chunk_3"}},
+		{"regex", []Matcher{{Name: "app", Value: "ap.*", Type: MatchRegex, Regex: regexp.MustCompile("ap.*")}}, []string{"chunk_3"}},
+		{"not regex", []Matcher{{Name: "level", Value: "err.*", Type: MatchNotRegex, Regex: regexp.MustCompile("err.*")}}, []string{"chunk_2", "chunk_3"}},
+		{"combined", []Matcher{
+			{Name: "app", Value: "nginx", Type: MatchEqual},
+			{Name: "level", Value: "info", Type: MatchNotEqual},
+		}, []string{"chunk_1"}},
+		{"no matchers", nil, []string{"chunk_1", "chunk_2", "chunk_3"}},
+		{"regex matching empty", []Matcher{{Name: "level", Value: "err.*|", Type: MatchRegex, Regex: regexp.MustCompile("^(err.*|)$")}}, []string{"chunk_1", "chunk_3"}},
+		{"regex matching all", []Matcher{{Name: "level", Value: ".*", Type: MatchRegex, Regex: regexp.MustCompile(".*")}}, []string{"chunk_1", "chunk_2", "chunk_3"}},
+		{"not regex matching empty", []Matcher{{Name: "level", Value: "info|", Type: MatchNotRegex, Regex: regexp.MustCompile("^(info|)$")}}, []string{"chunk_1"}},
+	}
+
+	labels := map[string]map[string]string{
+		"chunk_1": {"app": "nginx", "level": "error"},
+		"chunk_2": {"app": "nginx", "level": "info"},
+		"chunk_3": {"app": "api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idx.FindChunksMatching(tt.matchers, start, end)
+			assertChunks(t, got, tt.want...)
+
+			// MatchLabels agrees with the index
+			var matched []string
+			for _, id := range []string{"chunk_1", "chunk_2", "chunk_3"} {
+				if MatchLabels(tt.matchers, labels[id]) {
+					matched = append(matched, id)
+				}
+			}
+			assertChunks(t, matched, tt.want...)
+		})
+	}
+}
+
+func TestFindChunksMatching_TimeRange(t *testing.T) {
+	idx := newTestIndex()
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	assertChunks(t, idx.FindChunksMatching(nil, start, start.Add(2*time.Hour)), "chunk_3")
+	assertChunks(t, idx.FindChunksMatching(nil, start, start.Add(30*time.Minute)))
+}
+
+func TestRemoveChunk(t *testing.T) {
+	idx := newTestIndex()
+	idx.RemoveChunk("chunk_1")
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	matchers := []Matcher{{Name: "app", Value: "nginx", Type: MatchEqual}}
+	assertChunks(t, idx.FindChunksMatching(matchers, start, start.Add(24*time.Hour)), "chunk_2")
+}
+
+func TestPersistAndLoadIndex(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestIndex()
+	if err := idx.PersistIndex(dir); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	// Changes after the snapshot go to the log
+	idx.RemoveChunk("chunk_2")
+	idx.AddChunk("chunk_4", map[string]string{"app": "nginx"}, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), time.Date(2024, 1, 15, 10, 1, 0, 0, time.UTC), 5)
+
+	loaded, err := LoadIndex(dir)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	matchers := []Matcher{{Name: "app", Value: "nginx", Type: MatchEqual}}
+	assertChunks(t, loaded.FindChunksMatching(matchers, start, start.Add(24*time.Hour)), "chunk_1", "chunk_4")
+}
+
+func TestReplaceChunks_Persisted(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestIndex()
+	if err := idx.PersistIndex(dir); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	labels := map[string]string{"app": "nginx", "level": "error"}
+	if !idx.ReplaceChunks([]string{"chunk_1"}, "chunk_merged", labels, base, base.Add(time.Minute), 10) {
+		t.Fatal("expected replace to succeed")
+	}
+	if idx.ReplaceChunks([]string{"chunk_1"}, "chunk_other", labels, base, base.Add(time.Minute), 10) {
+		t.Fatal("expected replace of a removed chunk to fail")
+	}
+
+	loaded, err := LoadIndex(dir)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	matchers := []Matcher{{Name: "level", Value: "error", Type: MatchEqual}}
+	assertChunks(t, loaded.FindChunksMatching(matchers, start, start.Add(24*time.Hour)), "chunk_merged")
+}
+
+func TestRemoveChunk_PrunesLabels(t *testing.T) {
+	idx := newTestIndex()
+	idx.RemoveChunk("chunk_1")
+	idx.RemoveChunk("chunk_2")
+
+	for _, k := range idx.GetAllLabels() {
+		if k == "level" {
+			t.Fatal("expected unreferenced label key to be pruned")
+		}
+	}
+	if values := idx.GetLabelValues("app"); len(values) != 1 || values[0] != "api" {
+		t.Fatalf("expected only app=api to remain, got %v", values)
+	}
+}
@@ -0,0 +1,91 @@
+package index
+
+import "regexp"
+
+// MatchType defines how a matcher compares a label value
+type MatchType int
+
+const (
+	MatchEqual    MatchType = iota // =
+	MatchNotEqual                  // !=
+	MatchRegex                     // =~
+	MatchNotRegex                  // !~
+)
+
+// Matcher selects chunks by a single label condition
+type Matcher struct {
+	Name  string
+	Value string
+	Type  MatchType
+	Regex *regexp.Regexp // Compiled regex for =~ and !~
+}
+
+// isPositive reports whether the matcher can only narrow the candidate set
+// to chunks carrying the label, which makes it cheap to evaluate first
+func (m Matcher) isPositive() bool {
+	return !m.Matches("")
+}
+
+// Matches reports whether a label value satisfies the matcher. A missing
+// label has the empty value, as in Loki and Prometheus, so `app=""` and
+// `app=~".*"` also select streams without an app label.
+func (m Matcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegex:
+		return m.Regex != nil && m.Regex.MatchString(value)
+	case MatchNotRegex:
+		// A matcher without a pattern only keeps streams without the label
+		if m.Regex == nil {
+			return value == ""
+		}
+		return !m.Regex.MatchString(value)
+	}
+	return false
+}
+
+// applyMatcher filters sorted candidate chunk IDs by a matcher.
+// Caller must hold idx.mu.
+func (idx *Index) applyMatcher(candidates []string, m Matcher) []string {
+	values := idx.postings[m.Name]
+
+	// Equality only needs the postings of its own value
+	switch {
+	case m.Type == MatchEqual && m.Value != "":
+		return intersectPostings(candidates, values[m.Value])
+	case m.Type == MatchNotEqual && m.Value != "":
+		return subtractPostings(candidates, values[m.Value])
+	}
+
+	// Chunks without the label match exactly when the empty value does, so
+	// such a matcher drops the chunks with a rejected value instead
+	if m.Matches("") {
+		return subtractPostings(candidates, unionValues(values, func(v string) bool { return !m.Matches(v) }))
+	}
+	return intersectPostings(candidates, unionValues(values, m.Matches))
+}
+
+// unionValues merges the postings of every value accepted by match
+func unionValues(values map[string][]string, match func(string) bool) []string {
+	lists := make([][]string, 0, len(values))
+	for v, list := range values {
+		if match(v) {
+			lists = append(lists, list)
+		}
+	}
+	return unionPostings(lists...)
+}
+
+// MatchLabels reports whether a label set satisfies every matcher, with the
+// same semantics FindChunksMatching applies to indexed chunks
+func MatchLabels(matchers []Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,23 +1,384 @@
 package index
 
-// NOTE: BoltDB persistence will be added later
-// For now, the index is purely in-memory
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
 
-// PersistIndex saves the index to BoltDB
+	"github.com/logpulse/backend/internal/models"
+)
+
+// The persisted index is a snapshot of the full index plus an append-only
+// log of changes made since the snapshot was taken. Both are JSON so they
+// can be inspected with standard tools.
+const (
+	snapshotFile = "index.snapshot"
+	logFile      = "index.log"
+
+	snapshotVersion = 1
+
+	// snapshotEvery is the number of logged changes after which the log is
+	// folded into a fresh snapshot
+	snapshotEvery = 10000
+)
+
+var ErrIndexNotFound = errors.New("persisted index not found")
+
+type indexOp string
+
+const (
+	opAdd     indexOp = "add"
+	opRemove  indexOp = "remove"
+	opReplace indexOp = "replace"
+)
+
+// logRecord is a single change in the index log
+type logRecord struct {
+	Op    indexOp           `json:"op"`
+	ID    string            `json:"id"`
+	Chunk *models.ChunkMeta `json:"chunk,omitempty"`
+
+	// Replaced lists the chunks an opReplace record swaps out
+	Replaced []string `json:"replaced,omitempty"`
+}
+
+// snapshot is the on-disk form of the whole index. Structures that are
+// cheap to derive from chunk metadata are rebuilt on load.
+type snapshot struct {
+	Version  int                            `json:"version"`
+	Chunks   []*models.ChunkMeta            `json:"chunks"`
+	Postings map[string]map[string][]string `json:"postings,omitempty"`
+}
+
+// indexStore appends index changes to disk
+type indexStore struct {
+	dir     string
+	logFile *os.File
+	records int
+
+	// dirty is set when a change could not be logged; the log may then
+	// miss changes or end in a torn record, so only a full snapshot can
+	// bring the disk up to date
+	dirty bool
+}
+
+// PersistIndex writes a full snapshot of the index to dbPath and keeps
+// appending subsequent changes there
 func (idx *Index) PersistIndex(dbPath string) error {
-	// TODO: Implement BoltDB persistence
-	// 1. Open BoltDB file
-	// 2. Create buckets: "chunks", "labels"
-	// 3. Serialize and store chunk metadata
-	// 4. Store label key-value mappings
-	return nil
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if err := os.MkdirAll(dbPath, 0755); err != nil {
+		return err
+	}
+
+	if idx.store != nil && idx.store.dir != dbPath {
+		idx.store.close()
+		idx.store = nil
+	}
+	if idx.store == nil {
+		idx.store = &indexStore{dir: dbPath}
+	}
+
+	return idx.writeSnapshot()
 }
 
-// LoadIndex loads the index from BoltDB
+// LoadIndex loads the index from dbPath and keeps it persisted there.
+// It returns ErrIndexNotFound if no snapshot exists yet.
 func LoadIndex(dbPath string) (*Index, error) {
-	// TODO: Implement BoltDB loading
-	// 1. Open BoltDB file
-	// 2. Read all chunk metadata
-	// 3. Rebuild in-memory index
-	return NewIndex(), nil
+	file, err := os.Open(filepath.Join(dbPath, snapshotFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrIndexNotFound
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var snap snapshot
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("decode index snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported index snapshot version %d", snap.Version)
+	}
+
+	idx := NewIndex()
+	for _, meta := range snap.Chunks {
+		idx.chunkMeta[meta.ID] = meta
+	}
+
+	if snap.Postings != nil {
+		idx.postings = snap.Postings
+	}
+	idx.buildDerived()
+
+	// Replay changes made since the snapshot
+	store := &indexStore{dir: dbPath}
+	replayed, err := store.replay(idx)
+	if err != nil {
+		return nil, err
+	}
+	idx.store = store
+
+	log.Printf("Loaded index from %s: %d chunks, %d changes replayed", dbPath, len(idx.chunkMeta), replayed)
+	return idx, nil
+}
+
+// Close flushes and closes the persisted index
+func (idx *Index) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.store == nil {
+		return nil
+	}
+
+	err := idx.writeSnapshot()
+	idx.store.close()
+	idx.store = nil
+	return err
+}
+
+// persist appends a change to the index log. If the log cannot be written,
+// a full snapshot is taken instead, now and on every change until one
+// succeeds. Caller must hold idx.mu.
+func (idx *Index) persist(rec logRecord) {
+	if idx.store == nil {
+		return
+	}
+
+	if !idx.store.dirty {
+		err := idx.store.append(rec)
+		if err == nil && idx.store.records < snapshotEvery {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to persist index change for %s, writing a snapshot instead: %v", rec.ID, err)
+			idx.store.dirty = true
+		}
+	}
+
+	// The snapshot covers the change along with everything before it
+	if err := idx.writeSnapshot(); err != nil {
+		log.Printf("Failed to write index snapshot: %v", err)
+		return
+	}
+	idx.store.dirty = false
+}
+
+// writeSnapshot atomically replaces the snapshot and truncates the log.
+// Caller must hold idx.mu.
+func (idx *Index) writeSnapshot() error {
+	snap := snapshot{
+		Version:  snapshotVersion,
+		Chunks:   make([]*models.ChunkMeta, 0, len(idx.chunkMeta)),
+		Postings: idx.postings,
+	}
+	for _, meta := range idx.chunkMeta {
+		snap.Chunks = append(snap.Chunks, meta)
+	}
+
+	path := filepath.Join(idx.store.dir, snapshotFile)
+	tmpPath := path + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	if err := json.NewEncoder(w).Encode(snap); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// Make the rename durable before dropping the log, or a crash could
+	// bring back the old snapshot with an empty log
+	if err := syncDir(idx.store.dir); err != nil {
+		return err
+	}
+
+	// The snapshot now covers everything in the log
+	return idx.store.truncate()
+}
+
+// buildDerived bulk-builds every structure other than postings from chunk
+// metadata and postings. Appending and sorting once is much cheaper than
+// inserting chunks one by one.
+func (idx *Index) buildDerived() {
+	for k, values := range idx.postings {
+		idx.labelKeys[k] = struct{}{}
+		idx.labelValues[k] = make(map[string]struct{}, len(values))
+		for v := range values {
+			idx.labelValues[k][v] = struct{}{}
+		}
+	}
+
+	idx.allPostings = make([]string, 0, len(idx.chunkMeta))
+	for id, meta := range idx.chunkMeta {
+		hash := models.Labels(meta.Labels).Hash()
+		idx.labelIndex[hash] = append(idx.labelIndex[hash], id)
+		idx.allPostings = append(idx.allPostings, id)
+
+		first, last, ok := chunkBuckets(meta)
+		if !ok {
+			idx.wideChunks = append(idx.wideChunks, id)
+			continue
+		}
+		for b := first; b <= last; b++ {
+			idx.timeBuckets[b] = append(idx.timeBuckets[b], id)
+		}
+	}
+
+	sort.Strings(idx.allPostings)
+	sort.Strings(idx.wideChunks)
+	for _, list := range idx.labelIndex {
+		sort.Strings(list)
+	}
+	for _, list := range idx.timeBuckets {
+		sort.Strings(list)
+	}
+}
+
+// replay applies logged changes to idx and opens the log for appending.
+// A partially written trailing record is discarded.
+func (s *indexStore) replay(idx *Index) (int, error) {
+	file, err := os.OpenFile(filepath.Join(s.dir, logFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(file)
+	var validOffset int64
+	replayed := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return 0, err
+		}
+
+		var rec logRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			log.Printf("Discarding corrupt index log record at offset %d: %v", validOffset, err)
+			break
+		}
+
+		switch rec.Op {
+		case opAdd:
+			if rec.Chunk != nil {
+				idx.addChunkLocked(rec.Chunk)
+			}
+		case opRemove:
+			idx.removeChunkLocked(rec.ID)
+		case opReplace:
+			if rec.Chunk != nil {
+				idx.replaceChunksLocked(rec.Replaced, rec.Chunk)
+			}
+		}
+
+		validOffset += int64(len(line))
+		replayed++
+	}
+
+	if err := file.Truncate(validOffset); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if _, err := file.Seek(validOffset, io.SeekStart); err != nil {
+		file.Close()
+		return 0, err
+	}
+
+	s.logFile = file
+	s.records = replayed
+	return replayed, nil
+}
+
+// append writes a record to the log and syncs it
+func (s *indexStore) append(rec logRecord) error {
+	if s.logFile == nil {
+		file, err := os.OpenFile(filepath.Join(s.dir, logFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.logFile = file
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if _, err := s.logFile.Write(line); err != nil {
+		return err
+	}
+	s.records++
+
+	return s.logFile.Sync()
+}
+
+// truncate empties the log after a snapshot
+func (s *indexStore) truncate() error {
+	if s.logFile != nil {
+		s.logFile.Close()
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, logFile), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		s.logFile = nil
+		return err
+	}
+
+	s.logFile = file
+	s.records = 0
+	return file.Sync()
+}
+
+// syncDir makes changes to a directory's entries durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (s *indexStore) close() {
+	if s.logFile != nil {
+		s.logFile.Close()
+		s.logFile = nil
+	}
 }
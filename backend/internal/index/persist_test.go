@@ -0,0 +1,131 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPersistIndex_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestIndex()
+	if err := idx.PersistIndex(dir); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	if err := idx.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	loaded, err := LoadIndex(dir)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.StreamChunks(), idx.StreamChunks()) {
+		t.Errorf("expected %v, got %v", idx.StreamChunks(), loaded.StreamChunks())
+	}
+	want, got := idx.GetLabelValues("level"), loaded.GetLabelValues("level")
+	sort.Strings(want)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected label values %v, got %v", want, got)
+	}
+
+	if _, err := LoadIndex(t.TempDir()); err != ErrIndexNotFound {
+		t.Errorf("expected ErrIndexNotFound, got %v", err)
+	}
+}
+
+func TestLoadIndex_DiscardsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestIndex()
+	if err := idx.PersistIndex(dir); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	idx.AddChunk("chunk_4", map[string]string{"app": "api"}, base, base.Add(time.Minute), 5)
+	idx.AddChunk("chunk_5", map[string]string{"app": "api"}, base, base.Add(time.Minute), 5)
+
+	// Cut the last record short as a crash during the write would
+	logPath := filepath.Join(dir, logFile)
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if err := os.Truncate(logPath, info.Size()-10); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+
+	loaded, err := LoadIndex(dir)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.GetChunkMeta("chunk_4") == nil {
+		t.Error("expected the complete record to be replayed")
+	}
+	if loaded.GetChunkMeta("chunk_5") != nil {
+		t.Error("expected the torn record to be discarded")
+	}
+
+	// The torn tail is cut off so later records are replayed
+	loaded.AddChunk("chunk_6", map[string]string{"app": "api"}, base, base.Add(time.Minute), 5)
+	reloaded, err := LoadIndex(dir)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if reloaded.GetChunkMeta("chunk_6") == nil {
+		t.Error("expected a record written after the torn one to be replayed")
+	}
+}
+
+func TestLoadIndex_ReplaysReplace(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestIndex()
+	if err := idx.PersistIndex(dir); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	labels := map[string]string{"app": "nginx"}
+	if !idx.ReplaceChunks([]string{"chunk_1", "chunk_2"}, "chunk_merged", labels, base, base.Add(2*time.Minute), 20) {
+		t.Fatal("expected replace to succeed")
+	}
+	idx.RemoveChunk("chunk_3")
+
+	loaded, err := LoadIndex(dir)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.StreamChunks(), idx.StreamChunks()) {
+		t.Errorf("expected %v, got %v", idx.StreamChunks(), loaded.StreamChunks())
+	}
+	if values := loaded.GetLabelValues("level"); len(values) != 0 {
+		t.Errorf("expected the replaced chunks' labels to be gone, got %v", values)
+	}
+}
+
+func TestPersist_SnapshotsWhenLogFails(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestIndex()
+	if err := idx.PersistIndex(dir); err != nil {
+		t.Fatalf("persist failed: %v", err)
+	}
+
+	// Appends to a closed log fail
+	idx.store.logFile.Close()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	idx.AddChunk("chunk_4", map[string]string{"app": "api"}, base, base.Add(time.Minute), 5)
+	if idx.store.dirty {
+		t.Error("expected the snapshot to bring the store up to date")
+	}
+
+	loaded, err := LoadIndex(dir)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.GetChunkMeta("chunk_4") == nil {
+		t.Error("expected the chunk to survive a failed log append")
+	}
+}
@@ -0,0 +1,98 @@
+package index
+
+import "sort"
+
+// Postings lists are sorted slices of chunk IDs. Keeping them sorted lets
+// matchers be combined with linear merges instead of set lookups.
+
+// insertPosting adds id to a sorted postings list
+func insertPosting(list []string, id string) []string {
+	i := sort.SearchStrings(list, id)
+	if i < len(list) && list[i] == id {
+		return list
+	}
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = id
+	return list
+}
+
+// removePosting removes id from a sorted postings list
+func removePosting(list []string, id string) []string {
+	i := sort.SearchStrings(list, id)
+	if i >= len(list) || list[i] != id {
+		return list
+	}
+	return append(list[:i], list[i+1:]...)
+}
+
+// intersectPostings returns IDs present in both lists
+func intersectPostings(a, b []string) []string {
+	result := make([]string, 0, min(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			result = append(result, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return result
+}
+
+// unionPostings returns IDs present in any of the lists
+func unionPostings(lists ...[]string) []string {
+	switch len(lists) {
+	case 0:
+		return []string{}
+	case 1:
+		return lists[0]
+	}
+
+	mid := len(lists) / 2
+	a := unionPostings(lists[:mid]...)
+	b := unionPostings(lists[mid:]...)
+
+	result := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			result = append(result, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		default:
+			result = append(result, b[j])
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+// subtractPostings returns IDs in a that are not in b
+func subtractPostings(a, b []string) []string {
+	result := make([]string, 0, len(a))
+	i, j := 0, 0
+	for i < len(a) {
+		switch {
+		case j >= len(b) || a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] == b[j]:
+			i++
+			j++
+		default:
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package index
+
+import "github.com/logpulse/backend/internal/models"
+
+const (
+	// timeBucketSeconds is the width of a time bucket
+	timeBucketSeconds = 3600
+
+	// maxBucketsPerChunk bounds how many buckets a single chunk is added to.
+	// Chunks spanning more are kept in wideChunks instead.
+	maxBucketsPerChunk = 24 * 31
+)
+
+// bucketOf returns the bucket containing a Unix timestamp
+func bucketOf(ts int64) int64 {
+	b := ts / timeBucketSeconds
+	if ts < 0 && ts%timeBucketSeconds != 0 {
+		b--
+	}
+	return b
+}
+
+// chunkBuckets returns the range of buckets a chunk overlaps. ok is false
+// when the chunk is too wide to be bucketed.
+func chunkBuckets(meta *models.ChunkMeta) (first, last int64, ok bool) {
+	first = bucketOf(meta.StartTime)
+	last = bucketOf(meta.EndTime)
+	if last < first {
+		first, last = last, first
+	}
+	if last-first+1 > maxBucketsPerChunk {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// postingsForTimeRange returns sorted IDs of chunks that may overlap
+// [startUnix, endUnix]. Caller must hold idx.mu.
+func (idx *Index) postingsForTimeRange(startUnix, endUnix int64) []string {
+	first := bucketOf(startUnix)
+	last := bucketOf(endUnix)
+
+	lists := [][]string{idx.wideChunks}
+
+	// Walk whichever is smaller: the requested range or the populated buckets
+	if last-first+1 > int64(len(idx.timeBuckets)) {
+		for b, list := range idx.timeBuckets {
+			if b >= first && b <= last {
+				lists = append(lists, list)
+			}
+		}
+	} else {
+		for b := first; b <= last; b++ {
+			if list, ok := idx.timeBuckets[b]; ok {
+				lists = append(lists, list)
+			}
+		}
+	}
+
+	return unionPostings(lists...)
+}
@@ -0,0 +1,81 @@
+package ingest
+
+import "time"
+
+// Reasons a head chunk is cut and written to storage
+const (
+	CutReasonSize     = "size"
+	CutReasonEntries  = "entries"
+	CutReasonAge      = "age"
+	CutReasonIdle     = "idle"
+	CutReasonShutdown = "shutdown"
+)
+
+// ChunkLimits controls when a stream's open head chunk is cut
+type ChunkLimits struct {
+	// MaxBytes cuts a chunk once its uncompressed lines reach this size
+	MaxBytes int
+	// MaxEntries cuts a chunk once it holds this many entries, 0 for no limit
+	MaxEntries int
+	// MaxAge cuts a chunk this long after its first entry was appended
+	MaxAge time.Duration
+	// IdleTimeout cuts a chunk when no entry was appended for this long
+	IdleTimeout time.Duration
+	// CheckInterval is how often chunks are checked for age and idleness
+	CheckInterval time.Duration
+}
+
+// ChunkMetrics describes open head chunks and why chunks were cut
+type ChunkMetrics struct {
+	HeadChunks int
+	HeadBytes  int64
+	Cuts       map[string]int64
+	Limits     ChunkLimits
+}
+
+// fullReason returns why buf must be cut right away, or "" if it has room
+func (l ChunkLimits) fullReason(buf *logBuffer) string {
+	if l.MaxBytes > 0 && buf.size >= l.MaxBytes {
+		return CutReasonSize
+	}
+	if l.MaxEntries > 0 && len(buf.entries) >= l.MaxEntries {
+		return CutReasonEntries
+	}
+	return ""
+}
+
+// expiredReason returns why buf must be cut at now, or "" if it may stay open
+func (l ChunkLimits) expiredReason(buf *logBuffer, now time.Time) string {
+	if l.MaxAge > 0 && now.Sub(buf.createdAt) >= l.MaxAge {
+		return CutReasonAge
+	}
+	if l.IdleTimeout > 0 && now.Sub(buf.lastAppend) >= l.IdleTimeout {
+		return CutReasonIdle
+	}
+	return ""
+}
+
+// GetChunkMetrics returns head chunk metrics
+func (ing *Ingestor) GetChunkMetrics() ChunkMetrics {
+	metrics := ChunkMetrics{
+		Cuts:   make(map[string]int64),
+		Limits: ing.limits,
+	}
+
+	ing.bufferMu.Lock()
+	for _, buf := range ing.buffers {
+		if len(buf.entries) > 0 {
+			metrics.HeadChunks++
+			metrics.HeadBytes += int64(buf.size)
+		}
+	}
+	ing.bufferMu.Unlock()
+
+	ing.metricsMu.RLock()
+	for reason, count := range ing.chunkCuts {
+		metrics.Cuts[reason] = count
+	}
+	ing.metricsMu.RUnlock()
+
+	return metrics
+}
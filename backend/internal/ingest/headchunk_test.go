@@ -0,0 +1,100 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/storage"
+)
+
+func newTestIngestor(t *testing.T, limits ChunkLimits) (*Ingestor, *storage.Writer) {
+	t.Helper()
+	writer := storage.NewWriter(t.TempDir(), 0, storage.CompressionSnappy)
+	return NewIngestor(index.NewIndex(), writer, limits, nil), writer
+}
+
+func ingestLines(t *testing.T, ing *Ingestor, lines ...string) {
+	t.Helper()
+	stream := models.Stream{Labels: map[string]string{"app": "nginx"}}
+	for _, line := range lines {
+		stream.Entries = append(stream.Entries, models.Entry{Ts: "2024-01-15T10:00:00Z", Line: line})
+	}
+	if _, err := ing.Ingest(&models.IngestRequest{Streams: []models.Stream{stream}}); err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+}
+
+func assertCuts(t *testing.T, ing *Ingestor, writer *storage.Writer, want map[string]int64) {
+	t.Helper()
+	metrics := ing.GetChunkMetrics()
+	var total int64
+	for _, reason := range []string{CutReasonSize, CutReasonEntries, CutReasonAge, CutReasonIdle, CutReasonShutdown} {
+		if metrics.Cuts[reason] != want[reason] {
+			t.Errorf("expected %d cuts by %s, got %d", want[reason], reason, metrics.Cuts[reason])
+		}
+		total += want[reason]
+	}
+	if got := writer.GetChunkCount(); int64(got) != total {
+		t.Errorf("expected %d chunks, got %d", total, got)
+	}
+}
+
+func TestChunkLimits_Size(t *testing.T) {
+	ing, writer := newTestIngestor(t, ChunkLimits{MaxBytes: 100})
+
+	ingestLines(t, ing, strings.Repeat("a", 60))
+	assertCuts(t, ing, writer, nil)
+
+	ingestLines(t, ing, strings.Repeat("b", 40))
+	assertCuts(t, ing, writer, map[string]int64{CutReasonSize: 1})
+	if metrics := ing.GetChunkMetrics(); metrics.HeadChunks != 0 || metrics.HeadBytes != 0 {
+		t.Errorf("expected no open head chunk, got %+v", metrics)
+	}
+}
+
+func TestChunkLimits_Entries(t *testing.T) {
+	ing, writer := newTestIngestor(t, ChunkLimits{MaxBytes: 1 << 20, MaxEntries: 3})
+
+	ingestLines(t, ing, "one", "two")
+	assertCuts(t, ing, writer, nil)
+	ingestLines(t, ing, "three")
+	ingestLines(t, ing, "four", "five", "six", "seven")
+	assertCuts(t, ing, writer, map[string]int64{CutReasonEntries: 2})
+}
+
+func TestChunkLimits_AgeAndIdle(t *testing.T) {
+	ing, writer := newTestIngestor(t, ChunkLimits{MaxBytes: 1 << 20, MaxAge: time.Hour, IdleTimeout: 5 * time.Minute})
+	start := time.Now()
+
+	ingestLines(t, ing, "first")
+	ing.flushExpired(start.Add(time.Minute))
+	assertCuts(t, ing, writer, nil)
+
+	// Idle: nothing was appended for the idle timeout
+	ing.flushExpired(start.Add(6 * time.Minute))
+	assertCuts(t, ing, writer, map[string]int64{CutReasonIdle: 1})
+
+	// Age: appends keep the chunk from going idle until it is too old
+	ingestLines(t, ing, "second")
+	ing.bufferMu.Lock()
+	for _, buf := range ing.buffers {
+		buf.createdAt = start.Add(-time.Hour)
+	}
+	ing.bufferMu.Unlock()
+	ing.flushExpired(time.Now())
+	assertCuts(t, ing, writer, map[string]int64{CutReasonIdle: 1, CutReasonAge: 1})
+}
+
+func TestChunkLimits_Shutdown(t *testing.T) {
+	ing, writer := newTestIngestor(t, ChunkLimits{MaxBytes: 1 << 20, CheckInterval: time.Hour})
+	ing.Start()
+
+	ingestLines(t, ing, "buffered")
+	assertCuts(t, ing, writer, nil)
+
+	ing.Stop()
+	assertCuts(t, ing, writer, map[string]int64{CutReasonShutdown: 1})
+}
@@ -1,13 +1,17 @@
 package ingest
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/logpulse/backend/internal/index"
 	"github.com/logpulse/backend/internal/models"
 	"github.com/logpulse/backend/internal/storage"
+	"github.com/logpulse/backend/internal/wal"
 )
 
 // StreamBroadcaster interface for live log streaming
@@ -20,39 +24,80 @@ type Ingestor struct {
 	index       *index.Index
 	writer      *storage.Writer
 	broadcaster StreamBroadcaster
-	bufSize     int
+	wal         *wal.WAL
+	limits      ChunkLimits
+	capacity    CapacityChecker
 
-	// Buffer per label set
+	// Open head chunk per label set
 	buffers  map[string]*logBuffer
 	bufferMu sync.Mutex
 
+	// flushErr is the error of the last failed chunk write, nil once a
+	// write succeeds again
+	flushErr error
+
 	// Metrics
 	ingestedLines int64
 	ingestedBytes int64
+	chunkCuts     map[string]int64
 	metricsMu     sync.RWMutex
 
 	stopChan chan struct{}
 	wg       sync.WaitGroup
 }
 
+// logBuffer is the open head chunk of a stream. Entries are appended until
+// one of the chunk limits is reached and the chunk is cut to storage.
 type logBuffer struct {
 	labels  map[string]string
 	entries []models.LogEntry
 	size    int
+
+	createdAt  time.Time
+	lastAppend time.Time
+
+	// lastSeq is the WAL sequence number of the newest buffered entries
+	lastSeq uint64
+}
+
+// CapacityChecker reports whether storage can accept more data
+type CapacityChecker interface {
+	CheckCapacity() error
 }
 
 // NewIngestor creates a new log ingestor
-func NewIngestor(idx *index.Index, writer *storage.Writer, bufferSize int, broadcaster StreamBroadcaster) *Ingestor {
+func NewIngestor(idx *index.Index, writer *storage.Writer, limits ChunkLimits, broadcaster StreamBroadcaster) *Ingestor {
+	if limits.CheckInterval <= 0 {
+		limits.CheckInterval = 5 * time.Second
+	}
+
 	return &Ingestor{
 		index:       idx,
 		writer:      writer,
 		broadcaster: broadcaster,
-		bufSize:     bufferSize,
+		limits:      limits,
 		buffers:     make(map[string]*logBuffer),
+		chunkCuts:   make(map[string]int64),
 		stopChan:    make(chan struct{}),
 	}
 }
 
+// newBuffer opens a head chunk for a stream
+func newBuffer(labels map[string]string) *logBuffer {
+	now := time.Now()
+	return &logBuffer{
+		labels:     labels,
+		createdAt:  now,
+		lastAppend: now,
+	}
+}
+
+// SetCapacityChecker makes Ingest refuse data while c reports storage as
+// full
+func (ing *Ingestor) SetCapacityChecker(c CapacityChecker) {
+	ing.capacity = c
+}
+
 // Start begins the background flush worker
 func (ing *Ingestor) Start() {
 	ing.wg.Add(1)
@@ -64,10 +109,54 @@ func (ing *Ingestor) Stop() {
 	close(ing.stopChan)
 	ing.wg.Wait()
 	ing.flushAll()
+
+	if ing.wal != nil {
+		if err := ing.wal.Close(); err != nil {
+			log.Printf("Failed to close WAL: %v", err)
+		}
+	}
+}
+
+// ReplayWAL restores unflushed entries from the write-ahead log into the
+// buffers and logs all further ingestion to it. Call before Start.
+func (ing *Ingestor) ReplayWAL(w *wal.WAL) error {
+	ing.bufferMu.Lock()
+	defer ing.bufferMu.Unlock()
+
+	err := w.Replay(func(rec *wal.Record) error {
+		buf, exists := ing.buffers[rec.Stream]
+		if !exists {
+			buf = newBuffer(rec.Labels)
+			ing.buffers[rec.Stream] = buf
+		}
+
+		for _, entry := range rec.Entries {
+			buf.entries = append(buf.entries, models.LogEntry{
+				ID:        entry.ID,
+				Timestamp: time.Unix(0, entry.Timestamp),
+				Line:      entry.Line,
+				Labels:    rec.Labels,
+				Metadata:  entry.Metadata,
+			})
+			buf.size += len(entry.Line)
+		}
+		buf.lastSeq = rec.Seq
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ing.wal = w
+	return nil
 }
 
 // Ingest processes incoming log streams
 func (ing *Ingestor) Ingest(req *models.IngestRequest) (int, error) {
+	if err := ing.checkCapacity(); err != nil {
+		return 0, err
+	}
+
 	accepted := 0
 
 	for _, stream := range req.Streams {
@@ -78,31 +167,50 @@ func (ing *Ingestor) Ingest(req *models.IngestRequest) (int, error) {
 
 		labelHash := models.Labels(stream.Labels).Hash()
 
-		ing.bufferMu.Lock()
-		buf, exists := ing.buffers[labelHash]
-		if !exists {
-			buf = &logBuffer{
-				labels:  stream.Labels,
-				entries: make([]models.LogEntry, 0, ing.bufSize),
-			}
-			ing.buffers[labelHash] = buf
-		}
-
+		logEntries := make([]models.LogEntry, 0, len(stream.Entries))
 		for _, entry := range stream.Entries {
 			ts, err := time.Parse(time.RFC3339, entry.Ts)
 			if err != nil {
 				ts = time.Now()
 			}
 
-			logEntry := models.LogEntry{
+			logEntries = append(logEntries, models.LogEntry{
 				ID:        generateLogID(),
 				Timestamp: ts,
 				Line:      entry.Line,
 				Labels:    stream.Labels,
+				Metadata:  entry.Metadata,
+			})
+		}
+
+		ing.bufferMu.Lock()
+
+		// Log entries before they are buffered so a crash cannot lose them
+		var seq uint64
+		if ing.wal != nil {
+			var err error
+			seq, err = ing.wal.Append(labelHash, stream.Labels, toWALEntries(logEntries))
+			if err != nil {
+				ing.bufferMu.Unlock()
+				return accepted, err
 			}
+		}
+
+		buf, exists := ing.buffers[labelHash]
+		if !exists {
+			buf = newBuffer(stream.Labels)
+			ing.buffers[labelHash] = buf
+		}
+		if seq > 0 {
+			buf.lastSeq = seq
+		}
+		buf.lastAppend = time.Now()
+
+		for i := range logEntries {
+			logEntry := logEntries[i]
 
 			buf.entries = append(buf.entries, logEntry)
-			buf.size += len(entry.Line)
+			buf.size += len(logEntry.Line)
 			accepted++
 
 			// Broadcast to live stream subscribers
@@ -113,68 +221,119 @@ func (ing *Ingestor) Ingest(req *models.IngestRequest) (int, error) {
 			// Update metrics
 			ing.metricsMu.Lock()
 			ing.ingestedLines++
-			ing.ingestedBytes += int64(len(entry.Line))
+			ing.ingestedBytes += int64(len(logEntry.Line))
 			ing.metricsMu.Unlock()
 		}
 
-		// Flush if buffer is full
-		if len(buf.entries) >= ing.bufSize {
-			ing.flushBuffer(labelHash, buf)
-			ing.buffers[labelHash] = &logBuffer{
-				labels:  stream.Labels,
-				entries: make([]models.LogEntry, 0, ing.bufSize),
+		// Cut the head chunk once it is full
+		if reason := ing.limits.fullReason(buf); reason != "" {
+			if ing.flushBuffer(labelHash, buf, reason) {
+				delete(ing.buffers, labelHash)
 			}
 		}
 		ing.bufferMu.Unlock()
 	}
 
+	// Acknowledge only once the logged entries are durable
+	if ing.wal != nil {
+		if err := ing.wal.Sync(); err != nil {
+			return 0, err
+		}
+	}
+
 	return accepted, nil
 }
 
-// flushWorker periodically flushes buffers
+// checkCapacity refuses new data while storage is over its cap or chunk
+// writes fail for lack of disk space
+func (ing *Ingestor) checkCapacity() error {
+	if ing.capacity != nil {
+		if err := ing.capacity.CheckCapacity(); err != nil {
+			return err
+		}
+	}
+
+	ing.bufferMu.Lock()
+	flushErr := ing.flushErr
+	ing.bufferMu.Unlock()
+
+	if errors.Is(flushErr, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %v", storage.ErrStorageFull, flushErr)
+	}
+	return nil
+}
+
+// flushWorker periodically cuts head chunks that are too old or idle
 func (ing *Ingestor) flushWorker() {
 	defer ing.wg.Done()
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(ing.limits.CheckInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			ing.flushAll()
+		case now := <-ticker.C:
+			ing.flushExpired(now)
 		case <-ing.stopChan:
 			return
 		}
 	}
 }
 
-// flushAll flushes all buffers
+// flushExpired cuts head chunks that exceeded their age or idle limit
+func (ing *Ingestor) flushExpired(now time.Time) {
+	ing.bufferMu.Lock()
+	defer ing.bufferMu.Unlock()
+
+	for hash, buf := range ing.buffers {
+		if reason := ing.limits.expiredReason(buf, now); reason != "" {
+			if ing.flushBuffer(hash, buf, reason) {
+				delete(ing.buffers, hash)
+			}
+		}
+	}
+}
+
+// flushAll cuts every head chunk
 func (ing *Ingestor) flushAll() {
 	ing.bufferMu.Lock()
 	defer ing.bufferMu.Unlock()
 
 	for hash, buf := range ing.buffers {
-		if len(buf.entries) > 0 {
-			ing.flushBuffer(hash, buf)
-			buf.entries = buf.entries[:0]
-			buf.size = 0
+		if ing.flushBuffer(hash, buf, CutReasonShutdown) {
+			delete(ing.buffers, hash)
 		}
 	}
 }
 
-// flushBuffer writes a buffer to disk
-func (ing *Ingestor) flushBuffer(hash string, buf *logBuffer) {
+// flushBuffer writes a head chunk to disk and reports whether it succeeded.
+// Entries of a failed flush stay buffered and in the WAL.
+func (ing *Ingestor) flushBuffer(hash string, buf *logBuffer, reason string) bool {
 	if len(buf.entries) == 0 {
-		return
+		return true
 	}
 
 	chunkID, startTime, endTime, err := ing.writer.WriteChunk(buf.labels, buf.entries)
+	ing.flushErr = err
 	if err != nil {
 		log.Printf("Failed to write chunk: %v", err)
-		return
+		return false
 	}
 
 	ing.index.AddChunk(chunkID, buf.labels, startTime, endTime, len(buf.entries))
-	log.Printf("Flushed chunk %s with %d entries", chunkID, len(buf.entries))
+	log.Printf("Flushed chunk %s with %d entries (%d bytes, cut by %s)", chunkID, len(buf.entries), buf.size, reason)
+
+	ing.metricsMu.Lock()
+	ing.chunkCuts[reason]++
+	ing.metricsMu.Unlock()
+
+	// Checkpoint the WAL now that the entries are in a chunk
+	if ing.wal != nil && buf.lastSeq > 0 {
+		if err := ing.wal.MarkFlushed(hash, buf.lastSeq); err != nil {
+			log.Printf("Failed to checkpoint WAL for stream %s: %v", hash, err)
+		}
+	}
+
+	return true
 }
 
 // GetMetrics returns ingestion metrics
@@ -184,6 +343,20 @@ func (ing *Ingestor) GetMetrics() (lines int64, bytes int64) {
 	return ing.ingestedLines, ing.ingestedBytes
 }
 
+// toWALEntries converts log entries to their WAL form
+func toWALEntries(entries []models.LogEntry) []wal.Entry {
+	walEntries := make([]wal.Entry, len(entries))
+	for i, entry := range entries {
+		walEntries[i] = wal.Entry{
+			ID:        entry.ID,
+			Timestamp: entry.Timestamp.UnixNano(),
+			Line:      entry.Line,
+			Metadata:  entry.Metadata,
+		}
+	}
+	return walEntries
+}
+
 // generateLogID creates a unique log ID
 func generateLogID() string {
 	return time.Now().Format("20060102150405.000000000")
@@ -0,0 +1,160 @@
+package ingest
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/storage"
+	"github.com/logpulse/backend/internal/wal"
+)
+
+// openWALIngestor opens the WAL in walDir and replays it into a new
+// ingestor writing chunks to chunkDir
+func openWALIngestor(t *testing.T, walDir, chunkDir string, limits ChunkLimits, opts wal.Options) (*Ingestor, *storage.Writer) {
+	t.Helper()
+	w, err := wal.Open(walDir, opts)
+	if err != nil {
+		t.Fatalf("open wal failed: %v", err)
+	}
+	writer := storage.NewWriter(chunkDir, 0, storage.CompressionSnappy)
+	ing := NewIngestor(index.NewIndex(), writer, limits, nil)
+	if err := ing.ReplayWAL(w); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	return ing, writer
+}
+
+// crash drops the ingestor's head chunks without flushing them
+func crash(t *testing.T, ing *Ingestor) {
+	t.Helper()
+	if err := ing.wal.Close(); err != nil {
+		t.Fatalf("close wal failed: %v", err)
+	}
+}
+
+// storedLines returns the lines of every chunk in chunkDir, sorted. The
+// chunks are those of the stream ingestLines writes to.
+func storedLines(t *testing.T, chunkDir string) []string {
+	t.Helper()
+	objects, err := storage.NewFSStore(chunkDir).List("")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	reader := storage.NewReader(chunkDir)
+	var lines []string
+	for _, obj := range objects {
+		if path.Ext(obj.Key) != ".log" {
+			continue
+		}
+		chunkID := strings.TrimSuffix(path.Base(obj.Key), ".log")
+		entries, err := reader.ReadChunk(map[string]string{"app": "nginx"}, chunkID)
+		if err != nil {
+			t.Fatalf("read chunk %s failed: %v", chunkID, err)
+		}
+		for _, entry := range entries {
+			lines = append(lines, entry.Line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestReplayWAL_RestoresUnflushedEntries(t *testing.T) {
+	walDir, chunkDir := t.TempDir(), t.TempDir()
+	limits := ChunkLimits{MaxBytes: 1 << 20}
+
+	ing, writer := openWALIngestor(t, walDir, chunkDir, limits, wal.Options{})
+	ingestLines(t, ing, "one", "two")
+	ingestLines(t, ing, "three")
+	crash(t, ing)
+	if got := writer.GetChunkCount(); got != 0 {
+		t.Fatalf("expected no chunks before the restart, got %d", got)
+	}
+
+	ing, writer = openWALIngestor(t, walDir, chunkDir, limits, wal.Options{})
+	if metrics := ing.GetChunkMetrics(); metrics.HeadChunks != 1 || metrics.HeadBytes != int64(len("onetwothree")) {
+		t.Fatalf("expected the replayed entries in one head chunk, got %+v", metrics)
+	}
+	ing.Stop()
+
+	if got := writer.GetChunkCount(); got != 1 {
+		t.Fatalf("expected 1 chunk, got %d", got)
+	}
+	if lines := storedLines(t, chunkDir); !slices.Equal(lines, []string{"one", "three", "two"}) {
+		t.Fatalf("expected the ingested lines to be stored, got %v", lines)
+	}
+}
+
+func TestReplayWAL_SkipsFlushedEntries(t *testing.T) {
+	walDir, chunkDir := t.TempDir(), t.TempDir()
+	limits := ChunkLimits{MaxBytes: 1 << 20, MaxEntries: 4}
+	opts := wal.Options{SegmentSize: 256}
+
+	// Small segments make every ingest roll to a new one
+	ing, writer := openWALIngestor(t, walDir, chunkDir, limits, opts)
+	ingestLines(t, ing, "one", "two")
+	ingestLines(t, ing, "three", "four")
+	ingestLines(t, ing, "five")
+	crash(t, ing)
+	if got := writer.GetChunkCount(); got != 1 {
+		t.Fatalf("expected 1 chunk cut by entries, got %d", got)
+	}
+
+	// Segments holding only the flushed entries are gone
+	segments, err := filepath.Glob(filepath.Join(walDir, "*.wal"))
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("expected 1 segment left, got %v, %v", segments, err)
+	}
+
+	ing, writer = openWALIngestor(t, walDir, chunkDir, limits, opts)
+	if metrics := ing.GetChunkMetrics(); metrics.HeadChunks != 1 || metrics.HeadBytes != int64(len("five")) {
+		t.Fatalf("expected only the unflushed entry replayed, got %+v", metrics)
+	}
+	ing.Stop()
+	if got := writer.GetChunkCount(); got != 2 {
+		t.Fatalf("expected 2 chunks, got %d", got)
+	}
+
+	// A second restart has nothing left to replay
+	ing, _ = openWALIngestor(t, walDir, chunkDir, limits, opts)
+	if metrics := ing.GetChunkMetrics(); metrics.HeadChunks != 0 {
+		t.Fatalf("expected nothing replayed after a clean shutdown, got %+v", metrics)
+	}
+	ing.Stop()
+	if lines := storedLines(t, chunkDir); !slices.Equal(lines, []string{"five", "four", "one", "three", "two"}) {
+		t.Fatalf("expected every line stored once, got %v", lines)
+	}
+}
+
+func TestIngest_FailsOnWALAppendError(t *testing.T) {
+	ing, writer := openWALIngestor(t, t.TempDir(), t.TempDir(), ChunkLimits{MaxBytes: 1 << 20}, wal.Options{})
+	crash(t, ing)
+
+	stream := models.Stream{
+		Labels:  map[string]string{"app": "nginx"},
+		Entries: []models.Entry{{Ts: "2024-01-15T10:00:00Z", Line: "lost"}},
+	}
+	accepted, err := ing.Ingest(&models.IngestRequest{Streams: []models.Stream{stream}})
+	if !errors.Is(err, wal.ErrClosed) || accepted != 0 {
+		t.Fatalf("expected the wal error and nothing accepted, got %d, %v", accepted, err)
+	}
+
+	// Entries that were not logged are not buffered either
+	if metrics := ing.GetChunkMetrics(); metrics.HeadChunks != 0 {
+		t.Fatalf("expected no head chunk, got %+v", metrics)
+	}
+	if lines, _ := ing.GetMetrics(); lines != 0 {
+		t.Fatalf("expected no ingested lines, got %d", lines)
+	}
+	ing.flushAll()
+	if got := writer.GetChunkCount(); got != 0 {
+		t.Fatalf("expected no chunks, got %d", got)
+	}
+}
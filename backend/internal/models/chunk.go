@@ -20,4 +20,7 @@ type ChunkMeta struct {
 	StartTime  int64             `json:"start_time"` // Unix timestamp
 	EndTime    int64             `json:"end_time"`
 	EntryCount int               `json:"entry_count"`
+	Tier       string            `json:"tier,omitempty"`     // storage tier, empty for hot
+	Size       int64             `json:"size,omitempty"`     // bytes of chunk data
+	Checksum   string            `json:"checksum,omitempty"` // crc32c of chunk data, hex
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -18,11 +19,12 @@ func (l Labels) Hash() string {
 	}
 	sort.Strings(keys)
 
+	// Quoting keeps names and values containing separators unambiguous
 	var sb strings.Builder
 	for _, k := range keys {
-		sb.WriteString(k)
+		sb.WriteString(strconv.Quote(k))
 		sb.WriteString("=")
-		sb.WriteString(l[k])
+		sb.WriteString(strconv.Quote(l[k]))
 		sb.WriteString(",")
 	}
 
@@ -30,20 +32,10 @@ func (l Labels) Hash() string {
 	return hex.EncodeToString(hash[:8])
 }
 
-// ToPath converts labels to a directory path
+// ToPath returns the directory holding a label set's chunks. It is the
+// label hash, so label values never end up in file names.
 func (l Labels) ToPath() string {
-	keys := make([]string, 0, len(l))
-	for k := range l {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	parts := make([]string, 0, len(l))
-	for _, k := range keys {
-		parts = append(parts, k+"="+l[k])
-	}
-
-	return strings.Join(parts, "_")
+	return l.Hash()
 }
 
 // Match checks if labels match a query
@@ -8,6 +8,7 @@ type LogEntry struct {
 	Timestamp time.Time         `json:"timestamp"`
 	Line      string            `json:"message"`
 	Labels    map[string]string `json:"labels"`
+	Metadata  map[string]string `json:"metadata,omitempty"` // per-entry attributes that are not labels
 }
 
 // IngestRequest is the incoming log payload
@@ -21,8 +22,9 @@ type Stream struct {
 }
 
 type Entry struct {
-	Ts   string `json:"ts"`
-	Line string `json:"line"`
+	Ts       string            `json:"ts"`
+	Line     string            `json:"line"`
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // IngestResponse confirms ingestion
@@ -0,0 +1,147 @@
+// Package protowire reads and writes the Protocol Buffers wire format,
+// enough to handle the push APIs of log shippers without generated code.
+// See https://protobuf.dev/programming-guides/encoding/
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	ErrTruncated = errors.New("protowire: truncated message")
+	ErrInvalid   = errors.New("protowire: invalid message")
+)
+
+// Type is the wire type of a field
+type Type int
+
+const (
+	Varint  Type = 0
+	Fixed64 Type = 1
+	Bytes   Type = 2
+	Fixed32 Type = 5
+)
+
+// Decoder reads the fields of a message in order
+type Decoder struct {
+	buf []byte
+}
+
+// NewDecoder creates a decoder for an encoded message
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+// Done reports whether every field has been read
+func (d *Decoder) Done() bool {
+	return len(d.buf) == 0
+}
+
+// Field reads the tag of the next field. Its value must be read with the
+// method for its type or skipped.
+func (d *Decoder) Field() (int, Type, error) {
+	tag, err := d.Varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	num, typ := tag>>3, Type(tag&7)
+	if num == 0 || num > math.MaxInt32 {
+		return 0, 0, ErrInvalid
+	}
+	return int(num), typ, nil
+}
+
+// Varint reads a varint value
+func (d *Decoder) Varint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf)
+	if n == 0 {
+		return 0, ErrTruncated
+	}
+	if n < 0 {
+		return 0, ErrInvalid
+	}
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+// Fixed64 reads a little endian 64-bit value
+func (d *Decoder) Fixed64() (uint64, error) {
+	if len(d.buf) < 8 {
+		return 0, ErrTruncated
+	}
+	v := binary.LittleEndian.Uint64(d.buf)
+	d.buf = d.buf[8:]
+	return v, nil
+}
+
+// Fixed32 reads a little endian 32-bit value
+func (d *Decoder) Fixed32() (uint32, error) {
+	if len(d.buf) < 4 {
+		return 0, ErrTruncated
+	}
+	v := binary.LittleEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	return v, nil
+}
+
+// Bytes reads a length-delimited value: a string, bytes or an embedded
+// message. The result aliases the decoder's buffer.
+func (d *Decoder) Bytes() ([]byte, error) {
+	n, err := d.Varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.buf)) {
+		return nil, ErrTruncated
+	}
+	v := d.buf[:n]
+	d.buf = d.buf[n:]
+	return v, nil
+}
+
+// Skip discards the value of a field of type typ
+func (d *Decoder) Skip(typ Type) error {
+	var err error
+	switch typ {
+	case Varint:
+		_, err = d.Varint()
+	case Fixed64:
+		_, err = d.Fixed64()
+	case Bytes:
+		_, err = d.Bytes()
+	case Fixed32:
+		_, err = d.Fixed32()
+	default:
+		// Groups are deprecated and not used by any supported message
+		err = ErrInvalid
+	}
+	return err
+}
+
+// AppendTag appends a field tag
+func AppendTag(b []byte, num int, typ Type) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// AppendVarint appends a varint field
+func AppendVarint(b []byte, num int, v uint64) []byte {
+	return binary.AppendUvarint(AppendTag(b, num, Varint), v)
+}
+
+// AppendFixed64 appends a little endian 64-bit field
+func AppendFixed64(b []byte, num int, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(AppendTag(b, num, Fixed64), v)
+}
+
+// AppendBytes appends a length-delimited field
+func AppendBytes(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(AppendTag(b, num, Bytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+// AppendString appends a string field
+func AppendString(b []byte, num int, v string) []byte {
+	return AppendBytes(b, num, []byte(v))
+}
@@ -0,0 +1,198 @@
+package push
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+)
+
+// Bulk actions that carry a document
+const (
+	BulkIndex  = "index"
+	BulkCreate = "create"
+)
+
+// BulkItem is one action of an Elasticsearch bulk request. Items that could
+// not be turned into an entry have Err set.
+type BulkItem struct {
+	Action string
+	Index  string
+	ID     string
+	Labels map[string]string
+	Entry  models.Entry
+	Err    error
+}
+
+// ErrBulkUnsupported is set on update and delete actions, which have
+// nothing to act on in an append-only log store
+var ErrBulkUnsupported = errors.New("only index and create actions are supported")
+
+// ESBulkDecoder decodes Elasticsearch bulk requests. The index name and the
+// configured document fields become stream labels; the message field is
+// the line and other fields are kept as entry metadata.
+type ESBulkDecoder struct {
+	labelFields []string
+}
+
+// NewESBulkDecoder creates a decoder that turns the given fields, by
+// dotted path such as host.name, into labels with sanitized names
+func NewESBulkDecoder(labelFields []string) *ESBulkDecoder {
+	return &ESBulkDecoder{labelFields: labelFields}
+}
+
+// Decode parses an NDJSON bulk body. defaultIndex applies to actions that
+// name no index, as for POST /{index}/_bulk. An error is returned only for
+// a malformed action line, which fails the whole request.
+func (d *ESBulkDecoder) Decode(body []byte, defaultIndex string, now time.Time) ([]BulkItem, error) {
+	var items []BulkItem
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return nil, fmt.Errorf("malformed action/metadata line [%d], expected a single action", len(items)+1)
+		}
+
+		var item BulkItem
+		for name, meta := range action {
+			item = BulkItem{Action: name, Index: meta.Index, ID: meta.ID}
+		}
+		if item.Index == "" {
+			item.Index = defaultIndex
+		}
+
+		switch item.Action {
+		case BulkIndex, BulkCreate:
+		case "update":
+			scanner.Scan() // the partial document
+			item.Err = ErrBulkUnsupported
+			items = append(items, item)
+			continue
+		case "delete":
+			item.Err = ErrBulkUnsupported
+			items = append(items, item)
+			continue
+		default:
+			return nil, fmt.Errorf("malformed action/metadata line [%d], unknown action [%s]", len(items)+1, item.Action)
+		}
+
+		if !scanner.Scan() {
+			return nil, errors.New("the bulk request must be terminated by a newline")
+		}
+		if item.Index == "" {
+			item.Err = errors.New("index is missing")
+		} else {
+			item.Labels, item.Entry, item.Err = d.translate(scanner.Bytes(), item.Index, now)
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// translate converts a document source into the labels and entry it is
+// stored as
+func (d *ESBulkDecoder) translate(source []byte, index string, now time.Time) (map[string]string, models.Entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(source))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, models.Entry{}, fmt.Errorf("failed to parse document: %w", err)
+	}
+
+	fields := make(map[string]string)
+	flatten("", doc, fields)
+
+	labels := map[string]string{"index": index}
+	for _, name := range d.labelFields {
+		if v, ok := fields[name]; ok && v != "" {
+			labels[SanitizeLabelName(name)] = v
+			delete(fields, name)
+		}
+	}
+
+	ts := now
+	if v, ok := fields["@timestamp"]; ok {
+		parsed, err := parseESTimestamp(v)
+		if err != nil {
+			return nil, models.Entry{}, fmt.Errorf("failed to parse field [@timestamp] with value [%s]", v)
+		}
+		ts = parsed
+		delete(fields, "@timestamp")
+	}
+
+	var line string
+	if v, ok := fields["message"]; ok {
+		line = v
+		delete(fields, "message")
+	} else {
+		// Without a message the document itself is the line
+		line = string(bytes.TrimSpace(source))
+		fields = nil
+	}
+
+	var metadata map[string]string
+	for name, v := range fields {
+		if metadata == nil {
+			metadata = make(map[string]string, len(fields))
+		}
+		metadata[SanitizeLabelName(name)] = v
+	}
+
+	return labels, models.Entry{Ts: formatTimestamp(ts), Line: line, Metadata: metadata}, nil
+}
+
+// flatten renders the fields of a document by dotted path. Arrays are
+// rendered as JSON and nulls are dropped.
+func flatten(prefix string, doc map[string]any, fields map[string]string) {
+	for name, v := range doc {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(name, v, fields)
+		case string:
+			fields[name] = v
+		case json.Number:
+			fields[name] = v.String()
+		case bool:
+			fields[name] = strconv.FormatBool(v)
+		case nil:
+		default:
+			data, _ := json.Marshal(v)
+			fields[name] = string(data)
+		}
+	}
+}
+
+// parseESTimestamp parses a date in Elasticsearch's default format, an
+// ISO 8601 date with optional time or milliseconds since the epoch
+func parseESTimestamp(s string) (time.Time, error) {
+	if millis, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		if ts, err := time.Parse(layout, s); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
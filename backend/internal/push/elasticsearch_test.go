@@ -0,0 +1,65 @@
+package push
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestESBulkDecoder(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	body := `{"index":{"_index":"app-logs","_id":"1"}}
+{"@timestamp":"2024-01-15T10:00:00.123Z","message":"user signed in","host":{"name":"web-1"},"log.level":"info","user":{"id":42,"roles":["admin"]},"trace":null}
+{"create":{}}
+{"@timestamp":1705312800000,"event":"no message"}
+{"delete":{"_index":"app-logs","_id":"1"}}
+{"update":{"_index":"app-logs","_id":"1"}}
+{"doc":{"message":"changed"}}
+{"index":{"_index":"app-logs"}}
+{"@timestamp":"yesterday","message":"bad time"}
+`
+
+	items, err := NewESBulkDecoder([]string{"host.name", "log.level"}).Decode([]byte(body), "default-index", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != 5 {
+		t.Fatalf("expected 5 items, got %d", len(items))
+	}
+
+	first := items[0]
+	if first.Err != nil || first.Action != BulkIndex || first.ID != "1" {
+		t.Fatalf("unexpected first item %+v", first)
+	}
+	if len(first.Labels) != 3 || first.Labels["index"] != "app-logs" || first.Labels["host_name"] != "web-1" || first.Labels["log_level"] != "info" {
+		t.Errorf("unexpected labels %v", first.Labels)
+	}
+	if first.Entry.Ts != "2024-01-15T10:00:00.123Z" || first.Entry.Line != "user signed in" {
+		t.Errorf("unexpected entry %+v", first.Entry)
+	}
+	if len(first.Entry.Metadata) != 2 || first.Entry.Metadata["user_id"] != "42" || first.Entry.Metadata["user_roles"] != `["admin"]` {
+		t.Errorf("unexpected metadata %v", first.Entry.Metadata)
+	}
+
+	second := items[1]
+	if second.Err != nil || second.Labels["index"] != "default-index" {
+		t.Fatalf("unexpected second item %+v", second)
+	}
+	if second.Entry.Ts != "2024-01-15T10:00:00Z" || second.Entry.Line != `{"@timestamp":1705312800000,"event":"no message"}` {
+		t.Errorf("unexpected entry %+v", second.Entry)
+	}
+
+	if !errors.Is(items[2].Err, ErrBulkUnsupported) || !errors.Is(items[3].Err, ErrBulkUnsupported) {
+		t.Errorf("expected delete and update to be unsupported, got %v and %v", items[2].Err, items[3].Err)
+	}
+	if items[4].Err == nil {
+		t.Error("expected an error for an invalid @timestamp")
+	}
+
+	if _, err := NewESBulkDecoder(nil).Decode([]byte("{\"index\":{}}\n"), "x", now); err == nil {
+		t.Error("expected an error for an action without a document")
+	}
+	if _, err := NewESBulkDecoder(nil).Decode([]byte("not json\n"), "x", now); err == nil {
+		t.Error("expected an error for a malformed action")
+	}
+}
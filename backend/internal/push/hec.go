@@ -0,0 +1,252 @@
+package push
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+)
+
+// Splunk HTTP Event Collector errors, worded as HEC reports them
+var (
+	ErrHECNoData        = errors.New("No data")
+	ErrHECInvalidFormat = errors.New("Invalid data format")
+	ErrHECEventRequired = errors.New("Event field is required")
+	ErrHECEventBlank    = errors.New("Event field cannot be blank")
+)
+
+// HECEventError reports the event of a request that failed to decode
+type HECEventError struct {
+	Event int // position of the event in the request, from 0
+	Err   error
+}
+
+func (e *HECEventError) Error() string {
+	return fmt.Sprintf("event %d: %v", e.Event, e.Err)
+}
+
+func (e *HECEventError) Unwrap() error {
+	return e.Err
+}
+
+// HECDefaults holds the metadata of events that do not set their own,
+// taken from the query string
+type HECDefaults struct {
+	Host       string
+	Source     string
+	SourceType string
+	Index      string
+	Time       time.Time // zero for the time of the request
+}
+
+// hecEvent is an event sent to the event endpoint
+type hecEvent struct {
+	Time       json.RawMessage `json:"time"`
+	Host       string          `json:"host"`
+	Source     string          `json:"source"`
+	SourceType string          `json:"sourcetype"`
+	Index      string          `json:"index"`
+	Event      json.RawMessage `json:"event"`
+	Fields     map[string]any  `json:"fields"`
+}
+
+// DecodeHECEvents decodes a request to the HEC event endpoint: one or more
+// JSON events, concatenated or on separate lines. host, source, sourcetype
+// and index become labels and indexed fields are kept as entry metadata.
+func DecodeHECEvents(body []byte, defaults HECDefaults, now time.Time) (*models.IngestRequest, error) {
+	var set streamSet
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	for n := 0; ; n++ {
+		var event hecEvent
+		err := dec.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			if n == 0 {
+				return nil, ErrHECNoData
+			}
+			break
+		}
+		if err != nil {
+			return nil, &HECEventError{Event: n, Err: ErrHECInvalidFormat}
+		}
+
+		line, err := hecEventLine(event.Event)
+		if err != nil {
+			return nil, &HECEventError{Event: n, Err: err}
+		}
+		ts, err := hecTime(event.Time, defaults, now)
+		if err != nil {
+			return nil, &HECEventError{Event: n, Err: ErrHECInvalidFormat}
+		}
+
+		var metadata map[string]string
+		for name, v := range event.Fields {
+			if metadata == nil {
+				metadata = make(map[string]string, len(event.Fields))
+			}
+			metadata[SanitizeLabelName(name)] = hecFieldValue(v)
+		}
+
+		labels := hecLabels(HECDefaults{
+			Host:       firstNonEmpty(event.Host, defaults.Host),
+			Source:     firstNonEmpty(event.Source, defaults.Source),
+			SourceType: firstNonEmpty(event.SourceType, defaults.SourceType),
+			Index:      firstNonEmpty(event.Index, defaults.Index),
+		})
+		set.add(labels, models.Entry{Ts: formatTimestamp(ts), Line: line, Metadata: metadata})
+	}
+	return &models.IngestRequest{Streams: set.streams}, nil
+}
+
+// DecodeHECRaw decodes a request to the HEC raw endpoint, where every line
+// of the body is an event with the metadata of the query string
+func DecodeHECRaw(body []byte, defaults HECDefaults, now time.Time) (*models.IngestRequest, error) {
+	ts := now
+	if !defaults.Time.IsZero() {
+		ts = defaults.Time
+	}
+	labels := hecLabels(defaults)
+
+	var set streamSet
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		set.add(labels, models.Entry{Ts: formatTimestamp(ts), Line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(set.streams) == 0 {
+		return nil, ErrHECNoData
+	}
+	return &models.IngestRequest{Streams: set.streams}, nil
+}
+
+// ParseHECTime parses a time in Unix seconds with an optional fraction,
+// as HEC clients send it
+func ParseHECTime(s string) (time.Time, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	secs, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	var nanos int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		if nanos, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", s)
+		}
+	}
+	return time.Unix(secs, nanos), nil
+}
+
+// hecLabels returns the labels of events with the given metadata
+func hecLabels(meta HECDefaults) map[string]string {
+	labels := make(map[string]string, 4)
+	for name, v := range map[string]string{
+		"host":       meta.Host,
+		"source":     meta.Source,
+		"sourcetype": meta.SourceType,
+		"index":      meta.Index,
+	} {
+		if v != "" {
+			labels[name] = v
+		}
+	}
+	return labels
+}
+
+// hecEventLine renders the event field: strings as they are, anything
+// else as JSON
+func hecEventLine(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", ErrHECEventRequired
+	}
+	if raw[0] != '"' {
+		if string(raw) == "null" {
+			return "", ErrHECEventBlank
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return "", ErrHECInvalidFormat
+		}
+		return compact.String(), nil
+	}
+
+	var line string
+	if err := json.Unmarshal(raw, &line); err != nil {
+		return "", ErrHECInvalidFormat
+	}
+	if line == "" {
+		return "", ErrHECEventBlank
+	}
+	return line, nil
+}
+
+// hecTime returns the time of an event, given as a number or string of
+// Unix seconds
+func hecTime(raw json.RawMessage, defaults HECDefaults, now time.Time) (time.Time, error) {
+	s := string(bytes.Trim(raw, `" `))
+	if s == "" || s == "null" {
+		if !defaults.Time.IsZero() {
+			return defaults.Time, nil
+		}
+		return now, nil
+	}
+	return ParseHECTime(s)
+}
+
+// hecFieldValue renders an indexed field value
+func hecFieldValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// streamSet groups entries into streams by label set, in order of first
+// appearance
+type streamSet struct {
+	streams []models.Stream
+	byHash  map[string]int
+}
+
+func (s *streamSet) add(labels map[string]string, entry models.Entry) {
+	if s.byHash == nil {
+		s.byHash = make(map[string]int)
+	}
+	hash := models.Labels(labels).Hash()
+	pos, ok := s.byHash[hash]
+	if !ok {
+		pos = len(s.streams)
+		s.byHash[hash] = pos
+		s.streams = append(s.streams, models.Stream{Labels: labels})
+	}
+	s.streams[pos].Entries = append(s.streams[pos].Entries, entry)
+}
@@ -0,0 +1,107 @@
+package push
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+)
+
+func TestDecodeHECEvents(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	defaults := HECDefaults{Host: "10.0.0.1", Index: "main"}
+	body := `{"time":1705312800.123,"host":"web-1","source":"/var/log/app.log","sourcetype":"app","event":"user signed in","fields":{"region":"eu","code":42}}` +
+		`{"time":"1705312801","host":"web-1","source":"/var/log/app.log","sourcetype":"app","event":{"user":"bob","action":"logout"}}
+{"index":"audit","event":"no time"}`
+
+	req, err := DecodeHECEvents([]byte(body), defaults, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(req.Streams) != 2 {
+		t.Fatalf("expected 2 streams, got %+v", req.Streams)
+	}
+
+	app := req.Streams[0]
+	want := map[string]string{"host": "web-1", "source": "/var/log/app.log", "sourcetype": "app", "index": "main"}
+	if models.Labels(app.Labels).Hash() != models.Labels(want).Hash() {
+		t.Errorf("expected labels %v, got %v", want, app.Labels)
+	}
+	if len(app.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", app.Entries)
+	}
+	first := app.Entries[0]
+	if first.Ts != "2024-01-15T10:00:00.123Z" || first.Line != "user signed in" {
+		t.Errorf("unexpected entry %+v", first)
+	}
+	if len(first.Metadata) != 2 || first.Metadata["region"] != "eu" || first.Metadata["code"] != "42" {
+		t.Errorf("unexpected metadata %v", first.Metadata)
+	}
+	if second := app.Entries[1]; second.Ts != "2024-01-15T10:00:01Z" || second.Line != `{"user":"bob","action":"logout"}` {
+		t.Errorf("unexpected entry %+v", second)
+	}
+
+	audit := req.Streams[1]
+	if len(audit.Labels) != 2 || audit.Labels["host"] != "10.0.0.1" || audit.Labels["index"] != "audit" {
+		t.Errorf("unexpected labels %v", audit.Labels)
+	}
+	if audit.Entries[0].Ts != "2024-01-15T12:00:00Z" {
+		t.Errorf("expected the request time, got %s", audit.Entries[0].Ts)
+	}
+}
+
+func TestDecodeHECEvents_Errors(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		body  string
+		err   error
+		event int
+	}{
+		{"", ErrHECNoData, -1},
+		{`{"event":"ok"} {"time":1}`, ErrHECEventRequired, 1},
+		{`{"event":""}`, ErrHECEventBlank, 0},
+		{`{"event":"ok"} {"event":`, ErrHECInvalidFormat, 1},
+		{`{"event":"ok","time":"yesterday"}`, ErrHECInvalidFormat, 0},
+	}
+	for _, tt := range tests {
+		_, err := DecodeHECEvents([]byte(tt.body), HECDefaults{}, now)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q: expected %v, got %v", tt.body, tt.err, err)
+			continue
+		}
+		var eventErr *HECEventError
+		if errors.As(err, &eventErr) != (tt.event >= 0) || (eventErr != nil && eventErr.Event != tt.event) {
+			t.Errorf("%q: expected event %d, got %v", tt.body, tt.event, err)
+		}
+	}
+}
+
+func TestDecodeHECRaw(t *testing.T) {
+	defaults := HECDefaults{SourceType: "syslog", Index: "main", Time: time.Unix(1705312800, 0)}
+	req, err := DecodeHECRaw([]byte("first line\r\n\nsecond line\n"), defaults, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(req.Streams) != 1 || len(req.Streams[0].Labels) != 2 || req.Streams[0].Labels["sourcetype"] != "syslog" {
+		t.Fatalf("unexpected streams %+v", req.Streams)
+	}
+	entries := req.Streams[0].Entries
+	if len(entries) != 2 || entries[0].Line != "first line" || entries[1].Line != "second line" || entries[0].Ts != "2024-01-15T10:00:00Z" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+
+	if _, err := DecodeHECRaw([]byte("\n \n"), defaults, time.Now()); !errors.Is(err, ErrHECNoData) {
+		t.Errorf("expected no data, got %v", err)
+	}
+}
+
+func TestParseHECTime(t *testing.T) {
+	ts, err := ParseHECTime("1705312800.5")
+	if err != nil || !ts.Equal(time.Unix(1705312800, 500_000_000)) {
+		t.Errorf("unexpected time %v, %v", ts, err)
+	}
+	if _, err := ParseHECTime("1705312800.x"); err == nil {
+		t.Error("expected an error for an invalid fraction")
+	}
+}
@@ -0,0 +1,256 @@
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/protowire"
+	"github.com/logpulse/backend/internal/snappy"
+)
+
+// ErrNoLabels is returned for a Loki stream without labels
+var ErrNoLabels = errors.New("error at least one label pair is required per stream")
+
+// ErrDecodedTooLarge is returned for a compressed body that would
+// decompress to more than the allowed size
+var ErrDecodedTooLarge = errors.New("decompressed push request too large")
+
+// lokiJSONRequest is the JSON body of a Loki push request
+type lokiJSONRequest struct {
+	Streams []struct {
+		Stream map[string]string   `json:"stream"`
+		Values [][]json.RawMessage `json:"values"`
+	} `json:"streams"`
+}
+
+// DecodeLokiJSON decodes a Loki push request in JSON. Each value is a
+// [timestamp in Unix nanoseconds, line] pair, optionally followed by
+// structured metadata, which is ignored.
+func DecodeLokiJSON(body []byte) (*models.IngestRequest, error) {
+	var push lokiJSONRequest
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, fmt.Errorf("error parsing JSON push request: %w", err)
+	}
+
+	req := &models.IngestRequest{}
+	for _, s := range push.Streams {
+		if len(s.Stream) == 0 {
+			return nil, ErrNoLabels
+		}
+
+		stream := models.Stream{Labels: s.Stream, Entries: make([]models.Entry, 0, len(s.Values))}
+		for _, value := range s.Values {
+			if len(value) < 2 || len(value) > 3 {
+				return nil, fmt.Errorf("error parsing values of stream %s: want [timestamp, line]", FormatLabels(s.Stream))
+			}
+			var tsStr, line string
+			if err := json.Unmarshal(value[0], &tsStr); err != nil {
+				return nil, fmt.Errorf("error parsing timestamp of stream %s: %w", FormatLabels(s.Stream), err)
+			}
+			if err := json.Unmarshal(value[1], &line); err != nil {
+				return nil, fmt.Errorf("error parsing line of stream %s: %w", FormatLabels(s.Stream), err)
+			}
+			ns, err := strconv.ParseInt(tsStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing timestamp %q of stream %s", tsStr, FormatLabels(s.Stream))
+			}
+			stream.Entries = append(stream.Entries, models.Entry{Ts: formatTimestamp(time.Unix(0, ns)), Line: line})
+		}
+		req.Streams = appendStream(req.Streams, stream)
+	}
+	return req, nil
+}
+
+// DecodeLokiProtobuf decodes a snappy compressed logproto.PushRequest, as
+// sent by Promtail, Grafana Alloy and the Docker driver. Bodies that would
+// decompress to more than maxSize bytes are rejected before decoding.
+func DecodeLokiProtobuf(body []byte, maxSize int) (*models.IngestRequest, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing push request: %w", err)
+	}
+	if size > maxSize {
+		return nil, ErrDecodedTooLarge
+	}
+
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing push request: %w", err)
+	}
+
+	req := &models.IngestRequest{}
+	err = decodeMessage(data, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		if num != 1 || typ != protowire.Bytes {
+			return false, nil
+		}
+		msg, err := d.Bytes()
+		if err != nil {
+			return true, err
+		}
+		stream, err := decodeLokiStream(msg)
+		if err != nil {
+			return true, err
+		}
+		req.Streams = appendStream(req.Streams, stream)
+		return true, nil
+	})
+	if err != nil {
+		return nil, protoError(err)
+	}
+	return req, nil
+}
+
+// decodeLokiStream decodes a logproto.StreamAdapter
+func decodeLokiStream(msg []byte) (models.Stream, error) {
+	var stream models.Stream
+	var labels string
+
+	err := decodeMessage(msg, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		if typ != protowire.Bytes || (num != 1 && num != 2) {
+			return false, nil
+		}
+		b, err := d.Bytes()
+		if err != nil {
+			return true, err
+		}
+		if num == 1 {
+			labels = string(b)
+			return true, nil
+		}
+		entry, err := decodeLokiEntry(b)
+		if err != nil {
+			return true, err
+		}
+		stream.Entries = append(stream.Entries, entry)
+		return true, nil
+	})
+	if err != nil {
+		return stream, err
+	}
+
+	parsed, err := ParseLabels(labels)
+	if err != nil {
+		return stream, fmt.Errorf("error parsing labels %s: %w", labels, err)
+	}
+	if len(parsed) == 0 {
+		return stream, ErrNoLabels
+	}
+	stream.Labels = parsed
+	return stream, nil
+}
+
+// decodeLokiEntry decodes a logproto.EntryAdapter. Structured metadata is
+// ignored.
+func decodeLokiEntry(msg []byte) (models.Entry, error) {
+	var entry models.Entry
+	var ts time.Time
+
+	err := decodeMessage(msg, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		if typ != protowire.Bytes || (num != 1 && num != 2) {
+			return false, nil
+		}
+		b, err := d.Bytes()
+		if err != nil {
+			return true, err
+		}
+		if num == 1 {
+			ts, err = decodeTimestamp(b)
+			return true, err
+		}
+		entry.Line = string(b)
+		return true, nil
+	})
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Ts = formatTimestamp(ts)
+	return entry, nil
+}
+
+// decodeTimestamp decodes a google.protobuf.Timestamp
+func decodeTimestamp(msg []byte) (time.Time, error) {
+	var seconds, nanos int64
+
+	err := decodeMessage(msg, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		if typ != protowire.Varint || (num != 1 && num != 2) {
+			return false, nil
+		}
+		v, err := d.Varint()
+		if num == 1 {
+			seconds = int64(v)
+		} else {
+			nanos = int64(int32(v))
+		}
+		return true, err
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, nanos), nil
+}
+
+// ParseLabels parses a label set in Prometheus text form, such as
+// {app="nginx", env="prod"}
+func ParseLabels(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, errors.New("expected labels in braces")
+	}
+	s = s[1 : len(s)-1]
+
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return labels, nil
+		}
+
+		// Label name
+		end := 0
+		for end < len(s) && isLabelNameChar(s[end], end == 0) {
+			end++
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("expected label name at %q", s)
+		}
+		name := s[:end]
+		s = strings.TrimLeft(s[end:], " \t")
+
+		if !strings.HasPrefix(s, "=") {
+			return nil, fmt.Errorf("expected '=' after %s", name)
+		}
+		s = strings.TrimLeft(s[1:], " \t")
+
+		// Quoted value
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil || quoted[0] != '"' {
+			return nil, fmt.Errorf("expected quoted value for %s", name)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		if _, dup := labels[name]; dup {
+			return nil, fmt.Errorf("duplicate label %s", name)
+		}
+		labels[name] = value
+
+		s = strings.TrimLeft(s[len(quoted):], " \t")
+		if s != "" && s[0] != ',' {
+			return nil, fmt.Errorf("expected ',' after %s", name)
+		}
+		if s != "" {
+			s = s[1:]
+		}
+	}
+}
+
+func isLabelNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
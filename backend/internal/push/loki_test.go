@@ -0,0 +1,90 @@
+package push
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/logpulse/backend/internal/protowire"
+	"github.com/logpulse/backend/internal/snappy"
+)
+
+func TestDecodeLokiProtobuf(t *testing.T) {
+	var ts []byte
+	ts = protowire.AppendVarint(ts, 1, 1705312800)
+	ts = protowire.AppendVarint(ts, 2, 500)
+
+	var entry []byte
+	entry = protowire.AppendBytes(entry, 1, ts)
+	entry = protowire.AppendString(entry, 2, "request served")
+	entry = protowire.AppendBytes(entry, 3, []byte("metadata"))
+
+	var stream []byte
+	stream = protowire.AppendString(stream, 1, `{app="web", path="/a\"b"}`)
+	stream = protowire.AppendBytes(stream, 2, entry)
+	stream = protowire.AppendVarint(stream, 3, 12345)
+
+	var req []byte
+	req = protowire.AppendBytes(req, 1, stream)
+
+	decoded, err := DecodeLokiProtobuf(snappy.Encode(nil, req), len(req))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decoded.Streams) != 1 || len(decoded.Streams[0].Entries) != 1 {
+		t.Fatalf("expected 1 stream with 1 entry, got %+v", decoded.Streams)
+	}
+	s := decoded.Streams[0]
+	if s.Labels["app"] != "web" || s.Labels["path"] != `/a"b` {
+		t.Errorf("unexpected labels %v", s.Labels)
+	}
+	if got := s.Entries[0]; got.Ts != "2024-01-15T10:00:00.0000005Z" || got.Line != "request served" {
+		t.Errorf("unexpected entry %+v", got)
+	}
+
+	if _, err := DecodeLokiProtobuf(snappy.Encode(nil, req[:len(req)-3]), len(req)); err == nil {
+		t.Error("expected an error for a truncated request")
+	}
+	if _, err := DecodeLokiProtobuf(snappy.Encode(nil, req), len(req)-1); !errors.Is(err, ErrDecodedTooLarge) {
+		t.Errorf("expected ErrDecodedTooLarge, got %v", err)
+	}
+}
+
+func TestDecodeLokiJSON(t *testing.T) {
+	body := `{"streams": [
+		{"stream": {"app": "web"}, "values": [["1705312800000000000", "one"], ["1705312801000000000", "two", {"trace_id": "abc"}]]},
+		{"stream": {"app": "idle"}, "values": []}
+	]}`
+	decoded, err := DecodeLokiJSON([]byte(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decoded.Streams) != 1 {
+		t.Fatalf("expected streams without entries to be dropped, got %d", len(decoded.Streams))
+	}
+	if got := decoded.Streams[0].Entries[1]; got.Ts != "2024-01-15T10:00:01Z" || got.Line != "two" {
+		t.Errorf("unexpected entry %+v", got)
+	}
+
+	if _, err := DecodeLokiJSON([]byte(`{"streams": [{"values": [["1", "x"]]}]}`)); !errors.Is(err, ErrNoLabels) {
+		t.Errorf("expected ErrNoLabels, got %v", err)
+	}
+	if _, err := DecodeLokiJSON([]byte(`{"streams": [{"stream": {"a": "b"}, "values": [["soon", "x"]]}]}`)); err == nil {
+		t.Error("expected an error for a bad timestamp")
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels(`{ job="x", level = "warn",}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(labels) != 2 || labels["job"] != "x" || labels["level"] != "warn" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+
+	for _, bad := range []string{`job="x"`, `{job=x}`, `{9job="x"}`, `{job="x" level="y"}`, `{a="1", a="2"}`} {
+		if _, err := ParseLabels(bad); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+}
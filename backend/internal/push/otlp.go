@@ -0,0 +1,454 @@
+package push
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/protowire"
+)
+
+// defaultServiceName labels streams whose resource has no allowed
+// attributes, as the OpenTelemetry SDKs do for a missing service.name
+const defaultServiceName = "unknown_service"
+
+// maxValueDepth bounds the nesting of protobuf attribute values
+const maxValueDepth = 64
+
+// OTLPDecoder decodes OTLP log export requests. Resource and scope
+// attributes on the allow-list become stream labels; every other attribute
+// is kept as entry metadata.
+type OTLPDecoder struct {
+	labelAttributes map[string]bool
+}
+
+// NewOTLPDecoder creates a decoder that turns the given resource and scope
+// attributes into labels, with their names sanitized
+func NewOTLPDecoder(labelAttributes []string) *OTLPDecoder {
+	allowed := make(map[string]bool, len(labelAttributes))
+	for _, name := range labelAttributes {
+		allowed[name] = true
+	}
+	return &OTLPDecoder{labelAttributes: allowed}
+}
+
+// OTLP log data, shaped after its JSON encoding. The protobuf decoder fills
+// the same types.
+type (
+	otlpLogsRequest struct {
+		ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+	}
+	otlpResourceLogs struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+	}
+	otlpScopeLogs struct {
+		Scope      otlpScope       `json:"scope"`
+		LogRecords []otlpLogRecord `json:"logRecords"`
+	}
+	otlpScope struct {
+		Name       string         `json:"name"`
+		Version    string         `json:"version"`
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpLogRecord struct {
+		TimeUnixNano         otlpInt        `json:"timeUnixNano"`
+		ObservedTimeUnixNano otlpInt        `json:"observedTimeUnixNano"`
+		SeverityNumber       int64          `json:"severityNumber"`
+		SeverityText         string         `json:"severityText"`
+		Body                 otlpAnyValue   `json:"body"`
+		Attributes           []otlpKeyValue `json:"attributes"`
+		TraceID              string         `json:"traceId"` // hex
+		SpanID               string         `json:"spanId"`  // hex
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string        `json:"stringValue"`
+		BoolValue   *bool          `json:"boolValue"`
+		IntValue    *otlpInt       `json:"intValue"`
+		DoubleValue *float64       `json:"doubleValue"`
+		ArrayValue  *otlpArray     `json:"arrayValue"`
+		KvlistValue *otlpKeyValues `json:"kvlistValue"`
+		BytesValue  []byte         `json:"bytesValue"` // base64
+	}
+	otlpArray struct {
+		Values []otlpAnyValue `json:"values"`
+	}
+	otlpKeyValues struct {
+		Values []otlpKeyValue `json:"values"`
+	}
+)
+
+// otlpInt is a 64-bit integer, which OTLP/JSON encodes as a string
+type otlpInt int64
+
+func (v *otlpInt) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		// Timestamps above math.MaxInt64 are still valid fixed64 values
+		u, uerr := strconv.ParseUint(s, 10, 64)
+		if uerr != nil {
+			return fmt.Errorf("invalid integer %s", data)
+		}
+		n = int64(u)
+	}
+	*v = otlpInt(n)
+	return nil
+}
+
+// DecodeJSON decodes an ExportLogsServiceRequest in OTLP/JSON
+func (o *OTLPDecoder) DecodeJSON(body []byte) (*models.IngestRequest, error) {
+	var req otlpLogsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("error parsing OTLP JSON request: %w", err)
+	}
+	return o.translate(&req), nil
+}
+
+// DecodeProtobuf decodes an ExportLogsServiceRequest in OTLP protobuf
+func (o *OTLPDecoder) DecodeProtobuf(body []byte) (*models.IngestRequest, error) {
+	var req otlpLogsRequest
+	err := decodeMessage(body, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		if num != 1 || typ != protowire.Bytes {
+			return false, nil
+		}
+		var rl otlpResourceLogs
+		err := decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+			switch {
+			case num == 1 && typ == protowire.Bytes:
+				return true, decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+					if num != 1 || typ != protowire.Bytes {
+						return false, nil
+					}
+					return true, appendKeyValue(d, &rl.Resource.Attributes)
+				})
+			case num == 2 && typ == protowire.Bytes:
+				sl, err := decodeScopeLogs(d)
+				rl.ScopeLogs = append(rl.ScopeLogs, sl)
+				return true, err
+			}
+			return false, nil
+		})
+		req.ResourceLogs = append(req.ResourceLogs, rl)
+		return true, err
+	})
+	if err != nil {
+		return nil, protoError(err)
+	}
+	return o.translate(&req), nil
+}
+
+// translate groups the records of each scope into a stream
+func (o *OTLPDecoder) translate(req *otlpLogsRequest) *models.IngestRequest {
+	out := &models.IngestRequest{}
+	now := time.Now()
+
+	for _, rl := range req.ResourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			labels := make(map[string]string)
+			shared := make(map[string]string)
+			o.split(rl.Resource.Attributes, labels, shared)
+			o.split(sl.Scope.Attributes, labels, shared)
+			if sl.Scope.Name != "" {
+				shared["scope_name"] = sl.Scope.Name
+			}
+			if sl.Scope.Version != "" {
+				shared["scope_version"] = sl.Scope.Version
+			}
+			if len(labels) == 0 {
+				labels["service_name"] = defaultServiceName
+			}
+
+			stream := models.Stream{Labels: labels, Entries: make([]models.Entry, 0, len(sl.LogRecords))}
+			for _, rec := range sl.LogRecords {
+				stream.Entries = append(stream.Entries, translateRecord(&rec, shared, now))
+			}
+			out.Streams = appendStream(out.Streams, stream)
+		}
+	}
+	return out
+}
+
+// split sorts attributes into labels and metadata
+func (o *OTLPDecoder) split(attrs []otlpKeyValue, labels, metadata map[string]string) {
+	for _, kv := range attrs {
+		value := kv.Value.String()
+		if o.labelAttributes[kv.Key] && value != "" {
+			labels[SanitizeLabelName(kv.Key)] = value
+			continue
+		}
+		metadata[SanitizeLabelName(kv.Key)] = value
+	}
+}
+
+// translateRecord converts a log record, adding the metadata shared by its
+// scope
+func translateRecord(rec *otlpLogRecord, shared map[string]string, now time.Time) models.Entry {
+	metadata := make(map[string]string, len(shared)+len(rec.Attributes)+4)
+	for k, v := range shared {
+		metadata[k] = v
+	}
+	for _, kv := range rec.Attributes {
+		metadata[SanitizeLabelName(kv.Key)] = kv.Value.String()
+	}
+	if rec.SeverityText != "" {
+		metadata["severity_text"] = rec.SeverityText
+	}
+	if rec.SeverityNumber != 0 {
+		metadata["severity_number"] = strconv.FormatInt(rec.SeverityNumber, 10)
+	}
+	if rec.TraceID != "" {
+		metadata["trace_id"] = rec.TraceID
+	}
+	if rec.SpanID != "" {
+		metadata["span_id"] = rec.SpanID
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+
+	ts := now
+	switch {
+	case rec.TimeUnixNano != 0:
+		ts = time.Unix(0, int64(rec.TimeUnixNano))
+	case rec.ObservedTimeUnixNano != 0:
+		ts = time.Unix(0, int64(rec.ObservedTimeUnixNano))
+	}
+
+	return models.Entry{Ts: formatTimestamp(ts), Line: rec.Body.String(), Metadata: metadata}
+}
+
+// String renders a value as text. Arrays and maps are rendered as JSON.
+func (v *otlpAnyValue) String() string {
+	switch native := v.native().(type) {
+	case string:
+		return native
+	case []any, map[string]any:
+		data, _ := json.Marshal(native)
+		return string(data)
+	default:
+		return fmt.Sprint(native)
+	}
+}
+
+// native converts a value to plain Go types for JSON encoding
+func (v *otlpAnyValue) native() any {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		if math.IsInf(*v.DoubleValue, 0) || math.IsNaN(*v.DoubleValue) {
+			return strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+		}
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		values := make([]any, len(v.ArrayValue.Values))
+		for i := range v.ArrayValue.Values {
+			values[i] = v.ArrayValue.Values[i].native()
+		}
+		return values
+	case v.KvlistValue != nil:
+		values := make(map[string]any, len(v.KvlistValue.Values))
+		for i := range v.KvlistValue.Values {
+			values[v.KvlistValue.Values[i].Key] = v.KvlistValue.Values[i].Value.native()
+		}
+		return values
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	}
+	return ""
+}
+
+// decodeEmbedded reads an embedded message field and decodes its fields
+func decodeEmbedded(d *protowire.Decoder, fn func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error)) error {
+	msg, err := d.Bytes()
+	if err != nil {
+		return err
+	}
+	return decodeMessage(msg, fn)
+}
+
+// decodeScopeLogs decodes a ScopeLogs message
+func decodeScopeLogs(d *protowire.Decoder) (otlpScopeLogs, error) {
+	var sl otlpScopeLogs
+	err := decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		if typ != protowire.Bytes {
+			return false, nil
+		}
+		switch num {
+		case 1:
+			return true, decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+				if typ != protowire.Bytes {
+					return false, nil
+				}
+				switch num {
+				case 1, 2:
+					b, err := d.Bytes()
+					if num == 1 {
+						sl.Scope.Name = string(b)
+					} else {
+						sl.Scope.Version = string(b)
+					}
+					return true, err
+				case 3:
+					return true, appendKeyValue(d, &sl.Scope.Attributes)
+				}
+				return false, nil
+			})
+		case 2:
+			rec, err := decodeLogRecord(d)
+			sl.LogRecords = append(sl.LogRecords, rec)
+			return true, err
+		}
+		return false, nil
+	})
+	return sl, err
+}
+
+// decodeLogRecord decodes a LogRecord message
+func decodeLogRecord(d *protowire.Decoder) (otlpLogRecord, error) {
+	var rec otlpLogRecord
+	err := decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		switch {
+		case (num == 1 || num == 11) && typ == protowire.Fixed64:
+			v, err := d.Fixed64()
+			if num == 1 {
+				rec.TimeUnixNano = otlpInt(v)
+			} else {
+				rec.ObservedTimeUnixNano = otlpInt(v)
+			}
+			return true, err
+		case num == 2 && typ == protowire.Varint:
+			v, err := d.Varint()
+			rec.SeverityNumber = int64(v)
+			return true, err
+		case num == 3 && typ == protowire.Bytes:
+			b, err := d.Bytes()
+			rec.SeverityText = string(b)
+			return true, err
+		case num == 5 && typ == protowire.Bytes:
+			v, err := decodeAnyValue(d, 0)
+			rec.Body = v
+			return true, err
+		case num == 6 && typ == protowire.Bytes:
+			return true, appendKeyValue(d, &rec.Attributes)
+		case (num == 9 || num == 10) && typ == protowire.Bytes:
+			b, err := d.Bytes()
+			if len(b) > 0 {
+				if num == 9 {
+					rec.TraceID = hex.EncodeToString(b)
+				} else {
+					rec.SpanID = hex.EncodeToString(b)
+				}
+			}
+			return true, err
+		}
+		return false, nil
+	})
+	return rec, err
+}
+
+// appendKeyValue decodes a KeyValue message onto attrs
+func appendKeyValue(d *protowire.Decoder, attrs *[]otlpKeyValue) error {
+	return appendNestedKeyValue(d, attrs, 0)
+}
+
+func appendNestedKeyValue(d *protowire.Decoder, attrs *[]otlpKeyValue, depth int) error {
+	var kv otlpKeyValue
+	err := decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		if typ != protowire.Bytes {
+			return false, nil
+		}
+		switch num {
+		case 1:
+			b, err := d.Bytes()
+			kv.Key = string(b)
+			return true, err
+		case 2:
+			v, err := decodeAnyValue(d, depth)
+			kv.Value = v
+			return true, err
+		}
+		return false, nil
+	})
+	*attrs = append(*attrs, kv)
+	return err
+}
+
+// decodeAnyValue decodes an AnyValue message nested depth levels deep in
+// other values
+func decodeAnyValue(d *protowire.Decoder, depth int) (otlpAnyValue, error) {
+	var v otlpAnyValue
+	if depth > maxValueDepth {
+		return v, protowire.ErrInvalid
+	}
+	err := decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+		switch {
+		case num == 1 && typ == protowire.Bytes:
+			b, err := d.Bytes()
+			s := string(b)
+			v.StringValue = &s
+			return true, err
+		case num == 2 && typ == protowire.Varint:
+			n, err := d.Varint()
+			b := n != 0
+			v.BoolValue = &b
+			return true, err
+		case num == 3 && typ == protowire.Varint:
+			n, err := d.Varint()
+			i := otlpInt(n)
+			v.IntValue = &i
+			return true, err
+		case num == 4 && typ == protowire.Fixed64:
+			n, err := d.Fixed64()
+			f := math.Float64frombits(n)
+			v.DoubleValue = &f
+			return true, err
+		case num == 5 && typ == protowire.Bytes:
+			v.ArrayValue = &otlpArray{}
+			return true, decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+				if num != 1 || typ != protowire.Bytes {
+					return false, nil
+				}
+				elem, err := decodeAnyValue(d, depth+1)
+				v.ArrayValue.Values = append(v.ArrayValue.Values, elem)
+				return true, err
+			})
+		case num == 6 && typ == protowire.Bytes:
+			v.KvlistValue = &otlpKeyValues{}
+			return true, decodeEmbedded(d, func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error) {
+				if num != 1 || typ != protowire.Bytes {
+					return false, nil
+				}
+				return true, appendNestedKeyValue(d, &v.KvlistValue.Values, depth+1)
+			})
+		case num == 7 && typ == protowire.Bytes:
+			b, err := d.Bytes()
+			v.BytesValue = append([]byte{}, b...)
+			return true, err
+		}
+		return false, nil
+	})
+	return v, err
+}
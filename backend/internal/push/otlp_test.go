@@ -0,0 +1,127 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/logpulse/backend/internal/protowire"
+)
+
+func otlpKeyValueProto(key, value string) []byte {
+	var v []byte
+	v = protowire.AppendString(v, 1, value)
+	var kv []byte
+	kv = protowire.AppendString(kv, 1, key)
+	return protowire.AppendBytes(kv, 2, v)
+}
+
+func TestOTLPDecoder_Protobuf(t *testing.T) {
+	var resource []byte
+	resource = protowire.AppendBytes(resource, 1, otlpKeyValueProto("service.name", "checkout"))
+	resource = protowire.AppendBytes(resource, 1, otlpKeyValueProto("host.name", "node-1"))
+
+	var scope []byte
+	scope = protowire.AppendString(scope, 1, "app.logger")
+
+	var intValue []byte
+	intValue = protowire.AppendVarint(intValue, 3, 42)
+	var attr []byte
+	attr = protowire.AppendString(attr, 1, "user.id")
+	attr = protowire.AppendBytes(attr, 2, intValue)
+
+	var body []byte
+	body = protowire.AppendString(body, 1, "payment accepted")
+
+	var record []byte
+	record = protowire.AppendFixed64(record, 1, 1705312800000000000)
+	record = protowire.AppendVarint(record, 2, 9)
+	record = protowire.AppendString(record, 3, "INFO")
+	record = protowire.AppendBytes(record, 5, body)
+	record = protowire.AppendBytes(record, 6, attr)
+	record = protowire.AppendBytes(record, 9, []byte{0xab, 0xcd})
+
+	var scopeLogs []byte
+	scopeLogs = protowire.AppendBytes(scopeLogs, 1, scope)
+	scopeLogs = protowire.AppendBytes(scopeLogs, 2, record)
+
+	var resourceLogs []byte
+	resourceLogs = protowire.AppendBytes(resourceLogs, 1, resource)
+	resourceLogs = protowire.AppendBytes(resourceLogs, 2, scopeLogs)
+
+	var req []byte
+	req = protowire.AppendBytes(req, 1, resourceLogs)
+
+	decoded, err := NewOTLPDecoder([]string{"service.name"}).DecodeProtobuf(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decoded.Streams) != 1 || len(decoded.Streams[0].Entries) != 1 {
+		t.Fatalf("expected 1 stream with 1 entry, got %+v", decoded.Streams)
+	}
+	s := decoded.Streams[0]
+	if len(s.Labels) != 1 || s.Labels["service_name"] != "checkout" {
+		t.Errorf("unexpected labels %v", s.Labels)
+	}
+
+	entry := s.Entries[0]
+	if entry.Ts != "2024-01-15T10:00:00Z" || entry.Line != "payment accepted" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	want := map[string]string{
+		"host_name":       "node-1",
+		"scope_name":      "app.logger",
+		"user_id":         "42",
+		"severity_text":   "INFO",
+		"severity_number": "9",
+		"trace_id":        "abcd",
+	}
+	if len(entry.Metadata) != len(want) {
+		t.Errorf("expected metadata %v, got %v", want, entry.Metadata)
+	}
+	for k, v := range want {
+		if entry.Metadata[k] != v {
+			t.Errorf("metadata %s: expected %q, got %q", k, v, entry.Metadata[k])
+		}
+	}
+
+	if _, err := NewOTLPDecoder(nil).DecodeProtobuf(req[:len(req)-4]); err == nil {
+		t.Error("expected an error for a truncated request")
+	}
+}
+
+func TestOTLPDecoder_JSON(t *testing.T) {
+	body := `{"resourceLogs": [{
+		"resource": {"attributes": [{"key": "deployment.environment", "value": {"stringValue": "prod"}}]},
+		"scopeLogs": [{"logRecords": [{
+			"observedTimeUnixNano": "1705312801000000000",
+			"body": {"kvlistValue": {"values": [{"key": "msg", "value": {"stringValue": "hi"}}, {"key": "n", "value": {"intValue": "3"}}]}},
+			"attributes": [{"key": "ok", "value": {"boolValue": true}}],
+			"spanId": "00f067aa0ba902b7"
+		}]}]
+	}, {
+		"scopeLogs": [{"logRecords": [{"timeUnixNano": "1705312802000000000", "body": {"stringValue": "anonymous"}}]}]
+	}]}`
+
+	decoded, err := NewOTLPDecoder([]string{"deployment.environment"}).DecodeJSON([]byte(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decoded.Streams) != 2 {
+		t.Fatalf("expected 2 streams, got %d", len(decoded.Streams))
+	}
+
+	first := decoded.Streams[0]
+	if first.Labels["deployment_environment"] != "prod" {
+		t.Errorf("unexpected labels %v", first.Labels)
+	}
+	entry := first.Entries[0]
+	if entry.Ts != "2024-01-15T10:00:01Z" || entry.Line != `{"msg":"hi","n":3}` {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if entry.Metadata["ok"] != "true" || entry.Metadata["span_id"] != "00f067aa0ba902b7" {
+		t.Errorf("unexpected metadata %v", entry.Metadata)
+	}
+
+	if got := decoded.Streams[1].Labels["service_name"]; got != defaultServiceName {
+		t.Errorf("expected a default service name, got %v", decoded.Streams[1].Labels)
+	}
+}
@@ -0,0 +1,101 @@
+// Package push translates the payloads of log shipper push APIs into
+// ingest requests
+package push
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/protowire"
+)
+
+// FormatLabels renders labels in Prometheus text form, the way Loki
+// quotes streams in errors
+func FormatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// SanitizeLabelName turns an attribute or field name such as service.name
+// into a valid label name by replacing other characters with underscores
+func SanitizeLabelName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	b := make([]byte, 0, len(name)+1)
+	if name[0] >= '0' && name[0] <= '9' {
+		b = append(b, '_')
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !isLabelNameChar(c, false) {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// formatTimestamp renders a timestamp for models.Entry
+func formatTimestamp(ts time.Time) string {
+	return ts.UTC().Format(time.RFC3339Nano)
+}
+
+// appendStream adds a stream unless it has no entries
+func appendStream(streams []models.Stream, stream models.Stream) []models.Stream {
+	if len(stream.Entries) == 0 {
+		return streams
+	}
+	return append(streams, stream)
+}
+
+// decodeMessage calls fn for each field of an encoded message. fn returns
+// false for fields it does not read, which are skipped.
+func decodeMessage(msg []byte, fn func(d *protowire.Decoder, num int, typ protowire.Type) (bool, error)) error {
+	d := protowire.NewDecoder(msg)
+	for !d.Done() {
+		num, typ, err := d.Field()
+		if err != nil {
+			return err
+		}
+		read, err := fn(d, num, typ)
+		if err != nil {
+			return err
+		}
+		if !read {
+			if err := d.Skip(typ); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// protoError describes a malformed protobuf body
+func protoError(err error) error {
+	if errors.Is(err, protowire.ErrTruncated) || errors.Is(err, protowire.ErrInvalid) {
+		return fmt.Errorf("error parsing protobuf push request: %w", err)
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package query
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/storage"
+)
+
+// ParseDeleteSelector compiles the query of a delete request: a stream
+// selector with optional line filters
+func ParseDeleteSelector(query string) (*storage.DeleteSelector, error) {
+	parsed, err := ParseAdvancedQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Aggregation != nil {
+		return nil, errors.New("delete query must not contain an aggregation")
+	}
+	// As in Loki, a selector must rule out streams without some label, or it
+	// would select every stream in the store
+	matchers := parsed.IndexMatchers()
+	if !slices.ContainsFunc(matchers, func(m index.Matcher) bool { return !m.Matches("") }) {
+		return nil, errors.New("delete query must contain at least one matcher that does not match the empty value")
+	}
+
+	selector := &storage.DeleteSelector{Matchers: matchers}
+	if len(parsed.LineFilters) > 0 {
+		selector.MatchLine = parsed.MatchLine
+	}
+	return selector, nil
+}
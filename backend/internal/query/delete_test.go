@@ -0,0 +1,31 @@
+package query
+
+import "testing"
+
+func TestParseDeleteSelector(t *testing.T) {
+	tests := []struct {
+		query string
+		valid bool
+	}{
+		{`{app="nginx"}`, true},
+		{`{app="nginx", env=~".*"} |= "user=42"`, true},
+		{`{app=~".+"}`, true},
+		{`{}`, false},
+		{`{app=~".*"}`, false},
+		{`{app!="nginx"}`, false},
+		{`{app="", env!~"prod"}`, false},
+		{`count_over_time({app="nginx"}[1h])`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			selector, err := ParseDeleteSelector(tt.query)
+			if tt.valid && (err != nil || selector == nil) {
+				t.Fatalf("expected a selector, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected the query to be rejected")
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 package query
 
 import (
-	"sort"
+	"sync"
 	"time"
 
 	"github.com/logpulse/backend/internal/index"
@@ -11,15 +11,21 @@ import (
 
 // Executor handles query execution
 type Executor struct {
-	index  *index.Index
-	reader *storage.Reader
+	index   *index.Index
+	reader  *storage.Reader
+	pool    *FetchPool
+	deleter *storage.Deleter
 }
 
-// NewExecutor creates a new query executor
-func NewExecutor(idx *index.Index, reader *storage.Reader) *Executor {
+// NewExecutor creates a new query executor reading chunks through pool.
+// Entries covered by pending requests of deleter, which may be nil, are
+// left out of results.
+func NewExecutor(idx *index.Index, reader *storage.Reader, pool *FetchPool, deleter *storage.Deleter) *Executor {
 	return &Executor{
-		index:  idx,
-		reader: reader,
+		index:   idx,
+		reader:  reader,
+		pool:    pool,
+		deleter: deleter,
 	}
 }
 
@@ -40,6 +46,7 @@ type LogResponse struct {
 
 type QueryStats struct {
 	QueriedChunks int `json:"queriedChunks"`
+	SkippedChunks int `json:"skippedChunks"` // ruled out by bloom filters
 	ScannedLines  int `json:"scannedLines"`
 	MatchedLines  int `json:"matchedLines"`
 	ExecutionTime int `json:"executionTime"` // milliseconds
@@ -63,6 +70,18 @@ type AggregationGroup struct {
 	Value  float64           `json:"value"`
 }
 
+// requiredSubstrings returns the patterns of |= filters, which every
+// matching line contains
+func requiredSubstrings(filters []LineFilter) []string {
+	var required []string
+	for _, f := range filters {
+		if f.Operator == LineContains && f.Pattern != "" {
+			required = append(required, f.Pattern)
+		}
+	}
+	return required
+}
+
 // Execute runs a query and returns matching logs
 func (e *Executor) Execute(queryStr string, startTime, endTime time.Time, limit int) (*QueryResult, error) {
 	startExec := time.Now()
@@ -73,71 +92,89 @@ func (e *Executor) Execute(queryStr string, startTime, endTime time.Time, limit
 		return nil, err
 	}
 
-	// Get simple labels for chunk lookup (exact matches only)
-	simpleLabels := make(map[string]string)
-	for _, m := range parsed.LabelMatchers {
-		if m.Operator == MatchEqual {
-			simpleLabels[m.Name] = m.Value
-		}
-	}
-
-	// Find matching chunks
-	chunkIDs := e.index.FindChunks(simpleLabels, startTime, endTime)
+	// Find matching chunks, resolving all label matchers in the index
+	chunkIDs := e.index.FindChunksMatching(parsed.IndexMatchers(), startTime, endTime)
 
 	stats := QueryStats{
 		QueriedChunks: len(chunkIDs),
 	}
 
-	var allLogs []models.LogEntry
+	required := requiredSubstrings(parsed.LineFilters)
 
-	// Read logs from each chunk
+	// Merge the chunks newest first, opening each only when it could hold
+	// the next entry. Chunks are opened concurrently.
+	var mu sync.Mutex
+	var opened []*storage.ChunkIterator
+	sources := make([]*mergeSource, 0, len(chunkIDs))
 	for _, chunkID := range chunkIDs {
 		meta := e.index.GetChunkMeta(chunkID)
 		if meta == nil {
 			continue
 		}
 
-		entries, scanned, err := e.reader.ReadChunkFiltered(meta.Labels, chunkID, startTime, endTime)
-		if err != nil {
+		sources = append(sources, &mergeSource{
+			// Chunk end times are truncated to seconds
+			head: time.Unix(meta.EndTime+1, 0),
+			open: func() (storage.EntryIterator, error) {
+				reader := e.reader.ForTier(meta.Tier)
+				if len(required) > 0 && !reader.ChunkMayContain(meta.Labels, meta.ID, required) {
+					mu.Lock()
+					stats.SkippedChunks++
+					mu.Unlock()
+					return nil, nil
+				}
+				it, err := reader.IterateChunk(meta.Labels, meta.ID, startTime, endTime, storage.Backward)
+				if err != nil {
+					return nil, err
+				}
+				mu.Lock()
+				opened = append(opened, it)
+				mu.Unlock()
+				return it, nil
+			},
+		})
+	}
+
+	merged := newMergeIterator(sources, e.pool)
+
+	// Apply advanced filters, stopping at the limit unless aggregating
+	var allLogs []models.LogEntry
+	for merged.Next() {
+		entry := merged.At()
+
+		// Check label matchers (including regex)
+		if !parsed.MatchLabels(entry.Labels) {
 			continue
 		}
 
-		stats.ScannedLines += scanned
-
-		// Apply advanced filters
-		for _, entry := range entries {
-			// Check label matchers (including regex)
-			if !parsed.MatchLabels(entry.Labels) {
-				continue
-			}
+		// Check line filters
+		if !parsed.MatchLine(entry.Line) {
+			continue
+		}
 
-			// Check line filters
-			if !parsed.MatchLine(entry.Line) {
-				continue
-			}
+		// Hide entries awaiting deletion
+		if e.deleter.Hides(entry) {
+			continue
+		}
 
-			allLogs = append(allLogs, entry)
+		allLogs = append(allLogs, entry)
+		if parsed.Aggregation == nil && limit > 0 && len(allLogs) >= limit {
+			break
 		}
 	}
+	merged.Close()
 
+	for _, it := range opened {
+		stats.ScannedLines += it.Scanned()
+	}
 	stats.MatchedLines = len(allLogs)
 
-	// Sort by timestamp descending (newest first)
-	sort.Slice(allLogs, func(i, j int) bool {
-		return allLogs[i].Timestamp.After(allLogs[j].Timestamp)
-	})
-
 	// Handle aggregations
 	var aggResult *AggregationResult
 	if parsed.Aggregation != nil {
 		aggResult = e.computeAggregation(parsed.Aggregation, allLogs, startTime, endTime)
 	}
 
-	// Apply limit (only for non-aggregation queries)
-	if limit > 0 && len(allLogs) > limit && parsed.Aggregation == nil {
-		allLogs = allLogs[:limit]
-	}
-
 	// Convert to response format
 	logs := make([]LogResponse, len(allLogs))
 	for i, entry := range allLogs {
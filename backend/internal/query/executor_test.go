@@ -0,0 +1,194 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/storage"
+)
+
+func TestExecute_SkipsChunksByBloomFilter(t *testing.T) {
+	dir := t.TempDir()
+	writer := storage.NewWriter(dir, 0, storage.CompressionSnappy)
+	idx := index.NewIndex()
+	labels := map[string]string{"service": "api"}
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	for c := 0; c < 4; c++ {
+		entries := make([]models.LogEntry, 50)
+		for i := range entries {
+			entries[i] = models.LogEntry{
+				ID:        fmt.Sprintf("%d-%d", c, i),
+				Timestamp: base.Add(time.Duration(c*50+i) * time.Second),
+				Line:      fmt.Sprintf("handled request %d trace_id=chunk%d", i, c),
+				Labels:    labels,
+			}
+		}
+		chunkID, start, end, err := writer.WriteChunk(labels, entries)
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		idx.AddChunk(chunkID, labels, start, end, len(entries))
+	}
+
+	executor := NewExecutor(idx, storage.NewReader(dir), NewFetchPool(4, 2), nil)
+	result, err := executor.Execute(`{service="api"} |= "trace_id=chunk2"`, base, base.Add(time.Hour), 100)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	if result.Stats.MatchedLines != 50 {
+		t.Errorf("expected 50 matching lines, got %d", result.Stats.MatchedLines)
+	}
+	if result.Stats.QueriedChunks != 4 || result.Stats.SkippedChunks != 3 {
+		t.Errorf("expected 3 of 4 chunks skipped, got %+v", result.Stats)
+	}
+	if result.Stats.ScannedLines != 50 {
+		t.Errorf("expected only the matching chunk to be scanned, got %d lines", result.Stats.ScannedLines)
+	}
+}
+
+func TestExecute_MergesChunksAndStopsAtLimit(t *testing.T) {
+	dir := t.TempDir()
+	writer := storage.NewWriter(dir, 0, storage.CompressionSnappy)
+	idx := index.NewIndex()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	// Two streams whose chunks interleave in time, and older chunks that a
+	// small limit never reaches
+	for c := 0; c < 10; c++ {
+		for s, service := range []string{"api", "web"} {
+			labels := map[string]string{"service": service}
+			entries := make([]models.LogEntry, 100)
+			for i := range entries {
+				entries[i] = models.LogEntry{
+					ID:        fmt.Sprintf("%s-%d-%d", service, c, i),
+					Timestamp: base.Add(time.Duration(c*200+i*2+s) * time.Second),
+					Line:      fmt.Sprintf("request %d", i),
+					Labels:    labels,
+				}
+			}
+			chunkID, start, end, err := writer.WriteChunk(labels, entries)
+			if err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			idx.AddChunk(chunkID, labels, start, end, len(entries))
+		}
+	}
+
+	executor := NewExecutor(idx, storage.NewReader(dir), NewFetchPool(4, 2), nil)
+	result, err := executor.Execute(`{service=~"api|web"}`, base, base.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	if len(result.Logs) != 10 {
+		t.Fatalf("expected 10 logs, got %d", len(result.Logs))
+	}
+	if result.Logs[0].ID != "web-9-99" || result.Logs[1].ID != "api-9-99" || result.Logs[2].ID != "web-9-98" {
+		t.Errorf("expected newest entries of both streams interleaved, got %s, %s, %s",
+			result.Logs[0].ID, result.Logs[1].ID, result.Logs[2].ID)
+	}
+	for i := 1; i < len(result.Logs); i++ {
+		if result.Logs[i].Timestamp > result.Logs[i-1].Timestamp {
+			t.Fatalf("logs not newest first at %d", i)
+		}
+	}
+	if result.Stats.ScannedLines > 200 {
+		t.Errorf("expected only the newest chunks to be read, scanned %d lines", result.Stats.ScannedLines)
+	}
+}
+
+func TestExecute_HidesPendingDeletes(t *testing.T) {
+	dir := t.TempDir()
+	writer := storage.NewWriter(dir, 0, storage.CompressionSnappy)
+	reader := storage.NewReader(dir)
+	idx := index.NewIndex()
+	labels := map[string]string{"service": "api"}
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	entries := make([]models.LogEntry, 20)
+	for i := range entries {
+		entries[i] = models.LogEntry{
+			ID:        fmt.Sprintf("%d", i),
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			Line:      fmt.Sprintf("login user=%d", i%2),
+			Labels:    labels,
+		}
+	}
+	chunkID, start, end, err := writer.WriteChunk(labels, entries)
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	idx.AddChunk(chunkID, labels, start, end, len(entries))
+
+	deleter, err := storage.NewDeleter(reader, writer, idx, storage.DeleterOptions{Parse: ParseDeleteSelector})
+	if err != nil {
+		t.Fatalf("create deleter failed: %v", err)
+	}
+	if _, err := deleter.Add(`{service="api"} |= "user=1"`, base, base.Add(9*time.Second)); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	executor := NewExecutor(idx, reader, NewFetchPool(4, 2), deleter)
+	result, err := executor.Execute(`{service="api"}`, base, base.Add(time.Hour), 100)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	// user=1 entries within the first 10 seconds are hidden
+	if len(result.Logs) != 15 {
+		t.Fatalf("expected 15 logs, got %d", len(result.Logs))
+	}
+	for _, l := range result.Logs {
+		if l.Message == "login user=1" && l.Timestamp < base.Add(10*time.Second).Format(time.RFC3339Nano) {
+			t.Fatalf("expected entry %s to be hidden", l.ID)
+		}
+	}
+}
+
+func TestExecute_MissingLabelHasEmptyValue(t *testing.T) {
+	dir := t.TempDir()
+	writer := storage.NewWriter(dir, 0, storage.CompressionSnappy)
+	idx := index.NewIndex()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	for _, labels := range []map[string]string{
+		{"env": "prod", "app": "nginx"},
+		{"env": "prod"},
+	} {
+		entries := []models.LogEntry{{ID: labels["app"], Timestamp: base, Line: "request", Labels: labels}}
+		chunkID, start, end, err := writer.WriteChunk(labels, entries)
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		idx.AddChunk(chunkID, labels, start, end, len(entries))
+	}
+
+	executor := NewExecutor(idx, storage.NewReader(dir), NewFetchPool(4, 2), nil)
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{`{env="prod", app=~".*"}`, 2},
+		{`{env="prod", app=""}`, 1},
+		{`{env="prod", app!=""}`, 1},
+		{`{env="prod", app=~".+"}`, 1},
+		{`{env="prod", app!~"nginx|"}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, err := executor.Execute(tt.query, base, base.Add(time.Hour), 100)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			// Every chunk the index selects has matching lines
+			if result.Stats.QueriedChunks != tt.want || result.Stats.MatchedLines != tt.want {
+				t.Errorf("expected %d chunks and lines, got %+v", tt.want, result.Stats)
+			}
+		})
+	}
+}
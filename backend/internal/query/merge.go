@@ -0,0 +1,202 @@
+package query
+
+import (
+	"container/heap"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/storage"
+)
+
+// fetchBatchSize is the number of entries a chunk reader decodes ahead of
+// the merge
+const fetchBatchSize = 512
+
+// mergeSource is one chunk taking part in a merge. Chunks are opened only
+// once their newest possible entry could be next, so a merge that stops
+// early never reads chunks older than the entries it returned, apart from
+// those already fetched ahead.
+type mergeSource struct {
+	open func() (storage.EntryIterator, error) // nil result skips the chunk
+	head time.Time                             // timestamp of the next entry, or an upper bound before loading
+
+	batches chan []models.LogEntry // filled by the chunk's reader, nil until started
+	batch   []models.LogEntry      // nil until the first batch arrives
+	pos     int
+}
+
+// mergeHeap orders sources newest head first
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int           { return len(h) }
+func (h mergeHeap) Less(i, j int) bool { return h[i].head.After(h[j].head) }
+func (h mergeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)        { *h = append(*h, x.(*mergeSource)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	src := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return src
+}
+
+// mergeIterator merges backward chunk iterators into a single stream of
+// entries, newest first. Chunks are read and decoded in the background,
+// several at a time within the limits of a FetchPool.
+type mergeIterator struct {
+	heap mergeHeap
+	cur  models.LogEntry
+	last *mergeSource // source of cur, advanced on the next call
+
+	pool    *FetchPool
+	slots   chan struct{} // this query's share of the pool
+	pending []*mergeSource
+	next    int // first source in pending not yet started
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newMergeIterator merges sources whose heads are set to upper bounds of
+// their entries' timestamps
+func newMergeIterator(sources []*mergeSource, pool *FetchPool) *mergeIterator {
+	pending := make([]*mergeSource, len(sources))
+	copy(pending, sources)
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].head.After(pending[j].head) })
+
+	m := &mergeIterator{
+		heap:    sources,
+		pool:    pool,
+		slots:   make(chan struct{}, pool.perQuery),
+		pending: pending,
+		done:    make(chan struct{}),
+	}
+	heap.Init(&m.heap)
+	return m
+}
+
+// Next advances to the newest entry not yet returned. Chunks that fail to
+// open or read are skipped.
+func (m *mergeIterator) Next() bool {
+	if m.last != nil {
+		m.refill(m.last)
+		m.last = nil
+	}
+
+	for len(m.heap) > 0 {
+		src := m.heap[0]
+		if src.batch == nil {
+			if src.batches == nil {
+				m.startFrom(src)
+			}
+			m.refill(src)
+			continue
+		}
+
+		m.cur = src.batch[src.pos]
+		src.pos++
+		m.last = src
+		return true
+	}
+	return false
+}
+
+// refill points the source at the top of the heap to its next entry,
+// waiting for its next batch if needed, and drops it once exhausted
+func (m *mergeIterator) refill(src *mergeSource) {
+	if src.pos >= len(src.batch) {
+		batch, ok := <-src.batches
+		if !ok {
+			heap.Pop(&m.heap)
+			return
+		}
+		src.batch, src.pos = batch, 0
+	}
+	src.head = src.batch[src.pos].Timestamp
+	heap.Fix(&m.heap, 0)
+}
+
+// startFrom starts reading src and the sources most likely to be needed
+// after it, up to the query's concurrency
+func (m *mergeIterator) startFrom(src *mergeSource) {
+	for n := 0; m.next < len(m.pending) && (src.batches == nil || n < m.pool.perQuery); n++ {
+		m.start(m.pending[m.next])
+		m.next++
+	}
+}
+
+// start reads a source in the background, a batch at a time
+func (m *mergeIterator) start(src *mergeSource) {
+	src.batches = make(chan []models.LogEntry, 1)
+	m.wg.Add(1)
+	go m.fetch(src)
+}
+
+func (m *mergeIterator) fetch(src *mergeSource) {
+	defer m.wg.Done()
+	defer close(src.batches)
+
+	var it storage.EntryIterator
+	defer func() {
+		if it != nil {
+			it.Close()
+		}
+	}()
+
+	for {
+		if !m.pool.acquire(m.slots, m.done) {
+			return
+		}
+		if it == nil {
+			var err error
+			if it, err = src.open(); err != nil {
+				logChunkError(err)
+			}
+			if it == nil {
+				m.pool.release(m.slots)
+				return
+			}
+		}
+
+		batch := make([]models.LogEntry, 0, fetchBatchSize)
+		for len(batch) < fetchBatchSize && it.Next() {
+			batch = append(batch, it.At())
+		}
+		m.pool.release(m.slots)
+
+		if len(batch) > 0 {
+			select {
+			case src.batches <- batch:
+			case <-m.done:
+				return
+			}
+		}
+		if len(batch) < fetchBatchSize {
+			if err := it.Err(); err != nil {
+				logChunkError(err)
+			}
+			return
+		}
+	}
+}
+
+// At returns the current entry
+func (m *mergeIterator) At() models.LogEntry {
+	return m.cur
+}
+
+// Close stops the background reads and waits for them to finish
+func (m *mergeIterator) Close() {
+	close(m.done)
+	m.wg.Wait()
+	m.heap = nil
+}
+
+// logChunkError reports a chunk a query had to skip
+func logChunkError(err error) {
+	if errors.Is(err, storage.ErrCorruptChunk) {
+		log.Printf("Query skipped corrupt chunk: %v", err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/logpulse/backend/internal/index"
 )
 
 var (
@@ -379,22 +381,10 @@ func BuildQuery(labels map[string]string) string {
 	return "{" + strings.Join(parts, ", ") + "}"
 }
 
-// Match checks if a set of labels matches the given matchers
+// Match checks if a set of labels matches the given matchers, with the
+// semantics the index applies to chunks: a missing label has the empty value
 func (m *LabelMatcher) Match(labels map[string]string) bool {
-	value, exists := labels[m.Name]
-
-	switch m.Operator {
-	case MatchEqual:
-		return exists && value == m.Value
-	case MatchNotEqual:
-		return !exists || value != m.Value
-	case MatchRegex:
-		return exists && m.Regex != nil && m.Regex.MatchString(value)
-	case MatchNotRegex:
-		return !exists || (m.Regex != nil && !m.Regex.MatchString(value))
-	}
-
-	return false
+	return m.indexMatcher().Matches(labels[m.Name])
 }
 
 // Match checks if a log line matches the filter
@@ -413,6 +403,37 @@ func (f *LineFilter) Match(line string) bool {
 	return true
 }
 
+// IndexMatchers converts the label matchers for chunk lookup in the index
+func (p *ParsedQuery) IndexMatchers() []index.Matcher {
+	matchers := make([]index.Matcher, 0, len(p.LabelMatchers))
+	for _, m := range p.LabelMatchers {
+		matchers = append(matchers, m.indexMatcher())
+	}
+	return matchers
+}
+
+// indexMatcher converts a label matcher to its index form
+func (m *LabelMatcher) indexMatcher() index.Matcher {
+	var matchType index.MatchType
+	switch m.Operator {
+	case MatchEqual:
+		matchType = index.MatchEqual
+	case MatchNotEqual:
+		matchType = index.MatchNotEqual
+	case MatchRegex:
+		matchType = index.MatchRegex
+	case MatchNotRegex:
+		matchType = index.MatchNotRegex
+	}
+
+	return index.Matcher{
+		Name:  m.Name,
+		Value: m.Value,
+		Type:  matchType,
+		Regex: m.Regex,
+	}
+}
+
 // MatchLabels checks if all matchers match the given labels
 func (p *ParsedQuery) MatchLabels(labels map[string]string) bool {
 	for _, m := range p.LabelMatchers {
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"regexp"
 	"testing"
 )
 
@@ -146,6 +147,18 @@ func TestLabelMatcher_Match(t *testing.T) {
 			labels:   map[string]string{"level": "debug"},
 			expected: false,
 		},
+		{
+			name:     "empty value matches missing label",
+			matcher:  LabelMatcher{Name: "app", Value: "", Operator: MatchEqual},
+			labels:   map[string]string{"level": "debug"},
+			expected: true,
+		},
+		{
+			name:     "regex matching empty matches missing label",
+			matcher:  LabelMatcher{Name: "app", Value: ".*", Operator: MatchRegex, Regex: regexp.MustCompile(".*")},
+			labels:   map[string]string{"level": "debug"},
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,47 @@
+package query
+
+import "runtime"
+
+// FetchPool bounds how many chunk reads run at once, both within a single
+// query and across all queries sharing the pool, so broad queries cannot
+// take every core away from ingestion
+type FetchPool struct {
+	global   chan struct{}
+	perQuery int
+}
+
+// NewFetchPool creates a pool running at most global chunk reads at once
+// and at most perQuery for any one query. A global limit of 0 uses half
+// the CPUs; a perQuery limit of 0 lets one query use the whole pool.
+func NewFetchPool(global, perQuery int) *FetchPool {
+	if global <= 0 {
+		global = max(runtime.NumCPU()/2, 1)
+	}
+	if perQuery <= 0 || perQuery > global {
+		perQuery = global
+	}
+	return &FetchPool{global: make(chan struct{}, global), perQuery: perQuery}
+}
+
+// acquire takes a slot of the query's own limit and then a global slot,
+// giving up once done is closed
+func (p *FetchPool) acquire(local chan struct{}, done <-chan struct{}) bool {
+	select {
+	case local <- struct{}{}:
+	case <-done:
+		return false
+	}
+	select {
+	case p.global <- struct{}{}:
+		return true
+	case <-done:
+		<-local
+		return false
+	}
+}
+
+// release returns the slots taken by acquire
+func (p *FetchPool) release(local chan struct{}) {
+	<-p.global
+	<-local
+}
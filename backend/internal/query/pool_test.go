@@ -0,0 +1,27 @@
+package query
+
+import "testing"
+
+func TestFetchPool_Limits(t *testing.T) {
+	pool := NewFetchPool(2, 1)
+	a, b, c := make(chan struct{}, pool.perQuery), make(chan struct{}, pool.perQuery), make(chan struct{}, pool.perQuery)
+	done := make(chan struct{})
+	close(done)
+
+	if !pool.acquire(a, nil) || !pool.acquire(b, nil) {
+		t.Fatal("expected two queries to get a slot each")
+	}
+
+	// Both the query's own limit and the global limit are full
+	if pool.acquire(a, done) {
+		t.Fatal("expected the per-query limit to hold")
+	}
+	if pool.acquire(c, done) {
+		t.Fatal("expected the global limit to hold")
+	}
+
+	pool.release(b)
+	if !pool.acquire(c, nil) {
+		t.Fatal("expected a released slot to be reused")
+	}
+}
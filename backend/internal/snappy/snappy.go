@@ -0,0 +1,280 @@
+// Package snappy implements the Snappy block format used for chunk
+// compression and by Loki-compatible push clients.
+// See https://github.com/google/snappy/blob/main/format_description.txt
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrCorrupt = errors.New("snappy: corrupt input")
+
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+
+	// maxBlockSize is the largest span the encoder looks for matches in,
+	// which keeps every copy offset within two bytes
+	maxBlockSize = 65536
+
+	// minNonLiteralBlockSize is the smallest block worth searching for
+	// matches in
+	minNonLiteralBlockSize = 1 + 1 + inputMargin
+
+	// inputMargin lets the match loop read ahead without bounds checks
+	inputMargin = 16 - 1
+
+	tableBits = 14
+	tableSize = 1 << tableBits
+
+	// maxExpansion bounds how much a valid input can grow when decoded: a
+	// three byte copy tag produces at most 64 bytes
+	maxExpansion = 24
+)
+
+// DecodedLen returns the length of the decoded form of src
+func DecodedLen(src []byte) (int, error) {
+	v, n := binary.Uvarint(src)
+	if n <= 0 || v > uint64(len(src))*maxExpansion || v > 0xffffffff {
+		return 0, ErrCorrupt
+	}
+	return int(v), nil
+}
+
+// Decode returns the decoded form of src, reusing dst if it is large enough
+func Decode(dst, src []byte) ([]byte, error) {
+	dLen, err := DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	_, n := binary.Uvarint(src)
+	src = src[n:]
+
+	if cap(dst) >= dLen {
+		dst = dst[:dLen]
+	} else {
+		dst = make([]byte, dLen)
+	}
+
+	d, s := 0, 0
+	for s < len(src) {
+		tag := src[s]
+		var length, offset int
+
+		switch tag & 0x03 {
+		case tagLiteral:
+			x := uint32(tag >> 2)
+			switch {
+			case x < 60:
+				s++
+			case x == 60:
+				s += 2
+				if s > len(src) {
+					return nil, ErrCorrupt
+				}
+				x = uint32(src[s-1])
+			case x == 61:
+				s += 3
+				if s > len(src) {
+					return nil, ErrCorrupt
+				}
+				x = uint32(src[s-2]) | uint32(src[s-1])<<8
+			case x == 62:
+				s += 4
+				if s > len(src) {
+					return nil, ErrCorrupt
+				}
+				x = uint32(src[s-3]) | uint32(src[s-2])<<8 | uint32(src[s-1])<<16
+			default:
+				s += 5
+				if s > len(src) {
+					return nil, ErrCorrupt
+				}
+				x = binary.LittleEndian.Uint32(src[s-4 : s])
+			}
+
+			length = int(x) + 1
+			if length <= 0 || length > len(dst)-d || length > len(src)-s {
+				return nil, ErrCorrupt
+			}
+			copy(dst[d:], src[s:s+length])
+			d += length
+			s += length
+			continue
+
+		case tagCopy1:
+			s += 2
+			if s > len(src) {
+				return nil, ErrCorrupt
+			}
+			length = 4 + int(tag>>2)&0x07
+			offset = int(tag&0xe0)<<3 | int(src[s-1])
+
+		case tagCopy2:
+			s += 3
+			if s > len(src) {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s-2 : s]))
+
+		case tagCopy4:
+			s += 5
+			if s > len(src) {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s-4 : s]))
+		}
+
+		if offset <= 0 || d < offset || length > len(dst)-d {
+			return nil, ErrCorrupt
+		}
+		// Copies may overlap their own output, so go byte by byte
+		for end := d + length; d < end; d++ {
+			dst[d] = dst[d-offset]
+		}
+	}
+
+	if d != dLen {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
+
+// Encode returns the encoded form of src, appending to dst[:0]
+func Encode(dst, src []byte) []byte {
+	dst = binary.AppendUvarint(dst[:0], uint64(len(src)))
+
+	for len(src) > 0 {
+		p := src
+		if len(p) > maxBlockSize {
+			p = p[:maxBlockSize]
+		}
+		src = src[len(p):]
+
+		if len(p) < minNonLiteralBlockSize {
+			dst = emitLiteral(dst, p)
+		} else {
+			dst = encodeBlock(dst, p)
+		}
+	}
+
+	return dst
+}
+
+func emitLiteral(dst, lit []byte) []byte {
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// emitCopy writes a copy of length bytes at offset, which is below 65536
+func emitCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		// Leave at least four bytes so the tail can use a copy1 tag
+		dst = append(dst, 59<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 12 || offset >= 2048 {
+		return append(dst, byte(length-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|tagCopy1, byte(offset))
+}
+
+func load32(b []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(b[i : i+4])
+}
+
+func load64(b []byte, i int) uint64 {
+	return binary.LittleEndian.Uint64(b[i : i+8])
+}
+
+func hash(u uint32) uint32 {
+	return (u * 0x1e35a7bd) >> (32 - tableBits)
+}
+
+// encodeBlock greedily replaces repeated four byte sequences with copies.
+// len(src) must be between minNonLiteralBlockSize and maxBlockSize.
+func encodeBlock(dst, src []byte) []byte {
+	var table [tableSize]uint16
+
+	sLimit := len(src) - inputMargin
+	nextEmit := 0
+
+	s := 1
+	nextHash := hash(load32(src, s))
+
+	for {
+		// Skip ahead faster the longer no match has been found
+		skip := 32
+		nextS := s
+		candidate := 0
+		for {
+			s = nextS
+			step := skip >> 5
+			nextS = s + step
+			skip += step
+			if nextS > sLimit {
+				goto emitRemainder
+			}
+			candidate = int(table[nextHash])
+			table[nextHash] = uint16(s)
+			nextHash = hash(load32(src, nextS))
+			if load32(src, s) == load32(src, candidate) {
+				break
+			}
+		}
+
+		dst = emitLiteral(dst, src[nextEmit:s])
+
+		// Emit copies for as long as the next bytes match again
+		for {
+			base := s
+			s += 4
+			for i := candidate + 4; s < len(src) && src[i] == src[s]; i, s = i+1, s+1 {
+			}
+
+			dst = emitCopy(dst, base-candidate, s-base)
+			nextEmit = s
+			if s >= sLimit {
+				goto emitRemainder
+			}
+
+			x := load64(src, s-1)
+			table[hash(uint32(x))] = uint16(s - 1)
+			currHash := hash(uint32(x >> 8))
+			candidate = int(table[currHash])
+			table[currHash] = uint16(s)
+			if uint32(x>>8) != load32(src, candidate) {
+				nextHash = hash(uint32(x >> 16))
+				s++
+				break
+			}
+		}
+	}
+
+emitRemainder:
+	if nextEmit < len(src) {
+		dst = emitLiteral(dst, src[nextEmit:])
+	}
+	return dst
+}
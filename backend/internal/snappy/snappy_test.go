@@ -0,0 +1,70 @@
+package snappy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Inputs and their encoding by the reference implementation
+var referenceVectors = []struct {
+	input   string
+	encoded string
+}{
+	{"", "00"},
+	{"a", "010061"},
+	{"abcdabcdabcdabcd", "103c61626364616263646162636461626364"},
+	{"hello hello hello hello world", "1d1468656c6c6f2046060010776f726c64"},
+	{strings.Repeat("0123456789", 30), "ac022430313233343536373839fe0a00fe0a00fe0a00fe0a00860a00"},
+	{
+		`level=info msg="request served" path=/api/v1/users status=200 level=info msg="request served" path=/api/v1/orders status=200`,
+		"7cf0466c6576656c3d696e666f206d73673d2272657175657374207365727665642220706174683d2f6170692f76312f7573657273207374617475733d323030206c6576656c3d696e668e3e00406f7264657273207374617475733d323030",
+	},
+}
+
+func TestDecodeReference(t *testing.T) {
+	for _, v := range referenceVectors {
+		encoded, _ := hex.DecodeString(v.encoded)
+		got, err := Decode(nil, encoded)
+		if err != nil {
+			t.Errorf("%q: decode failed: %v", v.input, err)
+			continue
+		}
+		if string(got) != v.input {
+			t.Errorf("%q: decoded to %q", v.input, got)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, v := range referenceVectors {
+		encoded := Encode(nil, []byte(v.input))
+		got, err := Decode(nil, encoded)
+		if err != nil || string(got) != v.input {
+			t.Errorf("%q: round trip gave %q, %v", v.input, got, err)
+		}
+	}
+
+	// Inputs spanning several blocks
+	long := bytes.Repeat([]byte("abcdefghij"), 20000)
+	if got, err := Decode(nil, Encode(nil, long)); err != nil || !bytes.Equal(got, long) {
+		t.Errorf("round trip of %d bytes failed: %v", len(long), err)
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	for _, encoded := range []string{
+		"",           // no length
+		"ff",         // truncated length
+		"0500",       // literal longer than the input
+		"0561",       // shorter than the declared length
+		"04010500",   // copy before any output
+		"0500610105", // copy offset beyond the output
+	} {
+		src, _ := hex.DecodeString(encoded)
+		if _, err := Decode(nil, src); err == nil {
+			t.Errorf("%s: expected an error", encoded)
+		}
+	}
+}
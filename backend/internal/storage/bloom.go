@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/logpulse/backend/internal/models"
+)
+
+// A chunk's bloom filter holds every 3-byte substring of its lines. A
+// substring of three or more bytes can only occur in the chunk if all of
+// its trigrams are in the filter.
+
+const (
+	bloomMagic      = "LPBF"
+	bloomVersion    = 1
+	bloomHashes     = 7  // hash functions per trigram
+	bloomBitsPerKey = 10 // about 1% false positives with 7 hashes
+	bloomNGram      = 3
+)
+
+// errCorruptBloom is returned for bloom filter data that cannot be decoded
+var errCorruptBloom = errors.New("corrupt bloom filter")
+
+// bloomFilter is a bloom filter over line trigrams
+type bloomFilter struct {
+	bits []uint64
+	k    int
+}
+
+// buildBloom creates the bloom filter for a chunk's entries
+func buildBloom(entries []models.LogEntry) *bloomFilter {
+	trigrams := make(map[uint32]struct{})
+	for _, entry := range entries {
+		line := entry.Line
+		for i := 0; i+bloomNGram <= len(line); i++ {
+			trigrams[trigram(line[i:])] = struct{}{}
+		}
+	}
+
+	words := (len(trigrams)*bloomBitsPerKey + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	f := &bloomFilter{bits: make([]uint64, words), k: bloomHashes}
+	for t := range trigrams {
+		f.add(t)
+	}
+	return f
+}
+
+// trigram packs the first three bytes of s
+func trigram(s string) uint32 {
+	return uint32(s[0])<<16 | uint32(s[1])<<8 | uint32(s[2])
+}
+
+// bloomHash derives two independent hashes of a trigram (splitmix64)
+func bloomHash(t uint32) (uint64, uint64) {
+	h := uint64(t) + 0x9e3779b97f4a7c15
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	h ^= h >> 31
+	return h, h>>32 | 1
+}
+
+func (f *bloomFilter) add(t uint32) {
+	h1, h2 := bloomHash(t)
+	m := uint64(len(f.bits) * 64)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) has(t uint32) bool {
+	h1, h2 := bloomHash(t)
+	m := uint64(len(f.bits) * 64)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// mayContain reports whether a line of the chunk may contain s. Strings
+// shorter than a trigram always may.
+func (f *bloomFilter) mayContain(s string) bool {
+	for i := 0; i+bloomNGram <= len(s); i++ {
+		if !f.has(trigram(s[i:])) {
+			return false
+		}
+	}
+	return true
+}
+
+// marshal encodes the filter as magic, version, hash count and the bit
+// words, little endian
+func (f *bloomFilter) marshal() []byte {
+	buf := make([]byte, 0, len(bloomMagic)+2+8*len(f.bits))
+	buf = append(buf, bloomMagic...)
+	buf = append(buf, bloomVersion, byte(f.k))
+	for _, word := range f.bits {
+		buf = binary.LittleEndian.AppendUint64(buf, word)
+	}
+	return buf
+}
+
+// unmarshalBloom decodes a filter written by marshal
+func unmarshalBloom(data []byte) (*bloomFilter, error) {
+	header := len(bloomMagic) + 2
+	if len(data) < header+8 || string(data[:len(bloomMagic)]) != bloomMagic || (len(data)-header)%8 != 0 {
+		return nil, errCorruptBloom
+	}
+	if data[len(bloomMagic)] != bloomVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", errCorruptBloom, data[len(bloomMagic)])
+	}
+
+	f := &bloomFilter{k: int(data[len(bloomMagic)+1]), bits: make([]uint64, (len(data)-header)/8)}
+	for i := range f.bits {
+		f.bits[i] = binary.LittleEndian.Uint64(data[header+8*i:])
+	}
+	return f, nil
+}
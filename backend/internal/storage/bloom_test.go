@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChunkMayContain(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	labels := map[string]string{"app": "api"}
+	entries := testEntries(labels, 1000)
+	entries[500].Line = "request done trace_id=abc123"
+
+	chunkID, _, _, err := NewStoreWriter(store, 0, CompressionSnappy).WriteChunk(labels, entries)
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	reader := NewStoreReader(store)
+
+	for _, present := range []string{"trace_id=abc123", "GET /api/users/42", "ms", ""} {
+		if !reader.ChunkMayContain(labels, chunkID, []string{present}) {
+			t.Errorf("expected chunk to possibly contain %q", present)
+		}
+	}
+
+	// False positives are allowed but should be rare
+	misses := 0
+	for i := 0; i < 100; i++ {
+		if !reader.ChunkMayContain(labels, chunkID, []string{fmt.Sprintf("trace_id=zz%dq", i)}) {
+			misses++
+		}
+	}
+	if misses < 90 {
+		t.Errorf("expected most absent tokens to be ruled out, got %d of 100", misses)
+	}
+
+	// Chunks without a filter are never ruled out
+	store.Delete(bloomKey(labels, chunkID))
+	if !reader.ChunkMayContain(labels, chunkID, []string{"trace_id=zz1q"}) {
+		t.Error("expected a chunk without bloom filter to possibly match")
+	}
+}
+
+func TestBloomMarshal(t *testing.T) {
+	filter := buildBloom(testEntries(nil, 100))
+	decoded, err := unmarshalBloom(filter.marshal())
+	if err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !decoded.mayContain("GET /api/users/7 ") || decoded.k != filter.k || len(decoded.bits) != len(filter.bits) {
+		t.Fatalf("decoded filter differs: k=%d words=%d", decoded.k, len(decoded.bits))
+	}
+	if _, err := unmarshalBloom([]byte("LPBF")); err == nil {
+		t.Error("expected truncated filter to be rejected")
+	}
+}
@@ -0,0 +1,575 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+	"github.com/logpulse/backend/internal/snappy"
+	"github.com/logpulse/backend/internal/zstd"
+)
+
+// Binary chunk layout (all integers are varints unless noted):
+//
+//	header:  magic "LPCK" | version byte | compression byte |
+//	         label count | (key length, key, value length, value)...
+//	blocks:  min ts | max ts | entry count | data length |
+//	         crc32c of data (4 bytes, big endian) | data
+//	index:   version byte | compression byte | block count |
+//	         (block offset, block length, min ts, max ts)...
+//	footer:  index offset (8 bytes) | index length (4 bytes) |
+//	         crc32c of index (4 bytes) | magic "LPIX", all big endian
+//
+// The index repeats the version so blocks can be decoded without reading
+// the header. Block data is the compressed form of its entries, each
+// encoded as ts - min ts | id length | id | line length | line |
+// metadata count | (key length, key, value length, value).... Timestamps
+// are Unix nanoseconds.
+const (
+	chunkMagic   = "LPCK"
+	chunkVersion = 1
+
+	indexMagic = "LPIX"
+	footerSize = 8 + 4 + 4 + len(indexMagic)
+
+	// targetBlockSize is the uncompressed size at which a block is cut
+	targetBlockSize = 64 * 1024
+
+	// maxBlockDataSize guards against garbage lengths in corrupt chunks
+	maxBlockDataSize = 64 * 1024 * 1024
+)
+
+var (
+	ErrCorruptChunk       = errors.New("corrupt chunk")
+	ErrUnsupportedVersion = errors.New("unsupported chunk version")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// chunkChecksum returns the checksum recorded in chunk metadata
+func chunkChecksum(data []byte) string {
+	return fmt.Sprintf("%08x", crc32.Checksum(data, castagnoli))
+}
+
+// verifyChunk checks chunk data against the size and checksum in its
+// metadata. Chunks written before checksums were added are not checked.
+func verifyChunk(meta *models.ChunkMeta, data []byte) error {
+	if meta.Checksum == "" {
+		return nil
+	}
+	if int64(len(data)) != meta.Size {
+		return fmt.Errorf("%w: %d bytes, meta says %d", ErrCorruptChunk, len(data), meta.Size)
+	}
+	if sum := chunkChecksum(data); sum != meta.Checksum {
+		return fmt.Errorf("%w: checksum %s, meta says %s", ErrCorruptChunk, sum, meta.Checksum)
+	}
+	return nil
+}
+
+// Compression identifies the codec used for chunk blocks
+type Compression byte
+
+const (
+	CompressionNone   Compression = 0
+	CompressionGzip   Compression = 1
+	CompressionSnappy Compression = 2
+	CompressionZstd   Compression = 3
+)
+
+// ParseCompression converts a config value to a Compression
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "", "gzip":
+		return CompressionGzip, nil
+	case "snappy":
+		return CompressionSnappy, nil
+	case "none":
+		return CompressionNone, nil
+	case "zstd":
+		return CompressionZstd, nil
+	}
+	return 0, fmt.Errorf("unknown chunk compression %q", name)
+}
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(c))
+}
+
+// blockHeader describes one compressed block of a chunk
+type blockHeader struct {
+	minTime    int64
+	maxTime    int64
+	entryCount int
+	dataLen    int
+	checksum   uint32
+}
+
+// blockRef locates a block within a chunk
+type blockRef struct {
+	offset  int64
+	length  int64
+	minTime int64
+	maxTime int64
+}
+
+// blockIndex lists the blocks of a chunk
+type blockIndex struct {
+	compression Compression
+	blocks      []blockRef
+}
+
+// encodeChunk writes entries in the binary chunk format. Entries must be
+// sorted by timestamp.
+func encodeChunk(w io.Writer, labels map[string]string, entries []models.LogEntry, compression Compression) error {
+	bw := bufio.NewWriter(w)
+
+	// Header
+	header := []byte(chunkMagic)
+	header = append(header, chunkVersion, byte(compression))
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	header = binary.AppendUvarint(header, uint64(len(keys)))
+	for _, k := range keys {
+		header = appendString(header, k)
+		header = appendString(header, labels[k])
+	}
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	offset := int64(len(header))
+
+	// Blocks
+	index := blockIndex{compression: compression}
+	for start := 0; start < len(entries); {
+		end := start
+		size := 0
+		for end < len(entries) && (end == start || size < targetBlockSize) {
+			size += len(entries[end].ID) + len(entries[end].Line) + 16
+			for k, v := range entries[end].Metadata {
+				size += len(k) + len(v) + 2
+			}
+			end++
+		}
+
+		ref, err := writeBlock(bw, entries[start:end], compression)
+		if err != nil {
+			return err
+		}
+		ref.offset = offset
+		offset += ref.length
+		index.blocks = append(index.blocks, ref)
+		start = end
+	}
+
+	// Block index and footer
+	indexData := index.marshal()
+	footer := binary.BigEndian.AppendUint64(nil, uint64(offset))
+	footer = binary.BigEndian.AppendUint32(footer, uint32(len(indexData)))
+	footer = binary.BigEndian.AppendUint32(footer, crc32.Checksum(indexData, castagnoli))
+	footer = append(footer, indexMagic...)
+	if _, err := bw.Write(indexData); err != nil {
+		return err
+	}
+	if _, err := bw.Write(footer); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// marshal encodes the block index section of a chunk
+func (idx *blockIndex) marshal() []byte {
+	buf := []byte{chunkVersion, byte(idx.compression)}
+	buf = binary.AppendUvarint(buf, uint64(len(idx.blocks)))
+	for _, b := range idx.blocks {
+		buf = binary.AppendUvarint(buf, uint64(b.offset))
+		buf = binary.AppendUvarint(buf, uint64(b.length))
+		buf = binary.AppendVarint(buf, b.minTime)
+		buf = binary.AppendVarint(buf, b.maxTime)
+	}
+	return buf
+}
+
+// parseFooter decodes a chunk footer into the offset and length of the
+// block index and its checksum. ok is false if there is no footer.
+func parseFooter(footer []byte) (offset, length int64, checksum uint32, ok bool) {
+	if len(footer) != footerSize || string(footer[footerSize-len(indexMagic):]) != indexMagic {
+		return 0, 0, 0, false
+	}
+	offset = int64(binary.BigEndian.Uint64(footer[0:8]))
+	length = int64(binary.BigEndian.Uint32(footer[8:12]))
+	checksum = binary.BigEndian.Uint32(footer[12:16])
+	return offset, length, checksum, true
+}
+
+// unmarshalBlockIndex decodes a block index section and checks it against
+// its checksum
+func unmarshalBlockIndex(data []byte, checksum uint32) (*blockIndex, error) {
+	if crc32.Checksum(data, castagnoli) != checksum {
+		return nil, fmt.Errorf("%w: block index checksum mismatch", ErrCorruptChunk)
+	}
+
+	r := bytes.NewReader(data)
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrCorruptChunk
+	}
+	if version != chunkVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	compression, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrCorruptChunk
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(len(data)) {
+		return nil, ErrCorruptChunk
+	}
+
+	idx := &blockIndex{compression: Compression(compression), blocks: make([]blockRef, count)}
+	for i := range idx.blocks {
+		b := &idx.blocks[i]
+		offset, err1 := binary.ReadUvarint(r)
+		length, err2 := binary.ReadUvarint(r)
+		minTime, err3 := binary.ReadVarint(r)
+		maxTime, err4 := binary.ReadVarint(r)
+		if err := errors.Join(err1, err2, err3, err4); err != nil {
+			return nil, ErrCorruptChunk
+		}
+		*b = blockRef{offset: int64(offset), length: int64(length), minTime: minTime, maxTime: maxTime}
+	}
+	return idx, nil
+}
+
+// splitChunk returns the header and blocks of a binary chunk together
+// with its block index
+func splitChunk(data []byte) (blocks []byte, idx *blockIndex, err error) {
+	if len(data) < footerSize {
+		return nil, nil, ErrCorruptChunk
+	}
+
+	offset, length, checksum, ok := parseFooter(data[len(data)-footerSize:])
+	if !ok || offset+length != int64(len(data)-footerSize) || offset < 0 {
+		return nil, nil, fmt.Errorf("%w: bad footer", ErrCorruptChunk)
+	}
+	idx, err = unmarshalBlockIndex(data[offset:offset+length], checksum)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data[:offset], idx, nil
+}
+
+// overlapping returns the blocks that may hold entries within
+// [minTime, maxTime]
+func (idx *blockIndex) overlapping(minTime, maxTime int64) []blockRef {
+	var blocks []blockRef
+	for _, b := range idx.blocks {
+		if b.maxTime < minTime || b.minTime > maxTime {
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// writeBlock compresses and writes a single block, returning its length
+// and time range
+func writeBlock(w io.Writer, entries []models.LogEntry, compression Compression) (blockRef, error) {
+	minTime := entries[0].Timestamp.UnixNano()
+	maxTime := minTime
+	for _, e := range entries {
+		ts := e.Timestamp.UnixNano()
+		if ts < minTime {
+			minTime = ts
+		}
+		if ts > maxTime {
+			maxTime = ts
+		}
+	}
+
+	var raw []byte
+	for _, e := range entries {
+		raw = binary.AppendUvarint(raw, uint64(e.Timestamp.UnixNano()-minTime))
+		raw = appendString(raw, e.ID)
+		raw = appendString(raw, e.Line)
+		raw = appendMetadata(raw, e.Metadata)
+	}
+
+	data, err := compress(raw, compression)
+	if err != nil {
+		return blockRef{}, err
+	}
+
+	var header []byte
+	header = binary.AppendVarint(header, minTime)
+	header = binary.AppendVarint(header, maxTime)
+	header = binary.AppendUvarint(header, uint64(len(entries)))
+	header = binary.AppendUvarint(header, uint64(len(data)))
+	header = binary.BigEndian.AppendUint32(header, crc32.Checksum(data, castagnoli))
+
+	if _, err := w.Write(header); err != nil {
+		return blockRef{}, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return blockRef{}, err
+	}
+
+	ref := blockRef{
+		length:  int64(len(header) + len(data)),
+		minTime: minTime,
+		maxTime: maxTime,
+	}
+	return ref, nil
+}
+
+// chunkDecoder reads a binary chunk block by block
+type chunkDecoder struct {
+	r           *bufio.Reader
+	labels      map[string]string
+	compression Compression
+}
+
+// newChunkDecoder reads the chunk header. The magic must not have been
+// consumed from r yet.
+func newChunkDecoder(r *bufio.Reader) (*chunkDecoder, error) {
+	var fixed [len(chunkMagic) + 2]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, ErrCorruptChunk
+	}
+	if string(fixed[:len(chunkMagic)]) != chunkMagic {
+		return nil, ErrCorruptChunk
+	}
+	if fixed[len(chunkMagic)] != chunkVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	d := &chunkDecoder{
+		r:           r,
+		compression: Compression(fixed[len(chunkMagic)+1]),
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrCorruptChunk
+	}
+	d.labels = make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		k, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		d.labels[k] = v
+	}
+
+	return d, nil
+}
+
+// nextBlockHeader reads the next block header, returning io.EOF after the
+// last block
+func (d *chunkDecoder) nextBlockHeader() (*blockHeader, error) {
+	minTime, err := binary.ReadVarint(d.r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, ErrCorruptChunk
+	}
+
+	h := &blockHeader{minTime: minTime}
+	if h.maxTime, err = binary.ReadVarint(d.r); err != nil {
+		return nil, ErrCorruptChunk
+	}
+	count, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, ErrCorruptChunk
+	}
+	dataLen, err := binary.ReadUvarint(d.r)
+	if err != nil || dataLen > maxBlockDataSize {
+		return nil, ErrCorruptChunk
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(d.r, sum[:]); err != nil {
+		return nil, ErrCorruptChunk
+	}
+
+	h.entryCount = int(count)
+	h.dataLen = int(dataLen)
+	h.checksum = binary.BigEndian.Uint32(sum[:])
+	return h, nil
+}
+
+// readBlock decodes the entries of a block whose header was just read
+func (d *chunkDecoder) readBlock(h *blockHeader) ([]models.LogEntry, error) {
+	data := make([]byte, h.dataLen)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return nil, ErrCorruptChunk
+	}
+	if crc32.Checksum(data, castagnoli) != h.checksum {
+		return nil, fmt.Errorf("%w: block checksum mismatch", ErrCorruptChunk)
+	}
+
+	raw, err := decompress(data, d.compression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptChunk, err)
+	}
+
+	entries := make([]models.LogEntry, 0, h.entryCount)
+	br := bytes.NewReader(raw)
+	for i := 0; i < h.entryCount; i++ {
+		delta, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, ErrCorruptChunk
+		}
+		id, err := readString(br)
+		if err != nil {
+			return nil, err
+		}
+		line, err := readString(br)
+		if err != nil {
+			return nil, err
+		}
+		metadata, err := readMetadata(br)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, models.LogEntry{
+			ID:        id,
+			Timestamp: time.Unix(0, h.minTime+int64(delta)).UTC(),
+			Line:      line,
+			Labels:    d.labels,
+			Metadata:  metadata,
+		})
+	}
+
+	return entries, nil
+}
+
+func compress(raw []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return raw, nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, raw), nil
+	case CompressionZstd:
+		return zstd.Encode(nil, raw), nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(raw); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown chunk compression %d", compression)
+}
+
+func decompress(data []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		return zstd.Decode(nil, data)
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unknown chunk compression %d", compression)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendMetadata encodes entry metadata sorted by key
+func appendMetadata(b []byte, metadata map[string]string) []byte {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b = binary.AppendUvarint(b, uint64(len(keys)))
+	for _, k := range keys {
+		b = appendString(b, k)
+		b = appendString(b, metadata[k])
+	}
+	return b
+}
+
+// readMetadata decodes entry metadata, returning nil if there is none
+func readMetadata(r *bytes.Reader) (map[string]string, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(r.Len()) {
+		return nil, ErrCorruptChunk
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	metadata := make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		k, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		metadata[k] = v
+	}
+	return metadata, nil
+}
+
+func readString(r interface {
+	io.Reader
+	io.ByteReader
+}) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > maxBlockDataSize {
+		return "", ErrCorruptChunk
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", ErrCorruptChunk
+	}
+	return string(buf), nil
+}
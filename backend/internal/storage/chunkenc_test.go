@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+)
+
+func testEntries(labels map[string]string, n int) []models.LogEntry {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	entries := make([]models.LogEntry, n)
+	for i := range entries {
+		entries[i] = models.LogEntry{
+			ID:        fmt.Sprintf("id-%d", i),
+			Timestamp: base.Add(time.Duration(i) * time.Millisecond),
+			Line:      fmt.Sprintf("GET /api/users/%d 200 %dms", i%100, i%37),
+			Labels:    labels,
+		}
+	}
+	return entries
+}
+
+func TestWriteReadChunk_Compression(t *testing.T) {
+	labels := map[string]string{"app": "nginx", "env": "prod"}
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd} {
+		t.Run(compression.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			writer := NewWriter(dir, 0, compression)
+
+			// Enough entries to span several blocks, written out of order
+			entries := testEntries(labels, 5000)
+			entries[0], entries[4999] = entries[4999], entries[0]
+			entries[10].Metadata = map[string]string{"trace_id": "abc", "user": "42"}
+
+			chunkID, start, end, err := writer.WriteChunk(labels, entries)
+			if err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			if !start.Before(end) {
+				t.Errorf("expected start %v before end %v", start, end)
+			}
+
+			got, err := NewReader(dir).ReadChunk(labels, chunkID)
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if len(got) != len(entries) {
+				t.Fatalf("expected %d entries, got %d", len(entries), len(got))
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Timestamp.Before(got[i-1].Timestamp) {
+					t.Fatalf("entries not sorted at %d", i)
+				}
+			}
+			if got[0].Labels["app"] != "nginx" || got[0].ID != "id-0" {
+				t.Errorf("unexpected first entry %+v", got[0])
+			}
+			if got[10].Metadata["trace_id"] != "abc" || got[10].Metadata["user"] != "42" || got[11].Metadata != nil {
+				t.Errorf("unexpected metadata %v, %v", got[10].Metadata, got[11].Metadata)
+			}
+		})
+	}
+}
+
+func TestReadChunk_LegacyJSON(t *testing.T) {
+	dir := t.TempDir()
+	labels := map[string]string{"app": "nginx"}
+	chunkDir := filepath.Join(dir, models.Labels(labels).ToPath())
+	os.MkdirAll(chunkDir, 0755)
+
+	line := `{"id":"1","timestamp":"2024-01-15T10:00:00Z","message":"legacy line","labels":{"app":"nginx"}}` + "\n"
+	if err := os.WriteFile(filepath.Join(chunkDir, "chunk_1.log"), []byte(line), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	got, err := NewReader(dir).ReadChunk(labels, "chunk_1")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(got) != 1 || got[0].Line != "legacy line" {
+		t.Fatalf("unexpected entries %+v", got)
+	}
+}
+
+func TestReadChunk_DetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	labels := map[string]string{"app": "nginx"}
+	writer := NewWriter(dir, 0, CompressionSnappy)
+
+	chunkID, _, _, err := writer.WriteChunk(labels, testEntries(labels, 100))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	path := filepath.Join(dir, models.Labels(labels).ToPath(), chunkID+".log")
+	data, _ := os.ReadFile(path)
+	data[len(data)-10] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	if _, err := NewReader(dir).ReadChunk(labels, chunkID); err == nil {
+		t.Fatal("expected checksum error for corrupted chunk")
+	}
+}
+
+func TestIterateChunk_DetectsReplacedChunk(t *testing.T) {
+	dir := t.TempDir()
+	labels := map[string]string{"app": "nginx"}
+	writer := NewWriter(dir, 0, CompressionSnappy)
+
+	chunkID, _, _, err := writer.WriteChunk(labels, testEntries(labels, 100))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	otherID, _, _, err := writer.WriteChunk(labels, testEntries(labels, 50))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	// Another chunk's data has a valid block index of its own
+	streamDir := filepath.Join(dir, models.Labels(labels).ToPath())
+	data, _ := os.ReadFile(filepath.Join(streamDir, otherID+".log"))
+	os.WriteFile(filepath.Join(streamDir, chunkID+".log"), data, 0644)
+
+	_, err = NewReader(dir).IterateChunk(labels, chunkID, time.Time{}, time.Now(), Forward)
+	if !errors.Is(err, ErrCorruptChunk) {
+		t.Fatalf("expected ErrCorruptChunk, got %v", err)
+	}
+}
+
+func TestReadChunkFiltered_SeeksToBlocks(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	labels := map[string]string{"app": "nginx"}
+	entries := testEntries(labels, 20000)
+
+	chunkID, _, _, err := NewStoreWriter(store, 0, CompressionSnappy).WriteChunk(labels, entries)
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	reader := NewStoreReader(store)
+	start, end := entries[100].Timestamp, entries[109].Timestamp
+	got, scanned, err := reader.ReadChunkFiltered(labels, chunkID, start, end)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(got) != 10 || got[0].ID != "id-100" || got[0].Labels["app"] != "nginx" {
+		t.Fatalf("unexpected entries %d, first %+v", len(got), got[0])
+	}
+	if scanned >= len(entries) {
+		t.Fatalf("expected only some blocks to be decoded, scanned %d lines", scanned)
+	}
+
+	// A range outside the chunk decodes nothing
+	got, scanned, err = reader.ReadChunkFiltered(labels, chunkID, start.Add(-time.Hour), start.Add(-time.Minute))
+	if err != nil || len(got) != 0 || scanned != 0 {
+		t.Fatalf("expected no entries scanned, got %d, %d, %v", len(got), scanned, err)
+	}
+}
+
+func TestIterateChunk_Backward(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	labels := map[string]string{"app": "nginx"}
+	entries := testEntries(labels, 20000)
+
+	chunkID, _, _, err := NewStoreWriter(store, 0, CompressionSnappy).WriteChunk(labels, entries)
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	it, err := NewStoreReader(store).IterateChunk(labels, chunkID, entries[0].Timestamp, entries[len(entries)-1].Timestamp, Backward)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer it.Close()
+
+	// The first entries come from the last block alone
+	for i := 0; i < 5; i++ {
+		if !it.Next() {
+			t.Fatalf("iteration stopped early: %v", it.Err())
+		}
+		if want := entries[len(entries)-1-i].ID; it.At().ID != want {
+			t.Fatalf("expected %s, got %s", want, it.At().ID)
+		}
+	}
+	if it.Scanned() >= len(entries) {
+		t.Fatalf("expected a single block to be decoded, scanned %d lines", it.Scanned())
+	}
+
+	n := 5
+	for it.Next() {
+		n++
+	}
+	if it.Err() != nil || n != len(entries) || it.Scanned() != len(entries) {
+		t.Fatalf("expected all %d entries, got %d, scanned %d, %v", len(entries), n, it.Scanned(), it.Err())
+	}
+}
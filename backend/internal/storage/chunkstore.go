@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+)
+
+// ErrObjectNotFound is returned by a ChunkStore for keys it does not hold
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// ChunkStore holds chunk data and metadata objects. Keys are slash
+// separated paths relative to the store root, with a directory per stream
+// named after its label hash, such as
+// "3078aa88fee8f6ab/chunk_1700000000_1.log".
+type ChunkStore interface {
+	// Put stores data under key, replacing any existing object
+	Put(key string, data []byte) error
+	// Get opens the object stored under key
+	Get(key string) (io.ReadCloser, error)
+	// GetRange opens length bytes of the object stored under key, starting
+	// at offset
+	GetRange(key string, offset, length int64) (io.ReadCloser, error)
+	// Stat describes the object stored under key
+	Stat(key string) (ObjectInfo, error)
+	// Delete removes the object stored under key. Deleting a missing key
+	// is not an error.
+	Delete(key string) error
+	// List describes every object whose key starts with prefix
+	List(prefix string) ([]ObjectInfo, error)
+}
+
+// streamManifestName is the object in each stream directory that records
+// the stream's labels
+const streamManifestName = "stream.json"
+
+// manifestMu keeps a stream's manifest from being dropped with its last
+// chunk while a writer adds a chunk to the stream
+var manifestMu sync.Mutex
+
+// streamManifest maps a stream directory back to its label set
+type streamManifest struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// chunkKeys returns the data and metadata keys of a chunk
+func chunkKeys(labels map[string]string, chunkID string) (string, string) {
+	dir := models.Labels(labels).ToPath()
+	return path.Join(dir, chunkID+".log"), path.Join(dir, chunkID+".meta")
+}
+
+// bloomKey returns the key of a chunk's bloom filter
+func bloomKey(labels map[string]string, chunkID string) string {
+	return path.Join(models.Labels(labels).ToPath(), chunkID+".bloom")
+}
+
+// manifestKey returns the key of a stream's manifest
+func manifestKey(labels map[string]string) string {
+	return path.Join(models.Labels(labels).ToPath(), streamManifestName)
+}
+
+// readManifest decodes the stream manifest stored under key
+func readManifest(store ChunkStore, key string) (*streamManifest, error) {
+	rc, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var manifest streamManifest
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", key, err)
+	}
+	return &manifest, nil
+}
+
+// removeChunk deletes a chunk's data, metadata and bloom filter objects and
+// returns the number of bytes freed
+func removeChunk(store ChunkStore, labels map[string]string, chunkID string) (int64, error) {
+	var freed int64
+	logKey, metaKey := chunkKeys(labels, chunkID)
+
+	// Remove the metadata first so a partial delete never leaves a meta
+	// pointing at missing data
+	for _, key := range []string{metaKey, logKey, bloomKey(labels, chunkID)} {
+		info, err := store.Stat(key)
+		if errors.Is(err, ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return freed, err
+		}
+		if err := store.Delete(key); err != nil {
+			return freed, err
+		}
+		freed += info.Size
+	}
+
+	// Drop the manifest along with the last chunk of the stream, unless a
+	// writer is adding one
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	objects, err := store.List(path.Dir(logKey) + "/")
+	if err == nil && len(objects) == 1 && path.Base(objects[0].Key) == streamManifestName {
+		if err := store.Delete(objects[0].Key); err == nil {
+			freed += objects[0].Size
+		}
+	}
+	return freed, nil
+}
+
+// storeSize returns the total size of the objects in a store
+func storeSize(store ChunkStore) int64 {
+	objects, err := store.List("")
+	if err != nil {
+		return 0
+	}
+
+	var size int64
+	for _, obj := range objects {
+		size += obj.Size
+	}
+	return size
+}
+
+// tempSuffix ends the names of files being written by FSStore.Put
+const tempSuffix = ".tmp"
+
+// FSStore is a ChunkStore on the local filesystem. Writes are atomic and
+// durable once Put returns.
+type FSStore struct {
+	basePath string
+}
+
+// NewFSStore creates a filesystem chunk store rooted at basePath
+func NewFSStore(basePath string) *FSStore {
+	os.MkdirAll(basePath, 0755)
+	return &FSStore{basePath: basePath}
+}
+
+func (s *FSStore) path(key string) string {
+	return filepath.Join(s.basePath, filepath.FromSlash(key))
+}
+
+// Put writes data to a temp file, syncs it and renames it over the file
+// for key, so a crash leaves either the old file or the complete new one
+func (s *FSStore) Put(key string, data []byte) error {
+	p := s.path(key)
+	dir := filepath.Dir(p)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := syncDir(filepath.Dir(dir)); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(p)+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	// Fails harmlessly once the file has been renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes changes to a directory's entries durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// isTempFile reports whether name is a file being written by Put
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempSuffix)
+}
+
+// cleanupTemp removes temp files left behind by writes a crash interrupted
+func (s *FSStore) cleanupTemp() (int, error) {
+	removed := 0
+	err := filepath.Walk(s.basePath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !isTempFile(info.Name()) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// CleanupTempFiles removes temp files left behind in the filesystem tiers
+// of store by writes a crash interrupted. It must run before any writes.
+func CleanupTempFiles(store ChunkStore) (int, error) {
+	removed := 0
+	stores, _ := storeTiers(store)
+	for _, s := range stores {
+		fs, ok := s.(*FSStore)
+		if !ok {
+			continue
+		}
+		n, err := fs.cleanupTemp()
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// Get opens the file for key
+func (s *FSStore) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return file, err
+}
+
+// GetRange opens a section of the file for key
+func (s *FSStore) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("get %s: invalid range of %d bytes at %d", key, length, offset)
+	}
+	file, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	f := file.(*os.File)
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+// Stat describes the file for key
+func (s *FSStore) Stat(key string) (ObjectInfo, error) {
+	info, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the file for key and its directory once empty
+func (s *FSStore) Delete(key string) error {
+	p := s.path(key)
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Fails harmlessly while the directory still holds other chunks
+	if dir := filepath.Dir(p); dir != filepath.Clean(s.basePath) {
+		os.Remove(dir)
+	}
+	return nil
+}
+
+// List walks the files whose key starts with prefix
+func (s *FSStore) List(prefix string) ([]ObjectInfo, error) {
+	// Only walk the directory the prefix points into
+	root := s.basePath
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = s.path(prefix[:i])
+	}
+
+	objects := make([]ObjectInfo, 0)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || isTempFile(info.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.basePath, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return nil
+	})
+
+	return objects, err
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+)
+
+// CompactorOptions controls chunk compaction
+type CompactorOptions struct {
+	// TargetSize is the on-disk size merged chunks grow to. Chunks of at
+	// least half this size are left alone.
+	TargetSize int64
+	// Interval is the time between compaction passes
+	Interval time.Duration
+}
+
+// Compactor merges adjacent small chunks of a stream into larger chunks
+type Compactor struct {
+	reader *Reader
+	writer *Writer
+	index  *index.Index
+	opts   CompactorOptions
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// compactionCandidate is a chunk that may be merged
+type compactionCandidate struct {
+	meta models.ChunkMeta
+	size int64
+}
+
+// NewCompactor creates a compactor for the chunks written by writer
+func NewCompactor(reader *Reader, writer *Writer, idx *index.Index, opts CompactorOptions) *Compactor {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Minute
+	}
+
+	return &Compactor{
+		reader:   reader,
+		writer:   writer,
+		index:    idx,
+		opts:     opts,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins periodic compaction in the background
+func (c *Compactor) Start() {
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Stop waits for a running pass to finish and stops the compactor
+func (c *Compactor) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+func (c *Compactor) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Compact()
+		case <-c.stopChan:
+			return
+		}
+	}
+}
+
+// Compact runs a single compaction pass over every stream and returns the
+// number of source chunks that were merged
+func (c *Compactor) Compact() int {
+	start := time.Now()
+	streams := c.index.StreamChunks()
+	compactionStarted(len(streams))
+
+	merged := 0
+	for _, metas := range streams {
+		select {
+		case <-c.stopChan:
+			compactionFinished(time.Since(start))
+			return merged
+		default:
+		}
+
+		for _, group := range c.plan(metas) {
+			n, err := c.merge(group)
+			if err != nil {
+				log.Printf("Compaction of %d chunks failed: %v", len(group), err)
+				continue
+			}
+			merged += n
+		}
+		compactionProgress()
+	}
+
+	compactionFinished(time.Since(start))
+	if merged > 0 {
+		log.Printf("Compaction: merged %d chunks in %v", merged, time.Since(start))
+	}
+	return merged
+}
+
+// plan groups runs of adjacent small chunks of one stream so that each
+// group stays within the target size
+func (c *Compactor) plan(metas []models.ChunkMeta) [][]compactionCandidate {
+	var groups [][]compactionCandidate
+	var group []compactionCandidate
+	var groupSize int64
+
+	closeGroup := func() {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+		group = nil
+		groupSize = 0
+	}
+
+	for _, meta := range metas {
+		// Cold chunks are left alone rather than merged back into the hot tier
+		if meta.Tier == TierCold {
+			closeGroup()
+			continue
+		}
+
+		logKey, _ := chunkKeys(meta.Labels, meta.ID)
+		info, err := c.writer.store.Stat(logKey)
+		if err != nil {
+			closeGroup()
+			continue
+		}
+
+		size := info.Size
+		if size*2 >= c.opts.TargetSize {
+			closeGroup()
+			continue
+		}
+		if groupSize+size > c.opts.TargetSize {
+			closeGroup()
+		}
+
+		group = append(group, compactionCandidate{meta: meta, size: size})
+		groupSize += size
+	}
+	closeGroup()
+
+	return groups
+}
+
+// merge writes the entries of group to a new chunk, swaps it into the index
+// and deletes the originals. It returns the number of source chunks merged.
+func (c *Compactor) merge(group []compactionCandidate) (int, error) {
+	labels := group[0].meta.Labels
+
+	var entries []models.LogEntry
+	var inputBytes int64
+	for _, cand := range group {
+		chunkEntries, err := c.reader.ReadChunk(labels, cand.meta.ID)
+		if err != nil {
+			return 0, err
+		}
+		entries = append(entries, chunkEntries...)
+		inputBytes += cand.size
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	chunkID, startTime, endTime, err := c.writer.WriteChunk(labels, entries)
+	if err != nil {
+		return 0, err
+	}
+
+	replaced := make([]string, len(group))
+	for i, cand := range group {
+		replaced[i] = cand.meta.ID
+	}
+
+	// The index swap is the commit point; until then queries keep reading
+	// the original chunks
+	if !c.index.ReplaceChunks(replaced, chunkID, labels, startTime, endTime, len(entries)) {
+		removeChunk(c.writer.store, labels, chunkID)
+		return 0, nil
+	}
+
+	for _, id := range replaced {
+		if _, err := removeChunk(c.writer.store, labels, id); err != nil {
+			log.Printf("Failed to delete compacted chunk %s: %v", id, err)
+		}
+	}
+
+	var outputBytes int64
+	logKey, _ := chunkKeys(labels, chunkID)
+	if info, err := c.writer.store.Stat(logKey); err == nil {
+		outputBytes = info.Size
+	}
+
+	recordCompaction(len(group), inputBytes-outputBytes)
+	return len(group), nil
+}
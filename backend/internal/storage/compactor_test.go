@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+)
+
+func TestCompactor_MergesSmallChunks(t *testing.T) {
+	dir := t.TempDir()
+	labels := map[string]string{"app": "nginx"}
+	writer := NewWriter(dir, 0, CompressionSnappy)
+	reader := NewReader(dir)
+	idx := index.NewIndex()
+
+	entries := testEntries(labels, 50)
+	var original []string
+	for i := 0; i < 5; i++ {
+		chunkID, start, end, err := writer.WriteChunk(labels, entries[i*10:(i+1)*10])
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		idx.AddChunk(chunkID, labels, start, end, 10)
+		original = append(original, chunkID)
+	}
+
+	compactor := NewCompactor(reader, writer, idx, CompactorOptions{TargetSize: 1024 * 1024})
+	if merged := compactor.Compact(); merged != 5 {
+		t.Fatalf("expected 5 chunks merged, got %d", merged)
+	}
+
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	chunks := idx.FindChunks(labels, start, start.Add(24*time.Hour))
+	if len(chunks) != 1 {
+		t.Fatalf("expected a single chunk after compaction, got %v", chunks)
+	}
+
+	got, err := reader.ReadChunk(labels, chunks[0])
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(got) != 50 || got[0].ID != "id-0" || got[49].ID != "id-49" {
+		t.Fatalf("unexpected merged entries: %d", len(got))
+	}
+
+	for _, id := range original {
+		logKey, metaKey := chunkKeys(labels, id)
+		for _, key := range []string{logKey, metaKey} {
+			if _, err := writer.store.Stat(key); !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("expected %s to be deleted", key)
+			}
+		}
+	}
+
+	if stats := GetStats(); stats.CompactedChunks < 5 || stats.CompactionBytesSaved <= 0 {
+		t.Errorf("unexpected compaction stats %+v", stats)
+	}
+}
@@ -0,0 +1,394 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+)
+
+// deletesKey is the object holding delete requests
+const deletesKey = "deletes.json"
+
+// Delete request states
+const (
+	DeleteReceived  = "received"
+	DeleteProcessed = "processed"
+)
+
+// ErrDeleteNotFound is returned when cancelling an unknown delete request
+var ErrDeleteNotFound = errors.New("delete request not found")
+
+// ErrDeleteStarted is returned when cancelling a delete request that has
+// already removed entries
+var ErrDeleteStarted = errors.New("delete request already started")
+
+// DeleteSelector decides which entries a delete request covers
+type DeleteSelector struct {
+	Matchers  []index.Matcher
+	MatchLine func(line string) bool // nil for every line
+}
+
+// DeleteRequest removes the entries of streams matching Query between
+// Start and End
+type DeleteRequest struct {
+	ID             string    `json:"id"`
+	Query          string    `json:"query"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	CreatedAt      time.Time `json:"createdAt"`
+	Status         string    `json:"status"`
+	DeletedEntries int64     `json:"deletedEntries"`
+}
+
+// pendingDelete is a delete request with its compiled selector
+type pendingDelete struct {
+	DeleteRequest
+	selector *DeleteSelector
+}
+
+// covers reports whether the request deletes an entry, given that it
+// matches the entry's stream
+func (p *pendingDelete) covers(entry models.LogEntry) bool {
+	if entry.Timestamp.Before(p.Start) || entry.Timestamp.After(p.End) {
+		return false
+	}
+	return p.selector.MatchLine == nil || p.selector.MatchLine(entry.Line)
+}
+
+// DeleterOptions controls how delete requests are applied
+type DeleterOptions struct {
+	// Parse compiles the query of a delete request
+	Parse func(query string) (*DeleteSelector, error)
+	// Interval is the time between passes over pending requests
+	Interval time.Duration
+	// FlushGrace is how long after its end time a request keeps being
+	// applied, so that entries still buffered when it was made are
+	// removed once they reach a chunk
+	FlushGrace time.Duration
+}
+
+// Deleter removes log entries on request. Requests are stored alongside
+// the chunks and applied by rewriting the affected chunks; until a
+// request is processed, queries hide the entries it covers.
+type Deleter struct {
+	reader *Reader
+	writer *Writer
+	index  *index.Index
+	opts   DeleterOptions
+
+	mu       sync.RWMutex
+	requests []*pendingDelete
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewDeleter creates a deleter for the chunks written by writer, loading
+// any stored requests
+func NewDeleter(reader *Reader, writer *Writer, idx *index.Index, opts DeleterOptions) (*Deleter, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Minute
+	}
+
+	d := &Deleter{
+		reader:   reader,
+		writer:   writer,
+		index:    idx,
+		opts:     opts,
+		stopChan: make(chan struct{}),
+	}
+
+	data, err := readObject(writer.store, deletesKey)
+	if errors.Is(err, ErrObjectNotFound) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []DeleteRequest
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", deletesKey, err)
+	}
+	for _, req := range stored {
+		selector, err := opts.Parse(req.Query)
+		if err != nil {
+			return nil, fmt.Errorf("delete request %s: %w", req.ID, err)
+		}
+		d.requests = append(d.requests, &pendingDelete{DeleteRequest: req, selector: selector})
+	}
+	d.updatePending()
+	return d, nil
+}
+
+// Start begins applying delete requests in the background
+func (d *Deleter) Start() {
+	d.wg.Add(1)
+	go d.run()
+}
+
+// Stop waits for a running pass to finish and stops the deleter
+func (d *Deleter) Stop() {
+	close(d.stopChan)
+	d.wg.Wait()
+}
+
+func (d *Deleter) run() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.Process()
+		case <-d.stopChan:
+			return
+		}
+	}
+}
+
+// Add stores a delete request. Its entries are hidden from queries at once.
+func (d *Deleter) Add(query string, start, end time.Time) (DeleteRequest, error) {
+	if end.Before(start) {
+		return DeleteRequest{}, errors.New("end must not be before start")
+	}
+	selector, err := d.opts.Parse(query)
+	if err != nil {
+		return DeleteRequest{}, err
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return DeleteRequest{}, err
+	}
+	req := &pendingDelete{
+		DeleteRequest: DeleteRequest{
+			ID:        hex.EncodeToString(id[:]),
+			Query:     query,
+			Start:     start,
+			End:       end,
+			CreatedAt: time.Now(),
+			Status:    DeleteReceived,
+		},
+		selector: selector,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests = append(d.requests, req)
+	if err := d.saveLocked(); err != nil {
+		d.requests = d.requests[:len(d.requests)-1]
+		return DeleteRequest{}, err
+	}
+	d.updatePendingLocked()
+	return req.DeleteRequest, nil
+}
+
+// Cancel drops a delete request that has not removed any entries yet
+func (d *Deleter) Cancel(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, req := range d.requests {
+		if req.ID != id {
+			continue
+		}
+		if req.Status != DeleteReceived || req.DeletedEntries > 0 {
+			return ErrDeleteStarted
+		}
+
+		requests := append(append([]*pendingDelete{}, d.requests[:i]...), d.requests[i+1:]...)
+		old := d.requests
+		d.requests = requests
+		if err := d.saveLocked(); err != nil {
+			d.requests = old
+			return err
+		}
+		d.updatePendingLocked()
+		return nil
+	}
+	return ErrDeleteNotFound
+}
+
+// Requests returns every stored delete request
+func (d *Deleter) Requests() []DeleteRequest {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	requests := make([]DeleteRequest, len(d.requests))
+	for i, req := range d.requests {
+		requests[i] = req.DeleteRequest
+	}
+	return requests
+}
+
+// Hides reports whether a pending delete request covers an entry. It is
+// safe to call on a nil Deleter.
+func (d *Deleter) Hides(entry models.LogEntry) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, req := range d.requests {
+		if req.Status == DeleteReceived && req.covers(entry) && index.MatchLabels(req.selector.Matchers, entry.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// Process applies every pending delete request once and returns the
+// number of entries removed. A request is processed after a pass that
+// finds nothing left to delete once its flush grace period is over.
+func (d *Deleter) Process() int {
+	d.mu.RLock()
+	var pending []*pendingDelete
+	for _, req := range d.requests {
+		if req.Status == DeleteReceived {
+			pending = append(pending, req)
+		}
+	}
+	d.mu.RUnlock()
+
+	total := 0
+	for _, req := range pending {
+		select {
+		case <-d.stopChan:
+			return total
+		default:
+		}
+
+		passStart := time.Now()
+		removed, complete := d.apply(req)
+		total += removed
+
+		d.mu.Lock()
+		req.DeletedEntries += int64(removed)
+		if complete && removed == 0 && passStart.After(req.End.Add(d.opts.FlushGrace)) {
+			req.Status = DeleteProcessed
+		}
+		if err := d.saveLocked(); err != nil {
+			log.Printf("Failed to save delete requests: %v", err)
+		}
+		d.updatePendingLocked()
+		d.mu.Unlock()
+	}
+
+	if total > 0 {
+		log.Printf("Deletion: removed %d entries", total)
+	}
+	return total
+}
+
+// apply removes a request's entries from every chunk it covers. complete
+// is false if any chunk could not be rewritten.
+func (d *Deleter) apply(req *pendingDelete) (removed int, complete bool) {
+	complete = true
+	for _, chunkID := range d.index.FindChunksMatching(req.selector.Matchers, req.Start, req.End) {
+		meta := d.index.GetChunkMeta(chunkID)
+		if meta == nil {
+			continue
+		}
+
+		n, err := d.rewriteChunk(req, meta)
+		if err != nil {
+			log.Printf("Failed to apply delete request %s to chunk %s: %v", req.ID, chunkID, err)
+			complete = false
+			continue
+		}
+		removed += n
+	}
+	return removed, complete
+}
+
+// errChunkReplaced is returned when a chunk left the index while it was
+// being rewritten
+var errChunkReplaced = errors.New("chunk was replaced while rewriting")
+
+// rewriteChunk replaces a chunk with a copy that lacks the entries req
+// covers, or removes it if nothing is left. It returns the number of
+// entries removed.
+func (d *Deleter) rewriteChunk(req *pendingDelete, meta *models.ChunkMeta) (int, error) {
+	entries, err := d.reader.ForTier(meta.Tier).ReadChunk(meta.Labels, meta.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := make([]models.LogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !req.covers(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := len(entries) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// As in compaction, the index change is the commit point. A chunk
+	// replaced meanwhile is picked up again by the next pass, so its
+	// entries are only counted then.
+	if len(kept) == 0 {
+		if !d.index.RemoveChunk(meta.ID) {
+			return 0, errChunkReplaced
+		}
+	} else {
+		// The copy stays in the tier of the original
+		chunkID, startTime, endTime, err := d.writer.WriteChunkToTier(meta.Tier, meta.Labels, kept)
+		if err != nil {
+			return 0, err
+		}
+		if !d.index.ReplaceChunksInTier([]string{meta.ID}, chunkID, meta.Tier, meta.Labels, startTime, endTime, len(kept)) {
+			removeChunk(d.writer.store, meta.Labels, chunkID)
+			return 0, errChunkReplaced
+		}
+	}
+
+	if _, err := removeChunk(d.writer.store, meta.Labels, meta.ID); err != nil {
+		log.Printf("Failed to delete rewritten chunk %s: %v", meta.ID, err)
+	}
+	recordDeletion(len(kept) > 0, removed)
+	return removed, nil
+}
+
+// saveLocked stores the delete requests. Caller must hold d.mu.
+func (d *Deleter) saveLocked() error {
+	stored := make([]DeleteRequest, len(d.requests))
+	for i, req := range d.requests {
+		stored[i] = req.DeleteRequest
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return d.writer.store.Put(deletesKey, append(data, '\n'))
+}
+
+func (d *Deleter) updatePending() {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	d.updatePendingLocked()
+}
+
+// updatePendingLocked publishes the number of pending requests. Caller
+// must hold d.mu.
+func (d *Deleter) updatePendingLocked() {
+	pending := 0
+	for _, req := range d.requests {
+		if req.Status == DeleteReceived {
+			pending++
+		}
+	}
+	setPendingDeletes(pending)
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+)
+
+// parseTestDelete accepts queries of the form `app|substring`
+func parseTestDelete(query string) (*DeleteSelector, error) {
+	app, substring, ok := strings.Cut(query, "|")
+	if !ok {
+		return nil, errors.New("bad query")
+	}
+	return &DeleteSelector{
+		Matchers:  []index.Matcher{{Name: "app", Value: app, Type: index.MatchEqual}},
+		MatchLine: func(line string) bool { return strings.Contains(line, substring) },
+	}, nil
+}
+
+func TestDeleter(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	writer := NewStoreWriter(store, 0, CompressionSnappy)
+	reader := NewStoreReader(store)
+	idx := index.NewIndex()
+	labels := map[string]string{"app": "nginx"}
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	// The first chunk mixes two users, the second holds only the one to
+	// delete
+	var ids []string
+	for c, users := range [][]int{{42, 7}, {42}} {
+		entries := make([]models.LogEntry, 10)
+		for i := range entries {
+			entries[i] = models.LogEntry{
+				ID:        fmt.Sprintf("%d-%d", c, i),
+				Timestamp: base.Add(time.Duration(c*10+i) * time.Second),
+				Line:      fmt.Sprintf("login user=%d", users[i%len(users)]),
+				Labels:    labels,
+			}
+		}
+		chunkID, start, end, err := writer.WriteChunk(labels, entries)
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		idx.AddChunk(chunkID, labels, start, end, len(entries))
+		ids = append(ids, chunkID)
+	}
+
+	opts := DeleterOptions{Parse: parseTestDelete}
+	deleter, err := NewDeleter(reader, writer, idx, opts)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := deleter.Add("nginx", base, base.Add(time.Hour)); err == nil {
+		t.Fatal("expected an invalid query to be rejected")
+	}
+	req, err := deleter.Add("nginx|user=42", base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	// Queries hide covered entries before anything is rewritten
+	hidden := models.LogEntry{Timestamp: base, Line: "login user=42", Labels: labels}
+	if !deleter.Hides(hidden) || deleter.Hides(models.LogEntry{Timestamp: base, Line: "login user=7", Labels: labels}) {
+		t.Fatal("expected only the covered entry to be hidden")
+	}
+
+	if removed := deleter.Process(); removed != 15 {
+		t.Fatalf("expected 15 entries removed, got %d", removed)
+	}
+	if idx.GetChunkMeta(ids[0]) != nil || idx.GetChunkMeta(ids[1]) != nil {
+		t.Fatal("expected both original chunks to leave the index")
+	}
+	if _, err := reader.ReadChunk(labels, ids[1]); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected the emptied chunk to be deleted, got %v", err)
+	}
+
+	chunks := idx.FindChunksMatching([]index.Matcher{{Name: "app", Value: "nginx", Type: index.MatchEqual}}, base, base.Add(time.Hour))
+	if len(chunks) != 1 {
+		t.Fatalf("expected 1 rewritten chunk, got %v", chunks)
+	}
+	entries, err := reader.ReadChunk(labels, chunks[0])
+	if err != nil || len(entries) != 5 {
+		t.Fatalf("expected 5 entries left, got %d, %v", len(entries), err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Line, "user=42") {
+			t.Fatalf("deleted entry survived: %+v", entry)
+		}
+	}
+
+	// A pass with nothing left to delete completes the request
+	if removed := deleter.Process(); removed != 0 {
+		t.Fatalf("expected nothing left to remove, got %d", removed)
+	}
+	if deleter.Hides(hidden) {
+		t.Error("expected processed requests to stop filtering queries")
+	}
+
+	// Requests survive a restart
+	reloaded, err := NewDeleter(reader, writer, idx, opts)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	requests := reloaded.Requests()
+	if len(requests) != 1 || requests[0].ID != req.ID || requests[0].Status != DeleteProcessed || requests[0].DeletedEntries != 15 {
+		t.Fatalf("unexpected requests after reload %+v", requests)
+	}
+	if err := reloaded.Cancel(req.ID); !errors.Is(err, ErrDeleteStarted) {
+		t.Fatalf("expected ErrDeleteStarted, got %v", err)
+	}
+}
+
+func TestDeleter_CountsOnlyCommittedRewrites(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	writer := NewStoreWriter(store, 0, CompressionSnappy)
+	idx := index.NewIndex()
+	labels := map[string]string{"app": "nginx"}
+
+	chunkID, start, end, err := writer.WriteChunk(labels, testEntries(labels, 10))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	idx.AddChunk(chunkID, labels, start, end, 10)
+
+	deleter, err := NewDeleter(NewStoreReader(store), writer, idx, DeleterOptions{Parse: parseTestDelete})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := deleter.Add("nginx|GET", start, end); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	// A chunk compacted away after it was looked up is not counted
+	meta := *idx.GetChunkMeta(chunkID)
+	idx.RemoveChunk(chunkID)
+	before := GetStats().DeletedEntries
+	if n, err := deleter.rewriteChunk(deleter.requests[0], &meta); n != 0 || !errors.Is(err, errChunkReplaced) {
+		t.Fatalf("expected errChunkReplaced, got %d, %v", n, err)
+	}
+	if GetStats().DeletedEntries != before {
+		t.Error("expected no deletion to be recorded")
+	}
+}
+
+func TestDeleter_KeepsColdChunksCold(t *testing.T) {
+	hot, cold := NewFSStore(t.TempDir()), NewFSStore(t.TempDir())
+	store := NewTieredStore(hot, cold)
+	writer := NewStoreWriter(store, 0, CompressionSnappy)
+	reader := NewStoreReader(store)
+	idx := index.NewIndex()
+	labels := map[string]string{"app": "nginx"}
+
+	chunkID, start, end, err := writer.WriteChunk(labels, testEntries(labels, 10))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	idx.AddChunk(chunkID, labels, start, end, 10)
+	if moved := NewMigrator(store, idx, MigratorOptions{MinAge: time.Hour}).Migrate(); moved != 1 {
+		t.Fatalf("expected the chunk to move to the cold tier, moved %d", moved)
+	}
+
+	deleter, err := NewDeleter(reader, writer, idx, DeleterOptions{Parse: parseTestDelete})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := deleter.Add("nginx|/api/users/1 ", start, end); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if removed := deleter.Process(); removed != 1 {
+		t.Fatalf("expected 1 entry removed, got %d", removed)
+	}
+
+	chunks := idx.FindChunksMatching([]index.Matcher{{Name: "app", Value: "nginx", Type: index.MatchEqual}}, start, end)
+	if len(chunks) != 1 {
+		t.Fatalf("expected 1 rewritten chunk, got %v", chunks)
+	}
+	if meta := idx.GetChunkMeta(chunks[0]); meta.Tier != TierCold {
+		t.Errorf("expected the rewritten chunk in the cold tier, got %q", meta.Tier)
+	}
+	logKey, _ := chunkKeys(labels, chunks[0])
+	if _, err := cold.Stat(logKey); err != nil {
+		t.Errorf("expected the rewritten chunk in the cold store: %v", err)
+	}
+	if _, err := hot.Stat(logKey); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected nothing written to the hot store, got %v", err)
+	}
+}
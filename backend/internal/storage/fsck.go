@@ -0,0 +1,360 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+)
+
+// FsckOptions controls what Fsck does about the problems it finds. With
+// neither set Fsck only reports.
+type FsckOptions struct {
+	// Repair rebuilds missing or outdated chunk metadata, deletes metadata
+	// without data and brings the index in line with the store
+	Repair bool
+	// Quarantine receives corrupt chunks and orphaned objects, which are
+	// then removed from the store and the index
+	Quarantine ChunkStore
+}
+
+// FsckIssue is a problem found by Fsck
+type FsckIssue struct {
+	Key     string
+	Problem string
+	Action  string // what was done about it, "" if nothing
+}
+
+// FsckReport lists what Fsck checked and found
+type FsckReport struct {
+	Chunks int // chunks with both data and metadata
+	Issues []FsckIssue
+}
+
+// Unresolved returns the number of issues that were left as they are
+func (r *FsckReport) Unresolved() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Action == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// fsck holds the state of a single Fsck run
+type fsck struct {
+	store  ChunkStore
+	reader *Reader
+	index  *index.Index
+	opts   FsckOptions
+	report *FsckReport
+	seen   map[string]struct{} // chunk IDs with valid data and metadata
+	keys   map[string]struct{} // every key in the store
+}
+
+// Fsck verifies every chunk in store against its metadata and the index,
+// and finds orphaned .log and .meta objects. It must not run while a
+// server is writing to the store.
+func Fsck(store ChunkStore, idx *index.Index, opts FsckOptions) (*FsckReport, error) {
+	objects, err := store.List("")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	keys := make(map[string]struct{}, len(objects))
+	for _, obj := range objects {
+		keys[obj.Key] = struct{}{}
+	}
+
+	f := &fsck{
+		store:  store,
+		reader: &Reader{store: store},
+		index:  idx,
+		opts:   opts,
+		report: &FsckReport{},
+		seen:   make(map[string]struct{}),
+		keys:   keys,
+	}
+
+	for _, obj := range objects {
+		switch path.Ext(obj.Key) {
+		case ".meta":
+			logKey := strings.TrimSuffix(obj.Key, ".meta") + ".log"
+			if _, ok := keys[logKey]; ok {
+				f.checkChunk(obj.Key, logKey)
+			} else {
+				f.orphanMeta(obj.Key)
+			}
+		case ".log":
+			if _, ok := keys[strings.TrimSuffix(obj.Key, ".log")+".meta"]; !ok {
+				f.orphanLog(obj.Key)
+			}
+		case ".bloom":
+			if _, ok := keys[strings.TrimSuffix(obj.Key, ".bloom")+".log"]; !ok {
+				f.orphanBloom(obj.Key)
+			}
+		}
+	}
+
+	// Indexed chunks whose objects are gone
+	for _, meta := range idx.ChunksByEndTime() {
+		if _, ok := f.seen[meta.ID]; ok {
+			continue
+		}
+		logKey, metaKey := chunkKeys(meta.Labels, meta.ID)
+		_, hasLog := keys[logKey]
+		_, hasMeta := keys[metaKey]
+		if hasLog || hasMeta {
+			continue // reported above as a corrupt or orphaned chunk
+		}
+		f.issue(logKey, "indexed chunk missing from store", func() (string, error) {
+			if !opts.Repair {
+				return "", nil
+			}
+			idx.RemoveChunk(meta.ID)
+			return "removed from index", nil
+		})
+	}
+
+	return f.report, nil
+}
+
+// issue records a problem and what fix did about it
+func (f *fsck) issue(key, problem string, fix func() (string, error)) {
+	action, err := fix()
+	if err != nil {
+		action = ""
+		problem = fmt.Sprintf("%s (fix failed: %v)", problem, err)
+	}
+	f.report.Issues = append(f.report.Issues, FsckIssue{Key: key, Problem: problem, Action: action})
+}
+
+// checkChunk verifies a chunk's metadata, data and index entry
+func (f *fsck) checkChunk(metaKey, logKey string) {
+	f.report.Chunks++
+	chunkID := strings.TrimSuffix(path.Base(metaKey), ".meta")
+
+	meta, err := f.reader.readMeta(metaKey)
+	if err != nil {
+		f.corrupt(chunkID, metaKey, logKey, fmt.Sprintf("unreadable metadata: %v", err))
+		return
+	}
+	if wantLog, _ := chunkKeys(meta.Labels, meta.ID); meta.ID != chunkID || wantLog != logKey {
+		f.corrupt(chunkID, metaKey, logKey, fmt.Sprintf("metadata describes chunk %s of %v", meta.ID, meta.Labels))
+		return
+	}
+
+	data, err := readObject(f.store, logKey)
+	if err != nil {
+		f.issue(logKey, fmt.Sprintf("unreadable data: %v", err), noFix)
+		return
+	}
+	if err := verifyChunk(meta, data); err != nil {
+		f.corrupt(chunkID, metaKey, logKey, err.Error())
+		return
+	}
+	entries, err := decodeChunk(data)
+	if err != nil {
+		f.corrupt(chunkID, metaKey, logKey, err.Error())
+		return
+	}
+	if len(entries) != meta.EntryCount {
+		f.corrupt(chunkID, metaKey, logKey, fmt.Sprintf("%d entries, metadata says %d", len(entries), meta.EntryCount))
+		return
+	}
+	f.seen[chunkID] = struct{}{}
+
+	if meta.Checksum == "" {
+		f.issue(metaKey, "no checksum", func() (string, error) {
+			if !f.opts.Repair {
+				return "", nil
+			}
+			meta.Size = int64(len(data))
+			meta.Checksum = chunkChecksum(data)
+			return "added checksum", putMeta(f.store, metaKey, meta)
+		})
+	}
+
+	f.checkIndexed(logKey, meta)
+}
+
+// checkIndexed compares a valid chunk with its index entry
+func (f *fsck) checkIndexed(logKey string, meta *models.ChunkMeta) {
+	indexed := f.index.GetChunkMeta(meta.ID)
+	if indexed != nil && indexed.StartTime == meta.StartTime && indexed.EndTime == meta.EndTime &&
+		indexed.EntryCount == meta.EntryCount && maps.Equal(indexed.Labels, meta.Labels) {
+		return
+	}
+
+	problem := "chunk missing from index"
+	if indexed != nil {
+		problem = "index entry differs from metadata"
+	}
+	f.issue(logKey, problem, func() (string, error) {
+		if !f.opts.Repair {
+			return "", nil
+		}
+		f.index.AddChunk(meta.ID, meta.Labels, time.Unix(meta.StartTime, 0), time.Unix(meta.EndTime, 0), meta.EntryCount)
+		if indexed != nil && indexed.Tier != TierHot {
+			f.index.SetChunkTier(meta.ID, indexed.Tier)
+		}
+		return "indexed", nil
+	})
+}
+
+// corrupt reports a chunk whose data or metadata is damaged. It can only
+// be quarantined.
+func (f *fsck) corrupt(chunkID, metaKey, logKey, problem string) {
+	keys := []string{metaKey, logKey}
+	if bloom := strings.TrimSuffix(logKey, ".log") + ".bloom"; f.has(bloom) {
+		keys = append(keys, bloom)
+	}
+	f.issue(logKey, problem, func() (string, error) {
+		return f.quarantine(chunkID, keys...)
+	})
+}
+
+// has reports whether the store held key when the run started
+func (f *fsck) has(key string) bool {
+	_, ok := f.keys[key]
+	return ok
+}
+
+// orphanBloom reports a bloom filter whose chunk data is missing
+func (f *fsck) orphanBloom(key string) {
+	f.issue(key, "bloom filter without chunk data", func() (string, error) {
+		if !f.opts.Repair && f.opts.Quarantine == nil {
+			return "", nil
+		}
+		return "deleted", f.store.Delete(key)
+	})
+}
+
+// orphanMeta reports metadata whose chunk data is missing
+func (f *fsck) orphanMeta(metaKey string) {
+	chunkID := strings.TrimSuffix(path.Base(metaKey), ".meta")
+	f.issue(metaKey, "metadata without chunk data", func() (string, error) {
+		if f.opts.Quarantine != nil {
+			return f.quarantine(chunkID, metaKey)
+		}
+		if !f.opts.Repair {
+			return "", nil
+		}
+		f.index.RemoveChunk(chunkID)
+		return "deleted", f.store.Delete(metaKey)
+	})
+}
+
+// orphanLog reports chunk data whose metadata is missing. Repair rebuilds
+// the metadata if the data decodes.
+func (f *fsck) orphanLog(logKey string) {
+	chunkID := strings.TrimSuffix(path.Base(logKey), ".log")
+	f.issue(logKey, "chunk data without metadata", func() (string, error) {
+		if f.opts.Repair {
+			if meta, err := f.rebuildMeta(chunkID, logKey); err == nil {
+				f.seen[chunkID] = struct{}{}
+				f.checkIndexed(logKey, meta)
+				return "rebuilt metadata", nil
+			}
+		}
+		if f.opts.Quarantine != nil {
+			return f.quarantine(chunkID, logKey)
+		}
+		return "", nil
+	})
+}
+
+// rebuildMeta recreates a chunk's metadata from its data
+func (f *fsck) rebuildMeta(chunkID, logKey string) (*models.ChunkMeta, error) {
+	data, err := readObject(f.store, logKey)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := decodeChunk(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no entries", ErrCorruptChunk)
+	}
+
+	labels := entries[0].Labels
+	wantLog, metaKey := chunkKeys(labels, chunkID)
+	if wantLog != logKey {
+		return nil, fmt.Errorf("%w: entries belong to %v", ErrCorruptChunk, labels)
+	}
+
+	// Legacy JSON chunks are not necessarily sorted
+	start, end := entries[0].Timestamp, entries[0].Timestamp
+	for _, entry := range entries[1:] {
+		if entry.Timestamp.Before(start) {
+			start = entry.Timestamp
+		}
+		if entry.Timestamp.After(end) {
+			end = entry.Timestamp
+		}
+	}
+
+	meta := &models.ChunkMeta{
+		ID:         chunkID,
+		Labels:     labels,
+		StartTime:  start.Unix(),
+		EndTime:    end.Unix(),
+		EntryCount: len(entries),
+		Size:       int64(len(data)),
+		Checksum:   chunkChecksum(data),
+	}
+	return meta, putMeta(f.store, metaKey, meta)
+}
+
+// quarantine moves a chunk's objects to the quarantine store and drops the
+// chunk from the index
+func (f *fsck) quarantine(chunkID string, keys ...string) (string, error) {
+	if f.opts.Quarantine == nil {
+		return "", nil
+	}
+	for _, key := range keys {
+		if _, err := copyObject(f.store, key, f.opts.Quarantine, key); err != nil {
+			return "", err
+		}
+	}
+	f.index.RemoveChunk(chunkID)
+	for _, key := range keys {
+		if err := f.store.Delete(key); err != nil {
+			return "", err
+		}
+	}
+	return "quarantined", nil
+}
+
+func noFix() (string, error) {
+	return "", nil
+}
+
+// readObject reads a whole object
+func readObject(store ChunkStore, key string) ([]byte, error) {
+	rc, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// putMeta writes chunk metadata the way the writer does
+func putMeta(store ChunkStore, key string, meta *models.ChunkMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return store.Put(key, append(data, '\n'))
+}
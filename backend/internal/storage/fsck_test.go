@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+)
+
+func TestReadChunk_DetectsTruncation(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	labels := map[string]string{"app": "nginx"}
+	chunkID, _, _, err := NewStoreWriter(store, 0, CompressionNone).WriteChunk(labels, testEntries(labels, 10))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	// Drop the last byte of the chunk
+	logKey, _ := chunkKeys(labels, chunkID)
+	data, _ := readObject(store, logKey)
+	store.Put(logKey, data[:len(data)-1])
+
+	before := GetStats().CorruptChunksRead
+	if _, err := NewStoreReader(store).ReadChunk(labels, chunkID); !errors.Is(err, ErrCorruptChunk) {
+		t.Fatalf("expected ErrCorruptChunk, got %v", err)
+	}
+	if GetStats().CorruptChunksRead != before+1 {
+		t.Error("expected corrupt chunk to be counted")
+	}
+}
+
+func TestFsck(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	quarantine := NewFSStore(t.TempDir())
+	writer := NewStoreWriter(store, 0, CompressionSnappy)
+	idx := index.NewIndex()
+	labels := map[string]string{"app": "nginx"}
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		chunkID, start, end, err := writer.WriteChunk(labels, testEntries(labels, 10))
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		idx.AddChunk(chunkID, labels, start, end, 10)
+		ids = append(ids, chunkID)
+	}
+
+	// ids[0] stays healthy, ids[1] gets a flipped byte, ids[2] loses its
+	// metadata and ids[3] its data, orphaning its bloom filter
+	logKey, metaKey := chunkKeys(labels, ids[1])
+	data, _ := readObject(store, logKey)
+	data[len(data)/2] ^= 0xff
+	store.Put(logKey, data)
+	_, metaKey2 := chunkKeys(labels, ids[2])
+	store.Delete(metaKey2)
+	logKey3, _ := chunkKeys(labels, ids[3])
+	store.Delete(logKey3)
+
+	report, err := Fsck(store, idx, FsckOptions{})
+	if err != nil {
+		t.Fatalf("fsck failed: %v", err)
+	}
+	if report.Chunks != 2 || len(report.Issues) != 4 || report.Unresolved() != 4 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	report, err = Fsck(store, idx, FsckOptions{Repair: true, Quarantine: quarantine})
+	if err != nil {
+		t.Fatalf("fsck failed: %v", err)
+	}
+	if report.Unresolved() != 0 {
+		t.Fatalf("expected every issue to be resolved, got %+v", report)
+	}
+
+	// The corrupt chunk and the orphaned metadata are quarantined and
+	// unindexed, the chunk without metadata is rebuilt
+	if _, err := quarantine.Stat(logKey); err != nil {
+		t.Errorf("expected corrupt chunk in quarantine: %v", err)
+	}
+	if _, err := store.Stat(metaKey); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected corrupt chunk to leave the store, got %v", err)
+	}
+	if idx.GetChunkMeta(ids[1]) != nil || idx.GetChunkMeta(ids[3]) != nil {
+		t.Error("expected quarantined chunks to leave the index")
+	}
+	if _, err := NewStoreReader(store).ReadChunk(labels, ids[2]); err != nil {
+		t.Errorf("expected rebuilt chunk to be readable: %v", err)
+	}
+
+	report, _ = Fsck(store, idx, FsckOptions{})
+	if report.Chunks != 2 || len(report.Issues) != 0 {
+		t.Fatalf("expected a clean store, got %+v", report)
+	}
+}
+
+func TestFsck_RebuildsMetaOfUnsortedChunk(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	labels := map[string]string{"app": "nginx"}
+	lines := `{"id":"1","timestamp":"2024-01-15T10:05:00Z","message":"second","labels":{"app":"nginx"}}
+{"id":"2","timestamp":"2024-01-15T10:00:00Z","message":"first","labels":{"app":"nginx"}}
+{"id":"3","timestamp":"2024-01-15T10:10:00Z","message":"third","labels":{"app":"nginx"}}
+{"id":"4","timestamp":"2024-01-15T10:01:00Z","message":"late","labels":{"app":"nginx"}}
+`
+	logKey, metaKey := chunkKeys(labels, "chunk_1")
+	store.Put(logKey, []byte(lines))
+
+	if _, err := Fsck(store, index.NewIndex(), FsckOptions{Repair: true}); err != nil {
+		t.Fatalf("fsck failed: %v", err)
+	}
+	meta, err := NewStoreReader(store).readMeta(metaKey)
+	if err != nil {
+		t.Fatalf("expected rebuilt metadata: %v", err)
+	}
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	if meta.StartTime != start.Unix() || meta.EndTime != start.Add(10*time.Minute).Unix() {
+		t.Errorf("expected range %d-%d, got %d-%d", start.Unix(), start.Add(10*time.Minute).Unix(), meta.StartTime, meta.EndTime)
+	}
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+// layoutKey marks a chunk store whose chunks all live in label hash
+// directories
+const layoutKey = "layout.json"
+
+// layoutVersion is the current chunk store layout. Version 1 named stream
+// directories after their raw k=v label pairs.
+const layoutVersion = 2
+
+// MigrateLayout moves chunks stored under the old label pair directories
+// into label hash directories with a stream manifest. It runs once per
+// store; later calls return as soon as they find the layout marker.
+//
+// Each chunk is copied before its old objects are deleted, so an
+// interrupted migration is finished by the next call.
+func MigrateLayout(store ChunkStore) (int, error) {
+	if _, err := store.Stat(layoutKey); err == nil {
+		return 0, nil
+	} else if !errors.Is(err, ErrObjectNotFound) {
+		return 0, err
+	}
+
+	moved := 0
+	stores, _ := storeTiers(store)
+	for _, s := range stores {
+		n, err := migrateLayout(s)
+		moved += n
+		if err != nil {
+			return moved, err
+		}
+	}
+
+	data, err := json.Marshal(map[string]int{"version": layoutVersion})
+	if err != nil {
+		return moved, err
+	}
+	if err := store.Put(layoutKey, data); err != nil {
+		return moved, err
+	}
+
+	if moved > 0 {
+		log.Printf("Storage layout: moved %d chunks to label hash directories", moved)
+	}
+	return moved, nil
+}
+
+// migrateLayout moves the chunks of a single store
+func migrateLayout(store ChunkStore) (int, error) {
+	objects, err := store.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	reader := &Reader{store: store}
+	moved := 0
+
+	for _, obj := range objects {
+		if path.Ext(obj.Key) != ".meta" {
+			continue
+		}
+
+		meta, err := reader.readMeta(obj.Key)
+		if err != nil {
+			log.Printf("Storage layout: skipping %s: %v", obj.Key, err)
+			continue
+		}
+
+		logKey, metaKey := chunkKeys(meta.Labels, meta.ID)
+		if obj.Key == metaKey {
+			continue
+		}
+		oldLogKey := strings.TrimSuffix(obj.Key, ".meta") + ".log"
+
+		// Data first, metadata last, as the writer does
+		if _, err := copyObject(store, oldLogKey, store, logKey); err != nil {
+			if errors.Is(err, ErrObjectNotFound) {
+				log.Printf("Storage layout: skipping %s: missing chunk data", obj.Key)
+				continue
+			}
+			return moved, err
+		}
+		manifest, err := json.Marshal(streamManifest{Labels: meta.Labels})
+		if err != nil {
+			return moved, err
+		}
+		if err := store.Put(manifestKey(meta.Labels), append(manifest, '\n')); err != nil {
+			return moved, err
+		}
+		if _, err := copyObject(store, obj.Key, store, metaKey); err != nil {
+			return moved, err
+		}
+
+		for _, key := range []string{obj.Key, oldLogKey} {
+			if err := store.Delete(key); err != nil {
+				return moved, fmt.Errorf("delete %s: %w", key, err)
+			}
+		}
+		moved++
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteChunk_SafeStreamPaths(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "chunks")
+	writer := NewWriter(dir, 0, CompressionSnappy)
+
+	escaping := map[string]string{"app": "../../etc", "path": "/var/log"}
+	merged := map[string]string{"a": "x_b=y"}
+	split := map[string]string{"a": "x", "b": "y"}
+
+	for _, labels := range []map[string]string{escaping, merged, split} {
+		chunkID, _, _, err := writer.WriteChunk(labels, testEntries(labels, 5))
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		got, err := NewReader(dir).ReadChunk(labels, chunkID)
+		if err != nil || len(got) != 5 || got[0].Labels["a"] != labels["a"] {
+			t.Fatalf("read %v: unexpected entries %d, %v", labels, len(got), err)
+		}
+	}
+
+	// Every object stays under the root, one directory per stream
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expected 3 stream directories, got %v, %v", entries, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "etc")); !os.IsNotExist(err) {
+		t.Fatal("expected no objects outside the storage root")
+	}
+
+	manifest, err := readManifest(writer.store, manifestKey(escaping))
+	if err != nil || manifest.Labels["app"] != "../../etc" {
+		t.Fatalf("unexpected manifest %+v, %v", manifest, err)
+	}
+}
+
+func TestWriteChunk_UniqueIDsAcrossWriters(t *testing.T) {
+	// A restarted server gets a fresh writer over the same store, so its
+	// chunk IDs must not repeat those of the previous run
+	store := NewFSStore(t.TempDir())
+	labels := map[string]string{"app": "api"}
+	ids := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		for n, writer := range []*Writer{NewStoreWriter(store, 0, CompressionSnappy), NewStoreWriter(store, 0, CompressionSnappy)} {
+			entries := testEntries(labels, 1+n)
+			chunkID, _, _, err := writer.WriteChunk(labels, entries)
+			if err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			if _, exists := ids[chunkID]; exists {
+				t.Fatalf("chunk ID %s handed out twice", chunkID)
+			}
+			ids[chunkID] = len(entries)
+		}
+	}
+
+	for chunkID, want := range ids {
+		got, err := NewStoreReader(store).ReadChunk(labels, chunkID)
+		if err != nil || len(got) != want {
+			t.Errorf("%s: read %d entries, want %d: %v", chunkID, len(got), want, err)
+		}
+	}
+}
+
+func TestWriteChunk_RestoresManifest(t *testing.T) {
+	writer := NewWriter(t.TempDir(), 0, CompressionSnappy)
+	labels := map[string]string{"app": "nginx"}
+
+	chunkID, _, _, err := writer.WriteChunk(labels, testEntries(labels, 5))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := removeChunk(writer.store, labels, chunkID); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, _, _, err := writer.WriteChunk(labels, testEntries(labels, 5)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	// The manifest dropped with the last chunk comes back with the next
+	if _, err := readManifest(writer.store, manifestKey(labels)); err != nil {
+		t.Fatalf("expected the manifest to be rewritten: %v", err)
+	}
+
+	// Removing a stream's last chunk while another is written never leaves
+	// the new chunk without a manifest
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		chunkID, _, _, err := writer.WriteChunk(labels, testEntries(labels, 1))
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			removeChunk(writer.store, labels, chunkID)
+		}()
+	}
+	wg.Wait()
+	if _, err := readManifest(writer.store, manifestKey(labels)); err != nil {
+		t.Fatalf("expected the manifest to remain with the stream's chunks: %v", err)
+	}
+}
+
+func TestWriteChunk_DetectsHashCollision(t *testing.T) {
+	labels := map[string]string{"app": "nginx"}
+	writer := NewWriter(t.TempDir(), 0, CompressionSnappy)
+
+	// Pretend another label set already owns the stream directory
+	if err := writer.store.Put(manifestKey(labels), []byte(`{"labels":{"app":"other"}}`)); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	_, _, _, err := writer.WriteChunk(labels, testEntries(labels, 5))
+	if !errors.Is(err, ErrLabelHashCollision) {
+		t.Fatalf("expected ErrLabelHashCollision, got %v", err)
+	}
+}
+
+func TestMigrateLayout(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	labels := map[string]string{"app": "nginx", "path": "/var/log"}
+
+	// Write a chunk the way old versions laid it out
+	chunkID, _, _, err := NewStoreWriter(store, 0, CompressionSnappy).WriteChunk(labels, testEntries(labels, 5))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	logKey, metaKey := chunkKeys(labels, chunkID)
+	oldDir := "app=nginx_path=/var/log"
+	for _, key := range []string{logKey, metaKey} {
+		if _, err := copyObject(store, key, store, path.Join(oldDir, path.Base(key))); err != nil {
+			t.Fatalf("copy failed: %v", err)
+		}
+		store.Delete(key)
+	}
+	store.Delete(manifestKey(labels))
+
+	moved, err := MigrateLayout(store)
+	if err != nil || moved != 1 {
+		t.Fatalf("expected 1 chunk moved, got %d, %v", moved, err)
+	}
+
+	got, err := NewStoreReader(store).ReadChunk(labels, chunkID)
+	if err != nil || len(got) != 5 {
+		t.Fatalf("expected 5 entries after migration, got %d, %v", len(got), err)
+	}
+	if _, err := readManifest(store, manifestKey(labels)); err != nil {
+		t.Fatalf("expected a stream manifest: %v", err)
+	}
+	if objects, _ := store.List("app="); len(objects) != 0 {
+		t.Fatalf("expected old layout objects to be removed, got %+v", objects)
+	}
+
+	// The marker makes later calls a no-op
+	rc, err := store.Get(layoutKey)
+	if err != nil {
+		t.Fatalf("expected layout marker: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if !strings.Contains(string(data), `"version":2`) {
+		t.Fatalf("unexpected layout marker %s", data)
+	}
+	if moved, err := MigrateLayout(store); err != nil || moved != 0 {
+		t.Fatalf("expected second migration to do nothing, got %d, %v", moved, err)
+	}
+}
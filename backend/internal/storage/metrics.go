@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats contains storage subsystem metrics
+type Stats struct {
+	RecoveredChunks  int64
+	SkippedChunks    int64
+	RecoveryDuration time.Duration
+
+	// Chunks that failed checksum or decoding when read
+	CorruptChunksRead int64
+
+	// Compaction
+	CompactionRuns         int64
+	CompactionRunning      bool
+	CompactionStreams      int64 // streams in the current or last pass
+	CompactionStreamsDone  int64
+	CompactedChunks        int64 // source chunks merged into larger ones
+	CompactionBytesSaved   int64
+	CompactionLastDuration time.Duration
+
+	// Retention
+	RetentionDeletedChunks int64
+	RetentionDeletedBytes  int64
+
+	// Storage cap
+	EvictedChunks int64
+	EvictedBytes  int64
+	StorageFull   bool
+
+	// Tiering
+	MigrationRuns     int64
+	MigrationRunning  bool
+	MigrationPending  int64 // chunks left in the current pass
+	MigratedChunks    int64
+	MigratedBytes     int64
+	MigrationFailures int64
+
+	// Deletion
+	DeleteRequestsPending int64
+	DeletedEntries        int64
+	DeleteRewrittenChunks int64 // chunks rewritten without deleted entries
+	DeleteRemovedChunks   int64 // chunks whose every entry was deleted
+}
+
+var (
+	stats   Stats
+	statsMu sync.RWMutex
+)
+
+// GetStats returns a snapshot of storage metrics
+func GetStats() Stats {
+	statsMu.RLock()
+	defer statsMu.RUnlock()
+	return stats
+}
+
+func recordRecovery(recovered, skipped int, elapsed time.Duration) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.RecoveredChunks = int64(recovered)
+	stats.SkippedChunks = int64(skipped)
+	stats.RecoveryDuration = elapsed
+}
+
+func compactionStarted(streams int) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.CompactionRunning = true
+	stats.CompactionStreams = int64(streams)
+	stats.CompactionStreamsDone = 0
+}
+
+func compactionProgress() {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.CompactionStreamsDone++
+}
+
+func recordCompaction(chunks int, bytesSaved int64) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.CompactedChunks += int64(chunks)
+	stats.CompactionBytesSaved += bytesSaved
+}
+
+func compactionFinished(elapsed time.Duration) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.CompactionRunning = false
+	stats.CompactionRuns++
+	stats.CompactionLastDuration = elapsed
+}
+
+func recordRetention(chunks int, bytes int64) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.RetentionDeletedChunks += int64(chunks)
+	stats.RetentionDeletedBytes += bytes
+}
+
+func recordEviction(chunks int, bytes int64, full bool) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.EvictedChunks += int64(chunks)
+	stats.EvictedBytes += bytes
+	stats.StorageFull = full
+}
+
+func migrationStarted(pending int) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.MigrationRunning = true
+	stats.MigrationPending = int64(pending)
+}
+
+// recordMigration accounts for one chunk of the current migration pass
+func recordMigration(chunks int, bytes int64, failures int) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.MigrationPending--
+	stats.MigratedChunks += int64(chunks)
+	stats.MigratedBytes += bytes
+	stats.MigrationFailures += int64(failures)
+}
+
+func migrationFinished() {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.MigrationRunning = false
+	stats.MigrationPending = 0
+	stats.MigrationRuns++
+}
+
+func recordCorruptChunk() {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.CorruptChunksRead++
+}
+
+func setPendingDeletes(pending int) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.DeleteRequestsPending = int64(pending)
+}
+
+func recordDeletion(rewritten bool, entries int) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats.DeletedEntries += int64(entries)
+	if rewritten {
+		stats.DeleteRewrittenChunks++
+	} else {
+		stats.DeleteRemovedChunks++
+	}
+}
@@ -2,46 +2,146 @@ package storage
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
-	"os"
-	"path/filepath"
+	"errors"
+	"fmt"
+	"io"
+	"path"
 	"time"
 
 	"github.com/logpulse/backend/internal/models"
 )
 
-// Reader handles reading log chunks from disk
+// Reader handles reading log chunks from a chunk store
 type Reader struct {
-	basePath string
+	store ChunkStore
 }
 
-// NewReader creates a new storage reader
+// NewReader creates a new storage reader for chunks on the local filesystem
 func NewReader(basePath string) *Reader {
-	return &Reader{basePath: basePath}
+	return NewStoreReader(NewFSStore(basePath))
 }
 
-// ReadChunk reads all entries from a chunk file
+// NewStoreReader creates a new storage reader for chunks in store
+func NewStoreReader(store ChunkStore) *Reader {
+	return &Reader{store: store}
+}
+
+// ForTier returns a reader that looks a chunk up in the given tier first.
+// It still finds chunks moved between tiers since their metadata was read.
+func (r *Reader) ForTier(tier string) *Reader {
+	if tiered, ok := r.store.(*TieredStore); ok && tier == TierCold {
+		return &Reader{store: tiered.coldFirst()}
+	}
+	return r
+}
+
+// ReadChunk reads all entries from a chunk, checking the data against the
+// checksum in its metadata
 func (r *Reader) ReadChunk(labels map[string]string, chunkID string) ([]models.LogEntry, error) {
-	labelPath := models.Labels(labels).ToPath()
-	chunkPath := filepath.Join(r.basePath, labelPath, chunkID+".log")
+	logKey, metaKey := chunkKeys(labels, chunkID)
 
-	file, err := os.Open(chunkPath)
+	data, err := readObject(r.store, logKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without metadata there is nothing to check against; block checksums
+	// still catch most damage
+	if meta, err := r.readMeta(metaKey); err == nil {
+		if err := verifyChunk(meta, data); err != nil {
+			recordCorruptChunk()
+			return nil, fmt.Errorf("chunk %s: %w", chunkID, err)
+		}
+	}
+
+	entries, err := decodeChunk(data)
+	if errors.Is(err, ErrCorruptChunk) {
+		recordCorruptChunk()
+		return nil, fmt.Errorf("chunk %s: %w", chunkID, err)
+	}
+	return entries, err
+}
+
+// ChunkMayContain reports whether a chunk may hold lines containing each
+// of substrings, going by the chunk's bloom filter. A chunk without a
+// readable filter always may.
+func (r *Reader) ChunkMayContain(labels map[string]string, chunkID string, substrings []string) bool {
+	data, err := readObject(r.store, bloomKey(labels, chunkID))
+	if err != nil {
+		return true
+	}
+	filter, err := unmarshalBloom(data)
+	if err != nil {
+		return true
+	}
+
+	for _, s := range substrings {
+		if !filter.mayContain(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeChunk decodes every entry of a chunk
+func decodeChunk(data []byte) ([]models.LogEntry, error) {
+	if len(data) >= len(chunkMagic) && string(data[:len(chunkMagic)]) == chunkMagic {
+		blocks, _, err := splitChunk(data)
+		if err != nil {
+			return nil, err
+		}
+		data = blocks
+	}
+	reader := bufio.NewReader(bytes.NewReader(data))
+
+	// Binary chunks start with a magic number, legacy chunks are JSON lines
+	if magic, err := reader.Peek(len(chunkMagic)); err == nil && string(magic) == chunkMagic {
+		return readBinaryChunk(reader)
+	}
+
+	return readJSONChunk(reader)
+}
+
+// readBinaryChunk decodes every block of a binary chunk
+func readBinaryChunk(reader *bufio.Reader) ([]models.LogEntry, error) {
+	decoder, err := newChunkDecoder(reader)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
 	var entries []models.LogEntry
-	scanner := bufio.NewScanner(file)
-	
+	for {
+		header, err := decoder.nextBlockHeader()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		block, err := decoder.readBlock(header)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, block...)
+	}
+}
+
+// readJSONChunk decodes a legacy chunk with one JSON entry per line
+func readJSONChunk(reader io.Reader) ([]models.LogEntry, error) {
+	var entries []models.LogEntry
+	scanner := bufio.NewScanner(reader)
+
 	// Increase buffer size for large lines
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024)
 
-	for scanner.Scan() {
+	for line := 1; scanner.Scan(); line++ {
 		var entry models.LogEntry
 		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
-			continue
+			return nil, fmt.Errorf("%w: line %d: %v", ErrCorruptChunk, line, err)
 		}
 		entries = append(entries, entry)
 	}
@@ -49,32 +149,88 @@ func (r *Reader) ReadChunk(labels map[string]string, chunkID string) ([]models.L
 	return entries, scanner.Err()
 }
 
-// ReadChunkFiltered reads entries from a chunk with time filtering
+// ReadChunkFiltered reads entries from a chunk with time filtering. Binary
+// chunks only have the blocks overlapping the time range read and decoded.
 func (r *Reader) ReadChunkFiltered(labels map[string]string, chunkID string, startTime, endTime time.Time) ([]models.LogEntry, int, error) {
-	entries, err := r.ReadChunk(labels, chunkID)
+	it, err := r.IterateChunk(labels, chunkID, startTime, endTime, Forward)
 	if err != nil {
 		return nil, 0, err
 	}
+	defer it.Close()
 
-	scannedLines := len(entries)
 	filtered := make([]models.LogEntry, 0)
+	for it.Next() {
+		filtered = append(filtered, it.At())
+	}
+	if err := it.Err(); err != nil {
+		return nil, 0, err
+	}
 
-	for _, entry := range entries {
-		if entry.Timestamp.Before(startTime) || entry.Timestamp.After(endTime) {
-			continue
-		}
-		filtered = append(filtered, entry)
+	return filtered, it.Scanned(), nil
+}
+
+// errNoBlockIndex is returned by readBlockIndex for chunks that have to be
+// read whole
+var errNoBlockIndex = errors.New("chunk has no block index")
+
+// readBlockIndex reads the block index from the end of a chunk. A missing
+// or damaged index gives errNoBlockIndex; a full read then checks the
+// whole chunk. A chunk whose size differs from meta gives ErrCorruptChunk.
+func (r *Reader) readBlockIndex(logKey string, meta *models.ChunkMeta) (*blockIndex, error) {
+	info, err := r.store.Stat(logKey)
+	if err != nil {
+		return nil, err
 	}
+	if meta != nil && meta.Checksum != "" && info.Size != meta.Size {
+		return nil, fmt.Errorf("%w: %d bytes, meta says %d", ErrCorruptChunk, info.Size, meta.Size)
+	}
+	if info.Size < int64(footerSize) {
+		return nil, errNoBlockIndex
+	}
+	footer, err := readRange(r.store, logKey, info.Size-int64(footerSize), int64(footerSize))
+	if err != nil {
+		return nil, err
+	}
+	offset, length, checksum, ok := parseFooter(footer)
+	if !ok || offset < 0 || offset+length != info.Size-int64(footerSize) {
+		return nil, errNoBlockIndex
+	}
+	indexData, err := readRange(r.store, logKey, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := unmarshalBlockIndex(indexData, checksum)
+	if err != nil {
+		return nil, errNoBlockIndex
+	}
+	return idx, nil
+}
 
-	return filtered, scannedLines, nil
+// readRange reads length bytes of an object starting at offset
+func readRange(store ChunkStore, key string, offset, length int64) ([]byte, error) {
+	rc, err := store.GetRange(key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(rc, data); err != nil {
+		return nil, fmt.Errorf("%w: %s is shorter than expected", ErrCorruptChunk, key)
+	}
+	return data, nil
 }
 
 // GetChunkMeta reads chunk metadata
 func (r *Reader) GetChunkMeta(labels map[string]string, chunkID string) (*models.ChunkMeta, error) {
-	labelPath := models.Labels(labels).ToPath()
-	metaPath := filepath.Join(r.basePath, labelPath, chunkID+".meta")
+	_, metaKey := chunkKeys(labels, chunkID)
 
-	file, err := os.Open(metaPath)
+	return r.readMeta(metaKey)
+}
+
+// readMeta decodes a chunk metadata object
+func (r *Reader) readMeta(metaKey string) (*models.ChunkMeta, error) {
+	file, err := r.store.Get(metaKey)
 	if err != nil {
 		return nil, err
 	}
@@ -90,21 +246,16 @@ func (r *Reader) GetChunkMeta(labels map[string]string, chunkID string) (*models
 
 // ListChunks returns all chunk IDs for a label set
 func (r *Reader) ListChunks(labels map[string]string) ([]string, error) {
-	labelPath := models.Labels(labels).ToPath()
-	dirPath := filepath.Join(r.basePath, labelPath)
-
-	entries, err := os.ReadDir(dirPath)
+	objects, err := r.store.List(models.Labels(labels).ToPath() + "/")
 	if err != nil {
-		if os.IsNotExist(err) {
-			return []string{}, nil
-		}
 		return nil, err
 	}
 
 	chunks := make([]string, 0)
-	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".log" {
-			chunkID := entry.Name()[:len(entry.Name())-4] // Remove .log extension
+	for _, obj := range objects {
+		name := path.Base(obj.Key)
+		if path.Ext(name) == ".log" {
+			chunkID := name[:len(name)-4] // Remove .log extension
 			chunks = append(chunks, chunkID)
 		}
 	}
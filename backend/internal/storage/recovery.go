@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+)
+
+// recoveryLogInterval controls how often recovery progress is logged
+const recoveryLogInterval = 1000
+
+// RecoverIndex lists the chunk store and registers every chunk found in
+// the index. It must run before the server starts accepting queries.
+func RecoverIndex(r *Reader, idx *index.Index) error {
+	start := time.Now()
+	recovered := 0
+	skipped := 0
+
+	log.Printf("Recovering index from chunk store")
+
+	// Cold chunks are recovered last so a chunk whose migration was
+	// interrupted after both copies were written is placed in the cold tier
+	stores, tiers := storeTiers(r.store)
+
+	for i, store := range stores {
+		n, s, err := recoverTier(&Reader{store: store}, tiers[i], idx)
+		if err != nil {
+			return err
+		}
+		recovered += n
+		skipped += s
+	}
+
+	elapsed := time.Since(start)
+	recordRecovery(recovered, skipped, elapsed)
+
+	log.Printf("Recovery complete: %d chunks indexed, %d skipped in %s", recovered, skipped, elapsed)
+	return nil
+}
+
+// recoverTier indexes the chunks of one storage tier
+func recoverTier(r *Reader, tier string, idx *index.Index) (int, int, error) {
+	recovered := 0
+	skipped := 0
+
+	objects, err := r.store.List("")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	keys := make(map[string]struct{}, len(objects))
+	for _, obj := range objects {
+		keys[obj.Key] = struct{}{}
+	}
+
+	for _, obj := range objects {
+		if path.Ext(obj.Key) != ".meta" {
+			continue
+		}
+
+		// Only chunks with both data and metadata are queryable
+		if _, ok := keys[strings.TrimSuffix(obj.Key, ".meta")+".log"]; !ok {
+			log.Printf("Recovery: skipping %s: missing chunk data", obj.Key)
+			skipped++
+			continue
+		}
+
+		meta, err := r.readMeta(obj.Key)
+		if err != nil {
+			log.Printf("Recovery: skipping %s: %v", obj.Key, err)
+			skipped++
+			continue
+		}
+
+		idx.AddChunk(meta.ID, meta.Labels, time.Unix(meta.StartTime, 0), time.Unix(meta.EndTime, 0), meta.EntryCount)
+		if tier != TierHot {
+			idx.SetChunkTier(meta.ID, tier)
+		}
+		recovered++
+
+		if recovered%recoveryLogInterval == 0 {
+			log.Printf("Recovery: %d chunks indexed so far", recovered)
+		}
+	}
+
+	return recovered, skipped, nil
+}
+
+// ReconcileIndex checks a persisted index against the chunk store at
+// startup. Indexed chunks whose data is gone are dropped from the index,
+// or moved to the tier that still holds them. Chunks the index lacks are
+// only counted: most are the leftovers of a compaction, delete or
+// retention pass interrupted after its index change, and indexing them
+// again would bring back replaced or deleted lines. fsck reports them and
+// indexes them with -repair.
+func ReconcileIndex(r *Reader, idx *index.Index) (dropped, unindexed int, err error) {
+	stores, tiers := storeTiers(r.store)
+
+	keys := make(map[string]map[string]struct{}, len(stores))
+	for i, store := range stores {
+		objects, err := store.List("")
+		if err != nil {
+			return 0, 0, err
+		}
+		keys[tiers[i]] = make(map[string]struct{}, len(objects))
+		for _, obj := range objects {
+			keys[tiers[i]][obj.Key] = struct{}{}
+		}
+	}
+
+	for _, meta := range idx.ChunksByEndTime() {
+		logKey, _ := chunkKeys(meta.Labels, meta.ID)
+		if _, ok := keys[meta.Tier][logKey]; ok {
+			continue
+		}
+		moved := false
+		for _, tier := range tiers {
+			if _, ok := keys[tier][logKey]; ok {
+				log.Printf("Reconcile: chunk %s is in tier %q, not %q", meta.ID, tier, meta.Tier)
+				moved = idx.SetChunkTier(meta.ID, tier)
+				break
+			}
+		}
+		if !moved {
+			log.Printf("Reconcile: dropping indexed chunk %s: missing chunk data", meta.ID)
+			idx.RemoveChunk(meta.ID)
+			dropped++
+		}
+	}
+
+	for _, tierKeys := range keys {
+		for key := range tierKeys {
+			if path.Ext(key) != ".meta" {
+				continue
+			}
+			if _, ok := tierKeys[strings.TrimSuffix(key, ".meta")+".log"]; !ok {
+				continue
+			}
+			if idx.GetChunkMeta(strings.TrimSuffix(path.Base(key), ".meta")) == nil {
+				unindexed++
+			}
+		}
+	}
+	if unindexed > 0 {
+		log.Printf("Reconcile: %d chunks in the store are not indexed, run fsck to review them", unindexed)
+	}
+	return dropped, unindexed, nil
+}
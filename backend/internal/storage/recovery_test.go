@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+)
+
+func TestRecoverIndex(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	writer := NewStoreWriter(store, 0, CompressionSnappy)
+	nginx := map[string]string{"app": "nginx"}
+	api := map[string]string{"app": "api"}
+
+	var ids []string
+	for _, labels := range []map[string]string{nginx, nginx, api, api} {
+		chunkID, _, _, err := writer.WriteChunk(labels, testEntries(labels, 10))
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		ids = append(ids, chunkID)
+	}
+
+	// ids[2] keeps its metadata but loses its data, ids[3] has unreadable
+	// metadata
+	logKey, _ := chunkKeys(api, ids[2])
+	store.Delete(logKey)
+	_, metaKey := chunkKeys(api, ids[3])
+	store.Put(metaKey, []byte("{not json"))
+
+	idx := index.NewIndex()
+	if err := RecoverIndex(NewStoreReader(store), idx); err != nil {
+		t.Fatalf("recovery failed: %v", err)
+	}
+
+	stats := GetStats()
+	if stats.RecoveredChunks != 2 || stats.SkippedChunks != 2 {
+		t.Fatalf("expected 2 recovered and 2 skipped chunks, got %d and %d", stats.RecoveredChunks, stats.SkippedChunks)
+	}
+	for _, id := range ids[:2] {
+		meta := idx.GetChunkMeta(id)
+		if meta == nil || meta.Labels["app"] != "nginx" || meta.EntryCount != 10 {
+			t.Errorf("expected %s to be indexed, got %+v", id, meta)
+		}
+	}
+	for _, id := range ids[2:] {
+		if idx.GetChunkMeta(id) != nil {
+			t.Errorf("expected %s to be skipped", id)
+		}
+	}
+
+	// Recovered chunks are found by label and time
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	matchers := []index.Matcher{{Name: "app", Value: "nginx", Type: index.MatchEqual}}
+	if got := idx.FindChunksMatching(matchers, start, start.Add(24*time.Hour)); len(got) != 2 {
+		t.Errorf("expected 2 matching chunks, got %v", got)
+	}
+}
+
+func TestReconcileIndex(t *testing.T) {
+	store := NewFSStore(t.TempDir())
+	writer := NewStoreWriter(store, 0, CompressionSnappy)
+	labels := map[string]string{"app": "nginx"}
+
+	idx := index.NewIndex()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		chunkID, start, end, err := writer.WriteChunk(labels, testEntries(labels, 10))
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		ids = append(ids, chunkID)
+		if i < 2 {
+			idx.AddChunk(chunkID, labels, start, end, 10)
+		}
+	}
+
+	// ids[1] is gone from the store and ids[2] was never indexed
+	if _, err := removeChunk(store, labels, ids[1]); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+
+	dropped, unindexed, err := ReconcileIndex(NewStoreReader(store), idx)
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if dropped != 1 || unindexed != 1 {
+		t.Fatalf("expected 1 dropped and 1 unindexed chunk, got %d and %d", dropped, unindexed)
+	}
+	if idx.GetChunkMeta(ids[0]) == nil || idx.GetChunkMeta(ids[1]) != nil {
+		t.Fatal("expected only the chunk missing from the store to be dropped")
+	}
+	if idx.GetChunkMeta(ids[2]) != nil {
+		t.Fatal("expected the unindexed chunk to be left to fsck")
+	}
+}
@@ -1,80 +1,356 @@
 package storage
 
 import (
+	"errors"
 	"log"
-	"os"
-	"path/filepath"
+	"path"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+)
+
+var (
+	// ErrStorageFull means max_storage_bytes is exceeded and evicting every
+	// indexed chunk could not bring usage under it
+	ErrStorageFull = errors.New("storage is full")
+	// ErrStorageOverCapacity means max_storage_bytes is exceeded and chunks
+	// are being evicted; writes may be retried shortly
+	ErrStorageOverCapacity = errors.New("storage over capacity, evicting old chunks")
 )
 
-// StartRetentionWorker starts a background worker to clean up old logs
-func StartRetentionWorker(basePath string, retentionDays int) {
+// capCheckInterval is how often usage is compared to the storage cap
+const capCheckInterval = time.Minute
+
+// RetentionRule keeps chunks of streams matching a selector for Period
+type RetentionRule struct {
+	Selector string
+	Matchers []index.Matcher
+	Period   time.Duration
+}
+
+// RetentionPolicy decides how long each stream's chunks are kept
+type RetentionPolicy struct {
+	// Period applies to streams no rule matches
+	Period time.Duration
+	Rules  []RetentionRule
+
+	// MaxBytes caps the disk space used by chunks, 0 for no cap. The oldest
+	// chunks across all streams are evicted to stay under it. With tiered
+	// storage only the hot tier counts.
+	MaxBytes int64
+}
+
+// PeriodFor returns the retention period for a label set and the selector
+// of the rule it came from, or "" for the default. When several rules
+// match, the longest period wins.
+func (p RetentionPolicy) PeriodFor(labels map[string]string) (time.Duration, string) {
+	period, selector := p.Period, ""
+	matched := false
+
+	for _, rule := range p.Rules {
+		if !index.MatchLabels(rule.Matchers, labels) {
+			continue
+		}
+		if !matched || rule.Period > period {
+			period, selector = rule.Period, rule.Selector
+			matched = true
+		}
+	}
+	return period, selector
+}
+
+// shortestPeriod returns the smallest period any chunk can be kept for
+func (p RetentionPolicy) shortestPeriod() time.Duration {
+	shortest := p.Period
+	for _, rule := range p.Rules {
+		if rule.Period < shortest {
+			shortest = rule.Period
+		}
+	}
+	return shortest
+}
+
+// ExpiredChunk is a chunk retention would delete
+type ExpiredChunk struct {
+	Meta     models.ChunkMeta
+	Selector string // matching rule, "" for the default period
+	Period   time.Duration
+	Bytes    int64
+}
+
+// Retention deletes chunks once they fall outside their retention period
+type Retention struct {
+	index  *index.Index
+	store  ChunkStore
+	policy RetentionPolicy
+
+	// Storage cap state
+	capMu    sync.Mutex
+	usage    int64
+	full     bool
+	evictNow chan struct{}
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRetention creates a retention worker for the chunks in store
+func NewRetention(idx *index.Index, store ChunkStore, policy RetentionPolicy) *Retention {
+	return &Retention{
+		index:    idx,
+		store:    store,
+		policy:   policy,
+		evictNow: make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins hourly retention cleanup, and enforcement of the storage cap
+// if one is set, in the background
+func (r *Retention) Start() {
+	if r.policy.MaxBytes > 0 {
+		r.EnforceCap()
+	}
+
+	r.wg.Add(1)
+	go r.run()
+}
+
+// Stop stops the retention worker
+func (r *Retention) Stop() {
+	close(r.stopChan)
+	r.wg.Wait()
+}
+
+func (r *Retention) run() {
+	defer r.wg.Done()
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		CleanupOldChunks(basePath, retentionDays)
+	capTicker := time.NewTicker(capCheckInterval)
+	defer capTicker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.Cleanup()
+		case <-capTicker.C:
+			if r.policy.MaxBytes > 0 {
+				r.EnforceCap()
+			}
+		case <-r.evictNow:
+			r.EnforceCap()
+		case <-r.stopChan:
+			return
+		}
 	}
 }
 
-// CleanupOldChunks removes chunk files older than retention period
-func CleanupOldChunks(basePath string, retentionDays int) {
-	cutoff := time.Now().AddDate(0, 0, -retentionDays)
-	deletedCount := 0
-	deletedBytes := int64(0)
+// CheckCapacity reports whether chunk storage can take more data. It
+// returns ErrStorageOverCapacity while eviction is catching up and
+// ErrStorageFull if the cap cannot be met.
+func (r *Retention) CheckCapacity() error {
+	if r.policy.MaxBytes <= 0 {
+		return nil
+	}
+
+	r.capMu.Lock()
+	defer r.capMu.Unlock()
 
-	err := filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
+	if r.full {
+		return ErrStorageFull
+	}
+	if r.usage > r.policy.MaxBytes {
+		select {
+		case r.evictNow <- struct{}{}:
+		default:
 		}
+		return ErrStorageOverCapacity
+	}
+	return nil
+}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
+// AddUsage counts a chunk written since usage was last measured, so
+// writes are refused as soon as they exceed the cap rather than at the
+// next EnforceCap. Chunk metadata is left to the next measurement.
+func (r *Retention) AddUsage(bytes int64) {
+	if r.policy.MaxBytes <= 0 {
+		return
+	}
+
+	r.capMu.Lock()
+	r.usage += bytes
+	r.capMu.Unlock()
+}
+
+// EnforceCap evicts the chunks with the oldest end time across all streams
+// until chunk storage fits in MaxBytes
+func (r *Retention) EnforceCap() {
+	if r.policy.MaxBytes <= 0 {
+		return
+	}
+
+	usage := storeSize(localStore(r.store))
+	evictedCount := 0
+	evictedBytes := int64(0)
+
+	if usage > r.policy.MaxBytes {
+		for _, meta := range r.index.ChunksByEndTime() {
+			if usage <= r.policy.MaxBytes {
+				break
+			}
+			// Cold chunks take no local space
+			if meta.Tier == TierCold {
+				continue
+			}
+
+			freed, deleted := r.deleteChunk(meta)
+			usage -= freed
+			evictedBytes += freed
+			if deleted {
+				evictedCount++
+			}
+		}
+	}
+
+	full := usage > r.policy.MaxBytes
+
+	r.capMu.Lock()
+	r.usage = usage
+	r.full = full
+	r.capMu.Unlock()
+
+	recordEviction(evictedCount, evictedBytes, full)
+
+	if evictedCount > 0 {
+		log.Printf("Storage cap: evicted %d chunks (%d bytes), %d of %d bytes used", evictedCount, evictedBytes, usage, r.policy.MaxBytes)
+	}
+	if full {
+		log.Printf("Storage cap: %d bytes used exceeds max_storage_bytes %d with no chunks left to evict", usage, r.policy.MaxBytes)
+	}
+}
+
+// Plan returns the chunks that are expired at now, oldest first, without
+// deleting anything
+func (r *Retention) Plan(now time.Time) []ExpiredChunk {
+	var expired []ExpiredChunk
+
+	for _, meta := range r.index.ChunksEndingBefore(now.Add(-r.policy.shortestPeriod())) {
+		period, selector := r.policy.PeriodFor(meta.Labels)
+		if meta.EndTime >= now.Add(-period).Unix() {
+			continue
 		}
 
-		// Check if file is older than cutoff
-		if info.ModTime().Before(cutoff) {
-			size := info.Size()
-			if err := os.Remove(path); err != nil {
-				log.Printf("Failed to delete %s: %v", path, err)
-				return nil
+		var size int64
+		logKey, metaKey := chunkKeys(meta.Labels, meta.ID)
+		for _, key := range []string{logKey, metaKey, bloomKey(meta.Labels, meta.ID)} {
+			if info, err := r.store.Stat(key); err == nil {
+				size += info.Size
 			}
+		}
+
+		expired = append(expired, ExpiredChunk{
+			Meta:     meta,
+			Selector: selector,
+			Period:   period,
+			Bytes:    size,
+		})
+	}
+
+	return expired
+}
+
+// Cleanup removes expired chunks, from the index first and then from disk
+func (r *Retention) Cleanup() {
+	now := time.Now()
+	deletedCount := 0
+	deletedBytes := int64(0)
+
+	for _, chunk := range r.Plan(now) {
+		freed, deleted := r.deleteChunk(chunk.Meta)
+		deletedBytes += freed
+		if deleted {
 			deletedCount++
-			deletedBytes += size
 		}
+	}
 
-		return nil
-	})
+	orphans, orphanBytes := cleanupOrphans(r.store, now.Add(-r.policy.Period))
+	deletedBytes += orphanBytes
 
+	recordRetention(deletedCount, deletedBytes)
+
+	if deletedCount > 0 || orphans > 0 {
+		log.Printf("Retention cleanup: deleted %d chunks and %d orphaned objects (%d bytes)", deletedCount, orphans, deletedBytes)
+	}
+
+	r.EnforceCap()
+}
+
+// deleteChunk removes a chunk from the index and then its files, so queries
+// stop seeing it before they go away. A chunk whose files could not all be
+// removed is indexed again and retried by the next pass. It returns the
+// bytes freed and whether the chunk is gone.
+func (r *Retention) deleteChunk(meta models.ChunkMeta) (int64, bool) {
+	if !r.index.RemoveChunk(meta.ID) {
+		// Compacted or deleted since it was listed
+		return 0, false
+	}
+
+	freed, err := removeChunk(r.store, meta.Labels, meta.ID)
+	if err != nil {
+		log.Printf("Failed to delete chunk %s: %v", meta.ID, err)
+		r.index.ReplaceChunksInTier(nil, meta.ID, meta.Tier, meta.Labels, time.Unix(meta.StartTime, 0), time.Unix(meta.EndTime, 0), meta.EntryCount)
+		return freed, false
+	}
+	return freed, true
+}
+
+// cleanupOrphans removes chunk objects older than cutoff whose .log/.meta
+// counterpart is missing, such as those left by an interrupted delete, and
+// bloom filters whose chunk data is gone
+func cleanupOrphans(store ChunkStore, cutoff time.Time) (int, int64) {
+	objects, err := store.List("")
 	if err != nil {
 		log.Printf("Retention cleanup error: %v", err)
+		return 0, 0
 	}
 
-	if deletedCount > 0 {
-		log.Printf("Retention cleanup: deleted %d files (%d bytes)", deletedCount, deletedBytes)
+	keys := make(map[string]struct{}, len(objects))
+	for _, obj := range objects {
+		keys[obj.Key] = struct{}{}
 	}
 
-	// Remove empty directories
-	cleanupEmptyDirs(basePath)
-}
+	deletedCount := 0
+	deletedBytes := int64(0)
 
-// cleanupEmptyDirs removes empty directories
-func cleanupEmptyDirs(basePath string) {
-	filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || !info.IsDir() || path == basePath {
-			return nil
+	for _, obj := range objects {
+		if !obj.ModTime.Before(cutoff) {
+			continue
 		}
 
-		entries, err := os.ReadDir(path)
-		if err != nil {
-			return nil
+		var pair string
+		switch path.Ext(obj.Key) {
+		case ".log":
+			pair = strings.TrimSuffix(obj.Key, ".log") + ".meta"
+		case ".meta", ".bloom":
+			pair = strings.TrimSuffix(obj.Key, path.Ext(obj.Key)) + ".log"
+		default:
+			continue
+		}
+		if _, ok := keys[pair]; ok {
+			continue
 		}
 
-		if len(entries) == 0 {
-			os.Remove(path)
+		if err := store.Delete(obj.Key); err != nil {
+			log.Printf("Failed to delete %s: %v", obj.Key, err)
+			continue
 		}
+		deletedCount++
+		deletedBytes += obj.Size
+	}
 
-		return nil
-	})
+	return deletedCount, deletedBytes
 }
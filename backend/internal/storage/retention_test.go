@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+	"github.com/logpulse/backend/internal/models"
+)
+
+func TestRetentionCleanup_UsesEndTime(t *testing.T) {
+	dir := t.TempDir()
+	writer := NewWriter(dir, 0, CompressionSnappy)
+	idx := index.NewIndex()
+
+	oldLabels := map[string]string{"app": "old"}
+	oldID, start, end, err := writer.WriteChunk(oldLabels, testEntries(oldLabels, 10))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	idx.AddChunk(oldID, oldLabels, start, end, 10)
+
+	// Freshly written, but its entries are recent so it must be kept
+	newLabels := map[string]string{"app": "new"}
+	entries := testEntries(newLabels, 10)
+	for i := range entries {
+		entries[i].Timestamp = time.Now()
+	}
+	newID, start, end, err := writer.WriteChunk(newLabels, entries)
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	idx.AddChunk(newID, newLabels, start, end, 10)
+
+	before := GetStats()
+	NewRetention(idx, writer.store, RetentionPolicy{Period: 7 * 24 * time.Hour}).Cleanup()
+
+	if idx.GetChunkMeta(oldID) != nil {
+		t.Error("expected expired chunk to be removed from the index")
+	}
+	if idx.GetChunkMeta(newID) == nil {
+		t.Error("expected recent chunk to be kept")
+	}
+	for _, v := range idx.GetLabelValues("app") {
+		if v == "old" {
+			t.Error("expected unreferenced label value to be pruned")
+		}
+	}
+
+	logKey, metaKey := chunkKeys(oldLabels, oldID)
+	for _, key := range []string{logKey, metaKey} {
+		if _, err := writer.store.Stat(key); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("expected %s to be deleted", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, models.Labels(oldLabels).ToPath())); !os.IsNotExist(err) {
+		t.Error("expected empty chunk directory to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, models.Labels(newLabels).ToPath())); err != nil {
+		t.Errorf("expected recent chunk directory to be kept: %v", err)
+	}
+
+	after := GetStats()
+	if after.RetentionDeletedChunks-before.RetentionDeletedChunks != 1 || after.RetentionDeletedBytes <= before.RetentionDeletedBytes {
+		t.Errorf("unexpected retention stats %+v", after)
+	}
+}
+
+// failingDeleteStore fails to delete objects with the extension failExt
+type failingDeleteStore struct {
+	ChunkStore
+	failExt string
+}
+
+func (s *failingDeleteStore) Delete(key string) error {
+	if path.Ext(key) == s.failExt {
+		return errors.New("delete failed")
+	}
+	return s.ChunkStore.Delete(key)
+}
+
+func TestRetentionCleanup_RetriesFailedDeletes(t *testing.T) {
+	writer := NewWriter(t.TempDir(), 0, CompressionSnappy)
+	idx := index.NewIndex()
+
+	labels := map[string]string{"app": "old"}
+	chunkID, start, end, err := writer.WriteChunk(labels, testEntries(labels, 10))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	idx.AddChunk(chunkID, labels, start, end, 10)
+
+	// The metadata goes, but the data stays behind
+	store := &failingDeleteStore{ChunkStore: writer.store, failExt: ".log"}
+	retention := NewRetention(idx, store, RetentionPolicy{Period: 7 * 24 * time.Hour})
+	before := GetStats()
+	retention.Cleanup()
+
+	if idx.GetChunkMeta(chunkID) == nil {
+		t.Fatal("expected the chunk to stay indexed after a failed delete")
+	}
+	if after := GetStats(); after.RetentionDeletedChunks != before.RetentionDeletedChunks {
+		t.Fatalf("expected the chunk not to be counted as deleted, got %+v", after)
+	}
+
+	store.failExt = ""
+	retention.Cleanup()
+
+	if idx.GetChunkMeta(chunkID) != nil {
+		t.Fatal("expected the retried chunk to be removed from the index")
+	}
+	logKey, _ := chunkKeys(labels, chunkID)
+	if _, err := writer.store.Stat(logKey); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected %s to be deleted, got %v", logKey, err)
+	}
+	if after := GetStats(); after.RetentionDeletedChunks-before.RetentionDeletedChunks != 1 {
+		t.Fatalf("expected the chunk to be counted once, got %+v", after)
+	}
+}
+
+func TestRetentionPolicy_LongestRuleWins(t *testing.T) {
+	policy := RetentionPolicy{
+		Period: 7 * 24 * time.Hour,
+		Rules: []RetentionRule{
+			{Selector: `{level="debug"}`, Matchers: []index.Matcher{{Name: "level", Value: "debug", Type: index.MatchEqual}}, Period: 24 * time.Hour},
+			{Selector: `{app="audit"}`, Matchers: []index.Matcher{{Name: "app", Value: "audit", Type: index.MatchEqual}}, Period: 90 * 24 * time.Hour},
+		},
+	}
+
+	tests := []struct {
+		labels   map[string]string
+		period   time.Duration
+		selector string
+	}{
+		{map[string]string{"app": "api"}, 7 * 24 * time.Hour, ""},
+		{map[string]string{"app": "api", "level": "debug"}, 24 * time.Hour, `{level="debug"}`},
+		{map[string]string{"app": "audit", "level": "debug"}, 90 * 24 * time.Hour, `{app="audit"}`},
+	}
+
+	for _, tt := range tests {
+		period, selector := policy.PeriodFor(tt.labels)
+		if period != tt.period || selector != tt.selector {
+			t.Errorf("labels %v: expected %v from %q, got %v from %q", tt.labels, tt.period, tt.selector, period, selector)
+		}
+	}
+}
+
+func TestRetentionPlan_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	writer := NewWriter(dir, 0, CompressionSnappy)
+	idx := index.NewIndex()
+
+	ids := make(map[string]string)
+	for _, level := range []string{"debug", "info"} {
+		labels := map[string]string{"app": "api", "level": level}
+		entries := testEntries(labels, 10)
+		for i := range entries {
+			entries[i].Timestamp = time.Now().Add(-3 * 24 * time.Hour)
+		}
+		chunkID, start, end, err := writer.WriteChunk(labels, entries)
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		idx.AddChunk(chunkID, labels, start, end, 10)
+		ids[level] = chunkID
+	}
+
+	retention := NewRetention(idx, writer.store, RetentionPolicy{
+		Period: 7 * 24 * time.Hour,
+		Rules: []RetentionRule{
+			{Selector: `{level="debug"}`, Matchers: []index.Matcher{{Name: "level", Value: "debug", Type: index.MatchEqual}}, Period: 24 * time.Hour},
+		},
+	})
+
+	plan := retention.Plan(time.Now())
+	if len(plan) != 1 || plan[0].Meta.ID != ids["debug"] {
+		t.Fatalf("expected only the debug chunk to expire, got %+v", plan)
+	}
+	var size int64
+	labels := plan[0].Meta.Labels
+	logKey, metaKey := chunkKeys(labels, ids["debug"])
+	for _, key := range []string{logKey, metaKey, bloomKey(labels, ids["debug"])} {
+		info, err := writer.store.Stat(key)
+		if err != nil {
+			t.Fatalf("stat %s failed: %v", key, err)
+		}
+		size += info.Size
+	}
+	if plan[0].Bytes != size {
+		t.Fatalf("expected the plan to count %d bytes, got %d", size, plan[0].Bytes)
+	}
+	if idx.GetChunkMeta(ids["debug"]) == nil {
+		t.Fatal("dry run must not delete anything")
+	}
+}
+
+func TestEnforceCap_EvictsOldestFirst(t *testing.T) {
+	dir := t.TempDir()
+	writer := NewWriter(dir, 0, CompressionNone)
+	idx := index.NewIndex()
+
+	var ids []string
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 4; i++ {
+		labels := map[string]string{"app": "api", "shard": string(rune('a' + i))}
+		entries := testEntries(labels, 100)
+		for j := range entries {
+			entries[j].Timestamp = base.Add(time.Duration(i) * time.Minute)
+		}
+		chunkID, start, end, err := writer.WriteChunk(labels, entries)
+		if err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		idx.AddChunk(chunkID, labels, start, end, len(entries))
+		ids = append(ids, chunkID)
+	}
+
+	// Room for roughly two of the four chunks
+	total := storeSize(writer.store)
+	retention := NewRetention(idx, writer.store, RetentionPolicy{Period: 24 * time.Hour, MaxBytes: total / 2})
+	retention.EnforceCap()
+
+	if used := storeSize(writer.store); used > total/2 {
+		t.Fatalf("expected usage under %d, got %d", total/2, used)
+	}
+	if idx.GetChunkMeta(ids[0]) != nil || idx.GetChunkMeta(ids[3]) == nil {
+		t.Fatal("expected the oldest chunks to be evicted first")
+	}
+	if err := retention.CheckCapacity(); err != nil {
+		t.Fatalf("expected capacity after eviction, got %v", err)
+	}
+
+	// A cap below what any eviction can reach leaves storage full
+	full := NewRetention(index.NewIndex(), writer.store, RetentionPolicy{Period: 24 * time.Hour, MaxBytes: 1})
+	full.EnforceCap()
+	if err := full.CheckCapacity(); err != ErrStorageFull {
+		t.Fatalf("expected ErrStorageFull, got %v", err)
+	}
+}
+
+func TestCheckCapacity_CountsWritesBetweenChecks(t *testing.T) {
+	writer := NewWriter(t.TempDir(), 0, CompressionNone)
+	labels := map[string]string{"app": "api"}
+	if _, _, _, err := writer.WriteChunk(labels, testEntries(labels, 100)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	// Room for about one more chunk of the same size
+	size := storeSize(writer.store)
+	retention := NewRetention(index.NewIndex(), writer.store, RetentionPolicy{Period: 24 * time.Hour, MaxBytes: size * 2})
+	retention.EnforceCap()
+	writer.SetUsageRecorder(retention)
+
+	for i := 0; i < 2; i++ {
+		if err := retention.CheckCapacity(); err != nil {
+			t.Fatalf("write %d: expected capacity, got %v", i, err)
+		}
+		if _, _, _, err := writer.WriteChunk(labels, testEntries(labels, 100)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	// Usage is over the cap before the next EnforceCap measures it
+	if err := retention.CheckCapacity(); !errors.Is(err, ErrStorageOverCapacity) {
+		t.Fatalf("expected ErrStorageOverCapacity, got %v", err)
+	}
+}
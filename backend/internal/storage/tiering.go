@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logpulse/backend/internal/index"
+)
+
+// Storage tiers recorded in models.ChunkMeta.Tier
+const (
+	TierHot  = ""
+	TierCold = "cold"
+)
+
+// TieredStore is a ChunkStore that writes new chunks to a hot store and
+// serves reads from either tier. A Migrator moves old chunks to the cold
+// store.
+type TieredStore struct {
+	hot  ChunkStore
+	cold ChunkStore
+}
+
+// NewTieredStore combines a hot and a cold chunk store
+func NewTieredStore(hot, cold ChunkStore) *TieredStore {
+	return &TieredStore{hot: hot, cold: cold}
+}
+
+// Hot returns the store new chunks are written to
+func (t *TieredStore) Hot() ChunkStore {
+	return t.hot
+}
+
+// Cold returns the store old chunks are migrated to
+func (t *TieredStore) Cold() ChunkStore {
+	return t.cold
+}
+
+// coldFirst returns a view of the store that looks up keys in the cold
+// tier before the hot one. It is meant for reads only.
+func (t *TieredStore) coldFirst() *TieredStore {
+	return &TieredStore{hot: t.cold, cold: t.hot}
+}
+
+// Put writes data to the hot tier
+func (t *TieredStore) Put(key string, data []byte) error {
+	return t.hot.Put(key, data)
+}
+
+// Get opens key from the hot tier, falling back to the cold tier
+func (t *TieredStore) Get(key string) (io.ReadCloser, error) {
+	rc, err := t.hot.Get(key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return t.cold.Get(key)
+	}
+	return rc, err
+}
+
+// GetRange opens a section of key from the hot tier, falling back to the
+// cold tier
+func (t *TieredStore) GetRange(key string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := t.hot.GetRange(key, offset, length)
+	if errors.Is(err, ErrObjectNotFound) {
+		return t.cold.GetRange(key, offset, length)
+	}
+	return rc, err
+}
+
+// Stat describes key in the hot tier, falling back to the cold tier
+func (t *TieredStore) Stat(key string) (ObjectInfo, error) {
+	info, err := t.hot.Stat(key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return t.cold.Stat(key)
+	}
+	return info, err
+}
+
+// Delete removes key from both tiers
+func (t *TieredStore) Delete(key string) error {
+	if err := t.hot.Delete(key); err != nil {
+		return err
+	}
+	return t.cold.Delete(key)
+}
+
+// List describes the objects of both tiers. A key held by both, as left by
+// an interrupted migration, is listed once.
+func (t *TieredStore) List(prefix string) ([]ObjectInfo, error) {
+	objects, err := t.hot.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	coldObjects, err := t.cold.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(objects))
+	for _, obj := range objects {
+		seen[obj.Key] = struct{}{}
+	}
+	for _, obj := range coldObjects {
+		if _, ok := seen[obj.Key]; !ok {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// localStore returns the part of store new chunks are written to, which is
+// also the part that counts towards max_storage_bytes
+func localStore(store ChunkStore) ChunkStore {
+	if tiered, ok := store.(*TieredStore); ok {
+		return tiered.hot
+	}
+	return store
+}
+
+// storeTiers splits store into its tiers, hot first
+func storeTiers(store ChunkStore) ([]ChunkStore, []string) {
+	if tiered, ok := store.(*TieredStore); ok {
+		return []ChunkStore{tiered.hot, tiered.cold}, []string{TierHot, TierCold}
+	}
+	return []ChunkStore{store}, []string{TierHot}
+}
+
+// MigratorOptions controls migration of chunks to the cold tier
+type MigratorOptions struct {
+	// MinAge is how long after its end time a chunk moves to the cold tier
+	MinAge time.Duration
+	// Interval is the time between migration passes
+	Interval time.Duration
+}
+
+// Migrator moves chunks whose end time is older than MinAge from the hot
+// to the cold tier.
+//
+// A chunk is copied to the cold tier, data first, then the index is
+// switched to the cold tier and finally the hot copy is deleted. If a move
+// is interrupted before the index switch the chunk stays hot and is copied
+// again by the next pass; a hot copy left behind after the switch is
+// removed by the next pass.
+type Migrator struct {
+	store *TieredStore
+	index *index.Index
+	opts  MigratorOptions
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewMigrator creates a migrator for the chunks in store
+func NewMigrator(store *TieredStore, idx *index.Index, opts MigratorOptions) *Migrator {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Minute
+	}
+
+	return &Migrator{
+		store:    store,
+		index:    idx,
+		opts:     opts,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins periodic migration in the background
+func (m *Migrator) Start() {
+	m.wg.Add(1)
+	go m.run()
+}
+
+// Stop waits for the chunk being moved, if any, and stops the migrator
+func (m *Migrator) Stop() {
+	close(m.stopChan)
+	m.wg.Wait()
+}
+
+func (m *Migrator) run() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+
+	m.Migrate()
+	for {
+		select {
+		case <-ticker.C:
+			m.Migrate()
+		case <-m.stopChan:
+			return
+		}
+	}
+}
+
+// Migrate runs a single migration pass and returns the number of chunks
+// moved to the cold tier
+func (m *Migrator) Migrate() int {
+	start := time.Now()
+	m.cleanupMigrated()
+
+	var pending []string
+	for _, meta := range m.index.ChunksEndingBefore(start.Add(-m.opts.MinAge)) {
+		if meta.Tier != TierCold {
+			pending = append(pending, meta.ID)
+		}
+	}
+	migrationStarted(len(pending))
+
+	moved := 0
+	for _, chunkID := range pending {
+		select {
+		case <-m.stopChan:
+			migrationFinished()
+			return moved
+		default:
+		}
+
+		size, err := m.migrateChunk(chunkID)
+		if err != nil {
+			log.Printf("Failed to migrate chunk %s: %v", chunkID, err)
+			recordMigration(0, 0, 1)
+			continue
+		}
+		if size < 0 {
+			recordMigration(0, 0, 0)
+			continue
+		}
+		moved++
+		recordMigration(1, size, 0)
+	}
+
+	migrationFinished()
+	if moved > 0 {
+		log.Printf("Tiering: moved %d chunks to the cold tier in %v", moved, time.Since(start))
+	}
+	return moved
+}
+
+// migrateChunk moves one chunk to the cold tier and returns its size, or
+// -1 if the chunk was deleted or already moved in the meantime
+func (m *Migrator) migrateChunk(chunkID string) (int64, error) {
+	meta := m.index.GetChunkMeta(chunkID)
+	if meta == nil || meta.Tier == TierCold {
+		return -1, nil
+	}
+
+	_, err := copyObject(m.store.hot, manifestKey(meta.Labels), m.store.cold, manifestKey(meta.Labels))
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return 0, err
+	}
+
+	// Copy the metadata last so a cold chunk is only complete once both
+	// objects are there
+	var size int64
+	logKey, metaKey := chunkKeys(meta.Labels, meta.ID)
+	bloom := bloomKey(meta.Labels, meta.ID)
+	for _, key := range []string{logKey, bloom, metaKey} {
+		n, err := copyObject(m.store.hot, key, m.store.cold, key)
+		if key == bloom && errors.Is(err, ErrObjectNotFound) {
+			continue // chunks written before bloom filters have none
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+
+	// The index switch is the commit point of the move
+	if !m.index.SetChunkTier(chunkID, TierCold) {
+		// Deleted or compacted away while it was being copied
+		removeChunk(m.store.cold, meta.Labels, meta.ID)
+		return -1, nil
+	}
+
+	if _, err := removeChunk(m.store.hot, meta.Labels, meta.ID); err != nil {
+		log.Printf("Failed to remove hot copy of chunk %s: %v", chunkID, err)
+	}
+	return size, nil
+}
+
+// cleanupMigrated removes hot copies of chunks the index already places in
+// the cold tier, as left by a migration interrupted after its commit point
+func (m *Migrator) cleanupMigrated() {
+	objects, err := m.store.hot.List("")
+	if err != nil {
+		log.Printf("Tiering cleanup error: %v", err)
+		return
+	}
+
+	for _, obj := range objects {
+		if path.Ext(obj.Key) != ".meta" {
+			continue
+		}
+		chunkID := strings.TrimSuffix(path.Base(obj.Key), ".meta")
+		meta := m.index.GetChunkMeta(chunkID)
+		if meta == nil || meta.Tier != TierCold {
+			continue
+		}
+		if _, err := removeChunk(m.store.hot, meta.Labels, chunkID); err != nil {
+			log.Printf("Failed to remove hot copy of chunk %s: %v", chunkID, err)
+		}
+	}
+}
+
+// copyObject copies an object, possibly between stores, and returns its size
+func copyObject(from ChunkStore, fromKey string, to ChunkStore, toKey string) (int64, error) {
+	data, err := readObject(from, fromKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := to.Put(toKey, data); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
@@ -1,126 +1,212 @@
 package storage
 
 import (
-	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"maps"
+	"path"
+	"sort"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/logpulse/backend/internal/models"
 )
 
-// Writer handles writing log chunks to disk
+// ErrLabelHashCollision is returned when two label sets hash to the same
+// stream directory
+var ErrLabelHashCollision = errors.New("label hash collision")
+
+// Writer handles writing log chunks to a chunk store
 type Writer struct {
-	basePath  string
-	chunkSize int
-	chunkSeq  int64
-	mu        sync.Mutex
+	store       ChunkStore
+	chunkSize   int
+	compression Compression
+	mu          sync.Mutex
+
+	// Stream directories whose manifest matched their labels, by tier
+	verified map[string]struct{}
+
+	usage UsageRecorder
+}
+
+// UsageRecorder is told how many bytes each chunk written to local
+// storage takes
+type UsageRecorder interface {
+	AddUsage(bytes int64)
+}
+
+// NewWriter creates a new storage writer for chunks on the local filesystem
+func NewWriter(basePath string, chunkSize int, compression Compression) *Writer {
+	return NewStoreWriter(NewFSStore(basePath), chunkSize, compression)
 }
 
-// NewWriter creates a new storage writer
-func NewWriter(basePath string, chunkSize int) *Writer {
-	os.MkdirAll(basePath, 0755)
+// NewStoreWriter creates a new storage writer for chunks in store
+func NewStoreWriter(store ChunkStore, chunkSize int, compression Compression) *Writer {
 	return &Writer{
-		basePath:  basePath,
-		chunkSize: chunkSize,
+		store:       store,
+		chunkSize:   chunkSize,
+		compression: compression,
+		verified:    make(map[string]struct{}),
 	}
 }
 
-// WriteChunk writes a batch of logs to a new chunk file
-func (w *Writer) WriteChunk(labels map[string]string, entries []models.LogEntry) (string, time.Time, time.Time, error) {
+// SetUsageRecorder reports the size of every chunk written to local
+// storage to u
+func (w *Writer) SetUsageRecorder(u UsageRecorder) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	w.usage = u
+}
 
-	// Generate chunk ID
-	seq := atomic.AddInt64(&w.chunkSeq, 1)
-	chunkID := fmt.Sprintf("chunk_%d_%d", time.Now().Unix(), seq)
+// WriteChunk writes a batch of logs to a new chunk. The data is stored
+// before the metadata, and a chunk only counts as written once its
+// metadata is, so callers must index it only after WriteChunk returns.
+func (w *Writer) WriteChunk(labels map[string]string, entries []models.LogEntry) (string, time.Time, time.Time, error) {
+	return w.WriteChunkToTier(TierHot, labels, entries)
+}
 
-	// Create directory for label set
-	labelPath := models.Labels(labels).ToPath()
-	dirPath := filepath.Join(w.basePath, labelPath)
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return "", time.Time{}, time.Time{}, err
+// WriteChunkToTier is WriteChunk for a chunk stored in the given tier, such
+// as the rewrite of a cold chunk. Without a cold store every chunk is hot.
+func (w *Writer) WriteChunkToTier(tier string, labels map[string]string, entries []models.LogEntry) (string, time.Time, time.Time, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	store := localStore(w.store)
+	local := true
+	if tiered, ok := w.store.(*TieredStore); ok && tier == TierCold {
+		store = tiered.cold
+		local = false
 	}
 
-	// Create chunk file
-	chunkPath := filepath.Join(dirPath, chunkID+".log")
-	file, err := os.Create(chunkPath)
+	chunkID, err := newChunkID()
 	if err != nil {
 		return "", time.Time{}, time.Time{}, err
 	}
-	defer file.Close()
+	logKey, metaKey := chunkKeys(labels, chunkID)
 
-	// Write entries
-	writer := bufio.NewWriter(file)
-	var startTime, endTime time.Time
+	// Hold the manifest until the chunk data is in the stream directory
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	if err := w.ensureManifest(store, tier, labels); err != nil {
+		return "", time.Time{}, time.Time{}, err
+	}
 
-	for i, entry := range entries {
-		if i == 0 {
-			startTime = entry.Timestamp
-		}
-		endTime = entry.Timestamp
+	// Blocks carry min/max timestamps, so store entries in time order
+	sorted := make([]models.LogEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
 
-		// Write as JSON line
-		line, _ := json.Marshal(entry)
-		writer.Write(line)
-		writer.WriteByte('\n')
+	var startTime, endTime time.Time
+	if len(sorted) > 0 {
+		startTime = sorted[0].Timestamp
+		endTime = sorted[len(sorted)-1].Timestamp
 	}
 
-	if err := writer.Flush(); err != nil {
+	var data bytes.Buffer
+	if err := encodeChunk(&data, labels, sorted, w.compression); err != nil {
+		return "", time.Time{}, time.Time{}, err
+	}
+	if err := store.Put(logKey, data.Bytes()); err != nil {
+		return "", time.Time{}, time.Time{}, err
+	}
+	bloom := buildBloom(sorted).marshal()
+	if err := store.Put(bloomKey(labels, chunkID), bloom); err != nil {
 		return "", time.Time{}, time.Time{}, err
 	}
 
-	// Write metadata file
+	// Write metadata
 	meta := models.ChunkMeta{
 		ID:         chunkID,
 		Labels:     labels,
 		StartTime:  startTime.Unix(),
 		EndTime:    endTime.Unix(),
 		EntryCount: len(entries),
+		Size:       int64(data.Len()),
+		Checksum:   chunkChecksum(data.Bytes()),
 	}
 
-	metaPath := filepath.Join(dirPath, chunkID+".meta")
-	metaFile, err := os.Create(metaPath)
-	if err != nil {
+	if err := putMeta(store, metaKey, &meta); err != nil {
 		return "", time.Time{}, time.Time{}, err
 	}
-	defer metaFile.Close()
-
-	json.NewEncoder(metaFile).Encode(meta)
+	if w.usage != nil && local {
+		w.usage.AddUsage(int64(data.Len() + len(bloom)))
+	}
 
 	return chunkID, startTime, endTime, nil
 }
 
-// GetStorageSize returns total storage used in bytes
-func (w *Writer) GetStorageSize() int64 {
-	var size int64
-	filepath.Walk(w.basePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+// newChunkID returns an ID that no other writer, before or after a
+// restart, hands out. Reusing an ID would overwrite that chunk's files and
+// replace its index entry.
+func newChunkID() (string, error) {
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("chunk_%d_%s", time.Now().UnixNano(), hex.EncodeToString(suffix[:])), nil
+}
+
+// ensureManifest writes the manifest of a stream directory if it is
+// missing, and checks that an existing one belongs to the same labels. The
+// manifest is looked up on every call, as removing the last chunk of a
+// stream drops it. Caller must hold w.mu and manifestMu.
+func (w *Writer) ensureManifest(store ChunkStore, tier string, labels map[string]string) error {
+	key := manifestKey(labels)
+	verifiedKey := path.Join(tier, key)
+
+	_, err := store.Stat(key)
+	if err == nil {
+		if _, ok := w.verified[verifiedKey]; ok {
 			return nil
 		}
-		if !info.IsDir() {
-			size += info.Size()
+		manifest, err := readManifest(store, key)
+		if err != nil {
+			return err
+		}
+		if !maps.Equal(manifest.Labels, labels) {
+			return fmt.Errorf("%w: %v and %v share %s", ErrLabelHashCollision, manifest.Labels, labels, path.Dir(key))
 		}
+		w.verified[verifiedKey] = struct{}{}
 		return nil
-	})
-	return size
+	}
+	if !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+
+	data, err := json.Marshal(streamManifest{Labels: labels})
+	if err != nil {
+		return err
+	}
+	if err := store.Put(key, append(data, '\n')); err != nil {
+		return err
+	}
+	w.verified[verifiedKey] = struct{}{}
+	return nil
+}
+
+// GetStorageSize returns total storage used in bytes
+func (w *Writer) GetStorageSize() int64 {
+	return storeSize(w.store)
 }
 
 // GetChunkCount returns total number of chunks
 func (w *Writer) GetChunkCount() int {
+	objects, err := w.store.List("")
+	if err != nil {
+		return 0
+	}
+
 	count := 0
-	filepath.Walk(w.basePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if !info.IsDir() && filepath.Ext(path) == ".log" {
+	for _, obj := range objects {
+		if path.Ext(obj.Key) == ".log" {
 			count++
 		}
-		return nil
-	})
+	}
 	return count
 }
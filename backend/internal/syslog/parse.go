@@ -0,0 +1,210 @@
+// Package syslog receives syslog messages over TCP and UDP and ingests them
+// as log streams
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMessage is returned for a message that cannot be parsed
+var ErrInvalidMessage = errors.New("invalid syslog message")
+
+// Defaults for messages without a priority, per RFC 3164 section 4.3.3
+const (
+	defaultFacility = 1 // user
+	defaultSeverity = 5 // notice
+)
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var severityNames = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// Message is a parsed syslog message. Fields the message leaves out are
+// empty.
+type Message struct {
+	Facility       int
+	Severity       int
+	Timestamp      time.Time // zero if the message has none
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData string // RFC 5424 only, as sent
+	Message        string
+}
+
+// FacilityName returns the keyword of the message's facility
+func (m *Message) FacilityName() string {
+	return facilityNames[m.Facility]
+}
+
+// SeverityName returns the keyword of the message's severity
+func (m *Message) SeverityName() string {
+	return severityNames[m.Severity]
+}
+
+// Parse parses an RFC 5424 or BSD (RFC 3164) syslog message. BSD
+// timestamps carry no year or zone; they are read in loc and placed in
+// the year that puts them closest before now.
+func Parse(data []byte, now time.Time, loc *time.Location) (*Message, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+	msg := &Message{Facility: defaultFacility, Severity: defaultSeverity}
+
+	rest := string(data)
+	if strings.HasPrefix(rest, "<") {
+		end := strings.IndexByte(rest, '>')
+		if end < 2 || end > 4 {
+			return nil, ErrInvalidMessage
+		}
+		pri, err := strconv.Atoi(rest[1:end])
+		if err != nil || pri < 0 || pri >= len(facilityNames)*8 {
+			return nil, ErrInvalidMessage
+		}
+		msg.Facility, msg.Severity = pri/8, pri%8
+		rest = rest[end+1:]
+
+		if strings.HasPrefix(rest, "1 ") {
+			if err := parseRFC5424(msg, rest[2:]); err != nil {
+				return nil, err
+			}
+			return msg, nil
+		}
+	}
+
+	parseRFC3164(msg, rest, now, loc)
+	return msg, nil
+}
+
+// parseRFC5424 parses the header after the version, the structured data
+// and the message
+func parseRFC5424(msg *Message, rest string) error {
+	var fields [5]string
+	for i := range fields {
+		field, tail, ok := strings.Cut(rest, " ")
+		if !ok || field == "" {
+			return ErrInvalidMessage
+		}
+		if field != "-" {
+			fields[i] = field
+		}
+		rest = tail
+	}
+
+	if fields[0] != "" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return ErrInvalidMessage
+		}
+		msg.Timestamp = ts
+	}
+	msg.Hostname, msg.AppName, msg.ProcID, msg.MsgID = fields[1], fields[2], fields[3], fields[4]
+
+	sd, rest, err := cutStructuredData(rest)
+	if err != nil {
+		return err
+	}
+	msg.StructuredData = sd
+
+	rest = strings.TrimPrefix(rest, " ")
+	msg.Message = strings.TrimPrefix(rest, "\ufeff") // byte order mark of UTF-8 messages
+	return nil
+}
+
+// cutStructuredData splits structured data, "-" or a series of
+// [id param="value" ...] elements, from the rest of a message
+func cutStructuredData(s string) (sd, rest string, err error) {
+	if strings.HasPrefix(s, "-") {
+		return "", s[1:], nil
+	}
+
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		inValue := false
+		for i++; ; i++ {
+			if i >= len(s) {
+				return "", "", ErrInvalidMessage
+			}
+			c := s[i]
+			if inValue && c == '\\' {
+				i++
+				continue
+			}
+			if c == '"' {
+				inValue = !inValue
+			}
+			if c == ']' && !inValue {
+				i++
+				break
+			}
+		}
+	}
+	if i == 0 {
+		return "", "", ErrInvalidMessage
+	}
+	return s[:i], s[i:], nil
+}
+
+// parseRFC3164 parses a BSD syslog message after the priority:
+// "Mmm dd hh:mm:ss hostname tag[pid]: message", any part of which may be
+// missing. Some senders use an RFC 3339 timestamp instead.
+func parseRFC3164(msg *Message, rest string, now time.Time, loc *time.Location) {
+	if len(rest) >= len(time.Stamp) {
+		if ts, err := time.ParseInLocation(time.Stamp, rest[:len(time.Stamp)], loc); err == nil {
+			msg.Timestamp = inferYear(ts, now)
+			rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+		}
+	}
+	if msg.Timestamp.IsZero() {
+		if field, tail, ok := strings.Cut(rest, " "); ok {
+			if ts, err := time.Parse(time.RFC3339Nano, field); err == nil {
+				msg.Timestamp = ts
+				rest = tail
+			}
+		}
+	}
+
+	// The hostname is only present after a timestamp, and a tag ends in
+	// a colon or process ID
+	if !msg.Timestamp.IsZero() {
+		if field, tail, ok := strings.Cut(rest, " "); ok && field != "" && !strings.ContainsAny(field, ":[") {
+			msg.Hostname = field
+			rest = tail
+		}
+	}
+
+	end := strings.IndexAny(rest, "[: ")
+	if end > 0 && end <= 48 && rest[end] != ' ' {
+		msg.AppName = rest[:end]
+		rest = rest[end:]
+		if rest[0] == '[' {
+			if pidEnd := strings.IndexByte(rest, ']'); pidEnd > 0 {
+				msg.ProcID = rest[1:pidEnd]
+				rest = rest[pidEnd+1:]
+			}
+		}
+		rest = strings.TrimPrefix(rest, ":")
+		rest = strings.TrimPrefix(rest, " ")
+	}
+	msg.Message = rest
+}
+
+// inferYear places a timestamp without a year in the year of now, or the
+// year before if that would put it more than a day in the future
+func inferYear(ts, now time.Time) time.Time {
+	year := now.In(ts.Location()).Year()
+	ts = time.Date(year, ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), ts.Location())
+	if ts.After(now.Add(24 * time.Hour)) {
+		ts = ts.AddDate(-1, 0, 0)
+	}
+	return ts
+}
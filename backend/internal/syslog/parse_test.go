@@ -0,0 +1,90 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		in   string
+		want Message
+	}{
+		{
+			name: "rfc5424",
+			in:   `<165>1 2024-01-15T10:00:00.5Z web-1 nginx 1234 ID47 [exampleSDID@32473 iut="3" eventSource="App]lication"] request served` + "\n",
+			want: Message{
+				Facility: 20, Severity: 5,
+				Timestamp: time.Date(2024, 1, 15, 10, 0, 0, 500000000, time.UTC),
+				Hostname:  "web-1", AppName: "nginx", ProcID: "1234", MsgID: "ID47",
+				StructuredData: `[exampleSDID@32473 iut="3" eventSource="App]lication"]`,
+				Message:        "request served",
+			},
+		},
+		{
+			name: "rfc5424 nil values",
+			in:   "<14>1 - - - - - -",
+			want: Message{Facility: 1, Severity: 6},
+		},
+		{
+			name: "rfc3164",
+			in:   "<34>Jan  5 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8",
+			want: Message{
+				Facility: 4, Severity: 2,
+				Timestamp: time.Date(2024, 1, 5, 22, 14, 15, 0, time.UTC),
+				Hostname:  "mymachine", AppName: "su", ProcID: "230",
+				Message: "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name: "rfc3164 previous year",
+			in:   "<13>Dec 31 23:59:59 host cron: job done",
+			want: Message{
+				Facility: 1, Severity: 5,
+				Timestamp: time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+				Hostname:  "host", AppName: "cron",
+				Message: "job done",
+			},
+		},
+		{
+			name: "rfc3164 without hostname",
+			in:   "<30>Jan 15 11:00:00 sshd[99]: accepted key",
+			want: Message{
+				Facility: 3, Severity: 6,
+				Timestamp: time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+				AppName:   "sshd", ProcID: "99",
+				Message: "accepted key",
+			},
+		},
+		{
+			name: "no priority",
+			in:   "link down on port 3",
+			want: Message{Facility: 1, Severity: 5, Message: "link down on port 3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.in), now, time.UTC)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("timestamp: expected %v, got %v", tt.want.Timestamp, got.Timestamp)
+			}
+			got.Timestamp, tt.want.Timestamp = time.Time{}, time.Time{}
+			if *got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, *got)
+			}
+		})
+	}
+
+	for _, bad := range []string{"<999>1 - - - - - -", "<14>1 2024-01-15T10:00:00Z host", "<14>1 - - - - - [unterminated"} {
+		if _, err := Parse([]byte(bad), now, time.UTC); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+)
+
+// maxDatagramSize is the largest UDP payload
+const maxDatagramSize = 65535
+
+// maxOctetDigits is the longest octet count of a TCP frame
+const maxOctetDigits = 10
+
+// Sink ingests batches of log streams, typically an ingest.Ingestor
+type Sink interface {
+	Ingest(req *models.IngestRequest) (int, error)
+}
+
+// Options configures a syslog server. An empty address disables that
+// listener.
+type Options struct {
+	TCPAddress     string
+	UDPAddress     string
+	MaxMessageSize int               // longer TCP messages close the connection; default 64KiB
+	BatchSize      int               // messages per ingest call; default 1000
+	FlushInterval  time.Duration     // longest a message waits for its batch; default 1s
+	Labels         map[string]string // added to every stream
+	Location       *time.Location    // zone of BSD timestamps; default local time
+}
+
+// Server receives syslog messages and ingests them in batches. Each
+// message becomes an entry of the stream labelled with its facility,
+// severity, hostname and app name.
+//
+// A batch the sink fails to ingest is kept and retried at the next flush.
+// Until a retry succeeds, TCP connections stop being read once a full
+// batch is waiting, which pushes back on senders, and datagrams beyond a
+// full batch are dropped.
+type Server struct {
+	sink Sink
+	opts Options
+
+	tcp net.Listener
+	udp net.PacketConn
+
+	mu        sync.Mutex
+	batch     map[string]*models.Stream
+	size      int
+	dropped   int  // invalid messages
+	discarded int  // datagrams received while the batch was full
+	failing   bool // the last ingest failed
+	retried   *sync.Cond
+	conns     map[net.Conn]struct{}
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a syslog server feeding sink
+func NewServer(sink Sink, opts Options) *Server {
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = 64 * 1024
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+
+	s := &Server{
+		sink:     sink,
+		opts:     opts,
+		batch:    make(map[string]*models.Stream),
+		conns:    make(map[net.Conn]struct{}),
+		stopChan: make(chan struct{}),
+	}
+	s.retried = sync.NewCond(&s.mu)
+	return s
+}
+
+// Start opens the listeners and begins receiving messages
+func (s *Server) Start() error {
+	if s.opts.TCPAddress != "" {
+		ln, err := net.Listen("tcp", s.opts.TCPAddress)
+		if err != nil {
+			return fmt.Errorf("syslog tcp listener: %w", err)
+		}
+		s.tcp = ln
+		log.Printf("Syslog: listening on tcp %s", ln.Addr())
+	}
+	if s.opts.UDPAddress != "" {
+		conn, err := net.ListenPacket("udp", s.opts.UDPAddress)
+		if err != nil {
+			if s.tcp != nil {
+				s.tcp.Close()
+			}
+			return fmt.Errorf("syslog udp listener: %w", err)
+		}
+		s.udp = conn
+		log.Printf("Syslog: listening on udp %s", conn.LocalAddr())
+	}
+
+	if s.tcp != nil {
+		s.wg.Add(1)
+		go s.acceptTCP()
+	}
+	if s.udp != nil {
+		s.wg.Add(1)
+		go s.serveUDP()
+	}
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// Stop closes the listeners and connections and ingests the last batch
+func (s *Server) Stop() {
+	close(s.stopChan)
+	if s.tcp != nil {
+		s.tcp.Close()
+	}
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.retried.Broadcast()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.flush()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size > 0 {
+		log.Printf("Syslog: dropping %d messages that could not be ingested", s.size)
+	}
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+func (s *Server) acceptTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			select {
+			case <-s.stopChan:
+				return
+			default:
+			}
+			log.Printf("Syslog: accept failed: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		// Stop closes the connections registered before it
+		s.mu.Lock()
+		select {
+		case <-s.stopChan:
+			s.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn reads messages from a TCP connection until it is closed
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(r, s.opts.MaxMessageSize)
+		if err != nil {
+			select {
+			case <-s.stopChan:
+			default:
+				if !errors.Is(err, io.EOF) {
+					log.Printf("Syslog: closing connection from %s: %v", conn.RemoteAddr(), err)
+				}
+			}
+			return
+		}
+		s.receive(frame, true)
+	}
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-s.stopChan:
+				return
+			default:
+			}
+			log.Printf("Syslog: udp read failed: %v", err)
+			continue
+		}
+		s.receive(buf[:n], false)
+	}
+}
+
+// readFrame reads one message from a TCP stream. Messages are either
+// octet counted, "length SP message", or end at a newline (RFC 6587).
+func readFrame(r *bufio.Reader, maxSize int) ([]byte, error) {
+	if _, err := r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	if isOctetCounted(r) {
+		prefix, err := r.ReadSlice(' ')
+		if err != nil {
+			return nil, fmt.Errorf("invalid octet count: %w", err)
+		}
+		n, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid octet count %q", prefix)
+		}
+		if n > maxSize {
+			return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d", n, maxSize)
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	// Lines over the limit are truncated
+	var frame []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		if room := maxSize - len(frame); room > 0 {
+			frame = append(frame, line[:min(len(line), room)]...)
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && len(frame) > 0:
+			return frame, nil
+		case err != nil:
+			return nil, err
+		}
+		return frame, nil
+	}
+}
+
+// isOctetCounted reports whether the buffered stream starts with an octet
+// count: digits without a leading zero, then a space. Anything else, such
+// as a message starting with a date, is newline framed.
+func isOctetCounted(r *bufio.Reader) bool {
+	for i := 1; i <= maxOctetDigits+1; i++ {
+		peeked, err := r.Peek(i)
+		if err != nil {
+			return false
+		}
+		switch c := peeked[i-1]; {
+		case c == ' ':
+			return i > 1
+		case c < '0' || c > '9' || (i == 1 && c == '0'):
+			return false
+		}
+	}
+	return false
+}
+
+// receive parses a message and adds it to the batch, ingesting the batch
+// once it is full. While a full batch waits to be retried, wait blocks
+// until the retry succeeds; otherwise the message is dropped.
+func (s *Server) receive(data []byte, wait bool) {
+	now := time.Now()
+	msg, err := Parse(data, now, s.opts.Location)
+
+	s.mu.Lock()
+	if err != nil {
+		s.dropped++
+		s.mu.Unlock()
+		return
+	}
+	for s.failing && s.size >= s.opts.BatchSize {
+		if !wait || s.stopping() {
+			s.discarded++
+			s.mu.Unlock()
+			return
+		}
+		s.retried.Wait()
+	}
+	s.addLocked(msg, now)
+	full := s.size >= s.opts.BatchSize
+	s.mu.Unlock()
+
+	if full {
+		s.flush()
+	}
+}
+
+// addLocked adds a message to the stream for its labels. Caller must hold
+// s.mu.
+func (s *Server) addLocked(msg *Message, now time.Time) {
+	labels := make(map[string]string, len(s.opts.Labels)+4)
+	for k, v := range s.opts.Labels {
+		labels[k] = v
+	}
+	labels["facility"] = msg.FacilityName()
+	labels["severity"] = msg.SeverityName()
+	if msg.Hostname != "" {
+		labels["hostname"] = msg.Hostname
+	}
+	if msg.AppName != "" {
+		labels["app_name"] = msg.AppName
+	}
+
+	metadata := make(map[string]string)
+	if msg.ProcID != "" {
+		metadata["proc_id"] = msg.ProcID
+	}
+	if msg.MsgID != "" {
+		metadata["msg_id"] = msg.MsgID
+	}
+	if msg.StructuredData != "" {
+		metadata["structured_data"] = msg.StructuredData
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+
+	ts := msg.Timestamp
+	if ts.IsZero() {
+		ts = now
+	}
+
+	key := models.Labels(labels).Hash()
+	stream, ok := s.batch[key]
+	if !ok {
+		stream = &models.Stream{Labels: labels}
+		s.batch[key] = stream
+	}
+	stream.Entries = append(stream.Entries, models.Entry{
+		Ts:       ts.UTC().Format(time.RFC3339Nano),
+		Line:     msg.Message,
+		Metadata: metadata,
+	})
+	s.size++
+}
+
+// stopping reports whether Stop was called
+func (s *Server) stopping() bool {
+	select {
+	case <-s.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// flush ingests the current batch. A batch that fails is put back in front
+// of the messages received meanwhile, to be retried by the next flush.
+// Streams the sink took before failing may then be ingested twice.
+func (s *Server) flush() {
+	s.mu.Lock()
+	batch, size, dropped, discarded := s.batch, s.size, s.dropped, s.discarded
+	s.batch, s.size, s.dropped, s.discarded = make(map[string]*models.Stream), 0, 0, 0
+	s.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("Syslog: dropped %d invalid messages", dropped)
+	}
+	if discarded > 0 {
+		log.Printf("Syslog: dropped %d datagrams while ingestion was failing", discarded)
+	}
+	if size == 0 {
+		return
+	}
+
+	req := &models.IngestRequest{Streams: make([]models.Stream, 0, len(batch))}
+	for _, stream := range batch {
+		req.Streams = append(req.Streams, *stream)
+	}
+	_, err := s.sink.Ingest(req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		log.Printf("Syslog: failed to ingest %d messages, retrying: %v", size, err)
+		for key, stream := range s.batch {
+			if failed, ok := batch[key]; ok {
+				failed.Entries = append(failed.Entries, stream.Entries...)
+			} else {
+				batch[key] = stream
+			}
+		}
+		s.batch = batch
+		s.size += size
+		s.failing = true
+		return
+	}
+	s.failing = false
+	s.retried.Broadcast()
+}
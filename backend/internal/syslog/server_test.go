@@ -0,0 +1,203 @@
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/logpulse/backend/internal/models"
+)
+
+// recordingSink keeps every stream it is asked to ingest
+type recordingSink struct {
+	mu      sync.Mutex
+	streams []models.Stream
+}
+
+func (s *recordingSink) Ingest(req *models.IngestRequest) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams = append(s.streams, req.Streams...)
+	return len(req.Streams), nil
+}
+
+func TestServer_TCPAndUDP(t *testing.T) {
+	sink := &recordingSink{}
+	server := NewServer(sink, Options{
+		TCPAddress:    "127.0.0.1:0",
+		UDPAddress:    "127.0.0.1:0",
+		FlushInterval: time.Hour,
+		Labels:        map[string]string{"job": "syslog"},
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	// Octet counting and newline framing on one connection
+	conn, err := net.Dial("tcp", server.tcp.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	counted := "<165>1 2024-01-15T10:00:00Z web-1 nginx - - - multi\nline"
+	fmt.Fprintf(conn, "%d %s", len(counted), counted)
+	fmt.Fprint(conn, "<165>1 2024-01-15T10:00:01Z web-1 nginx - - - second\n")
+	conn.Close()
+
+	udp, err := net.Dial("udp", server.udp.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	fmt.Fprint(udp, "<34>Jan 15 10:00:02 router-1 kernel: link down")
+	udp.Close()
+
+	// Stop closes connections and drops datagrams that have not been read
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.mu.Lock()
+		size := server.size
+		server.mu.Unlock()
+		if size == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	server.Stop()
+
+	entries := make(map[string]models.Entry)
+	labels := make(map[string]map[string]string)
+	for _, stream := range sink.streams {
+		for _, entry := range stream.Entries {
+			entries[entry.Line] = entry
+			labels[entry.Line] = stream.Labels
+		}
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %v", entries)
+	}
+
+	if got := entries["multi\nline"].Ts; got != "2024-01-15T10:00:00Z" {
+		t.Errorf("unexpected timestamp %s", got)
+	}
+	want := map[string]string{"job": "syslog", "facility": "local4", "severity": "notice", "hostname": "web-1", "app_name": "nginx"}
+	if fmt.Sprint(labels["second"]) != fmt.Sprint(want) {
+		t.Errorf("expected labels %v, got %v", want, labels["second"])
+	}
+	if got := labels["link down"]; got["facility"] != "auth" || got["severity"] != "crit" || got["hostname"] != "router-1" {
+		t.Errorf("unexpected labels %v", got)
+	}
+}
+
+// flakySink fails to ingest until healed, then records like recordingSink
+type flakySink struct {
+	recordingSink
+	failures int
+	healed   bool
+}
+
+func (s *flakySink) Ingest(req *models.IngestRequest) (int, error) {
+	s.mu.Lock()
+	if !s.healed {
+		s.failures++
+		s.mu.Unlock()
+		return 0, errors.New("storage is full")
+	}
+	s.mu.Unlock()
+	return s.recordingSink.Ingest(req)
+}
+
+func TestServer_RetriesFailedBatches(t *testing.T) {
+	sink := &flakySink{}
+	server := NewServer(sink, Options{
+		TCPAddress:    "127.0.0.1:0",
+		BatchSize:     2,
+		FlushInterval: 20 * time.Millisecond,
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.tcp.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(conn, "<165>1 2024-01-15T10:00:0%dZ web-1 nginx - - - line %d\n", i, i)
+	}
+
+	// The failed batch is retried, and the connection is not read past it
+	waitFor(t, func() bool {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		return sink.failures >= 3
+	})
+	server.mu.Lock()
+	size := server.size
+	server.mu.Unlock()
+	if size != 2 {
+		t.Fatalf("expected only the failed batch to be held, got %d messages", size)
+	}
+
+	sink.mu.Lock()
+	sink.healed = true
+	sink.mu.Unlock()
+
+	lines := make(map[string]int)
+	waitFor(t, func() bool {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		clear(lines)
+		for _, stream := range sink.streams {
+			for _, entry := range stream.Entries {
+				lines[entry.Line]++
+			}
+		}
+		return len(lines) == 5
+	})
+	for line, count := range lines {
+		if count != 1 {
+			t.Errorf("expected %q once, got %d times", line, count)
+		}
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after 5 seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	// Only digits followed by a space are an octet count
+	r := bufio.NewReader(strings.NewReader("11 <34>counted" +
+		"2024-01-15 10:00:00 web-1 starts with a date\n" +
+		"0 leading zero\n" +
+		"4 tail"))
+
+	for i, want := range []string{
+		"<34>counted",
+		"2024-01-15 10:00:00 web-1 starts with a date\n",
+		"0 leading zero\n",
+		"tail",
+	} {
+		frame, err := readFrame(r, 1024)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if string(frame) != want {
+			t.Fatalf("frame %d: expected %q, got %q", i, want, frame)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls when appended records are fsynced
+type SyncPolicy string
+
+const (
+	// SyncAlways fsyncs before every acknowledged write
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsyncs periodically in the background
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system
+	SyncNever SyncPolicy = "never"
+)
+
+const (
+	segmentExt = ".wal"
+
+	// recordHeaderSize is the length and CRC32 prefix of every record
+	recordHeaderSize = 8
+
+	// maxRecordSize guards against reading garbage lengths from torn writes
+	maxRecordSize = 64 * 1024 * 1024
+)
+
+var (
+	ErrClosed        = errors.New("wal is closed")
+	ErrCorruptRecord = errors.New("corrupt wal record")
+)
+
+// Options configures a WAL
+type Options struct {
+	SegmentSize  int64
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+}
+
+// RecordType identifies the kind of a WAL record
+type RecordType string
+
+const (
+	// RecordEntries holds log entries accepted for a stream
+	RecordEntries RecordType = "entries"
+	// RecordFlushed marks a stream's entries as written to a chunk
+	RecordFlushed RecordType = "flushed"
+)
+
+// Entry is a log line stored in the WAL
+type Entry struct {
+	ID        string            `json:"id"`
+	Timestamp int64             `json:"ts"` // Unix nanoseconds
+	Line      string            `json:"line"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// Record is a single WAL record. For RecordFlushed, Seq is the last
+// sequence number of the stream that reached storage.
+type Record struct {
+	Type    RecordType        `json:"type"`
+	Seq     uint64            `json:"seq"`
+	Stream  string            `json:"stream"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Entries []Entry           `json:"entries,omitempty"`
+}
+
+// pendingStream tracks a stream with records not yet flushed to storage
+type pendingStream struct {
+	firstSegment int
+	lastSeq      uint64
+}
+
+// WAL is a segmented write-ahead log for buffered ingest data.
+// Segments are deleted once every stream with records in them has been
+// flushed to storage.
+type WAL struct {
+	dir  string
+	opts Options
+
+	mu          sync.Mutex
+	segment     *os.File
+	segmentNum  int
+	segmentSize int64
+	nextSeq     uint64
+	pending     map[string]*pendingStream
+	dirty       bool
+	closed      bool
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Open opens or creates a WAL in dir
+func Open(dir string, opts Options) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 64 * 1024 * 1024
+	}
+	if opts.Sync == "" {
+		opts.Sync = SyncAlways
+	}
+	switch opts.Sync {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("unknown wal sync policy %q", opts.Sync)
+	}
+	if opts.Sync == SyncInterval && opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+
+	w := &WAL{
+		dir:      dir,
+		opts:     opts,
+		nextSeq:  1,
+		pending:  make(map[string]*pendingStream),
+		stopChan: make(chan struct{}),
+	}
+
+	segments, err := w.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		w.segmentNum = segments[len(segments)-1]
+	}
+
+	return w, nil
+}
+
+// Replay calls fn for every entries record that has not been flushed yet,
+// in write order, then opens a fresh segment for appending. It must be
+// called once before Append.
+func (w *WAL) Replay(fn func(rec *Record) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	segments, err := w.listSegments()
+	if err != nil {
+		return err
+	}
+
+	// First pass: find how far each stream has been flushed
+	flushed := make(map[string]uint64)
+	err = w.readSegments(segments, func(segment int, rec *Record) error {
+		if rec.Seq >= w.nextSeq {
+			w.nextSeq = rec.Seq + 1
+		}
+		if rec.Type == RecordFlushed && rec.Seq > flushed[rec.Stream] {
+			flushed[rec.Stream] = rec.Seq
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Second pass: hand back everything newer than its stream's flush mark
+	replayed := 0
+	err = w.readSegments(segments, func(segment int, rec *Record) error {
+		if rec.Type != RecordEntries || rec.Seq <= flushed[rec.Stream] {
+			return nil
+		}
+
+		p, ok := w.pending[rec.Stream]
+		if !ok {
+			p = &pendingStream{firstSegment: segment}
+			w.pending[rec.Stream] = p
+		}
+		p.lastSeq = rec.Seq
+
+		replayed++
+		return fn(rec)
+	})
+	if err != nil {
+		return err
+	}
+
+	if replayed > 0 {
+		log.Printf("WAL: replayed %d unflushed records from %d segment(s)", replayed, len(segments))
+	}
+
+	if err := w.openSegment(w.segmentNum + 1); err != nil {
+		return err
+	}
+	w.removeFlushedSegments()
+
+	if w.opts.Sync == SyncInterval {
+		w.wg.Add(1)
+		go w.syncWorker()
+	}
+
+	return nil
+}
+
+// Append writes an entries record for a stream and returns its sequence
+// number. The record is durable once Sync returns.
+func (w *WAL) Append(stream string, labels map[string]string, entries []Entry) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || w.segment == nil {
+		return 0, ErrClosed
+	}
+
+	rec := &Record{
+		Type:    RecordEntries,
+		Seq:     w.nextSeq,
+		Stream:  stream,
+		Labels:  labels,
+		Entries: entries,
+	}
+	if err := w.writeRecord(rec); err != nil {
+		return 0, err
+	}
+	w.nextSeq++
+
+	p, ok := w.pending[stream]
+	if !ok {
+		p = &pendingStream{firstSegment: w.segmentNum}
+		w.pending[stream] = p
+	}
+	p.lastSeq = rec.Seq
+
+	return rec.Seq, nil
+}
+
+// Sync makes appended records durable according to the sync policy
+func (w *WAL) Sync() error {
+	if w.opts.Sync != SyncAlways {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.syncLocked()
+}
+
+// MarkFlushed checkpoints a stream: every record up to seq has reached
+// storage and no longer needs replaying. Segments holding only flushed
+// records are deleted.
+func (w *WAL) MarkFlushed(stream string, seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || w.segment == nil {
+		return ErrClosed
+	}
+
+	if err := w.writeRecord(&Record{Type: RecordFlushed, Seq: seq, Stream: stream}); err != nil {
+		return err
+	}
+
+	if p, ok := w.pending[stream]; ok && seq >= p.lastSeq {
+		delete(w.pending, stream)
+	}
+
+	w.removeFlushedSegments()
+	return nil
+}
+
+// Close syncs and closes the WAL
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.stopChan)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.segment == nil {
+		return nil
+	}
+	err := w.syncLocked()
+	if cerr := w.segment.Close(); err == nil {
+		err = cerr
+	}
+	w.segment = nil
+	return err
+}
+
+// writeRecord frames and writes a record, rolling to a new segment when the
+// current one is full. Caller must hold w.mu.
+func (w *WAL) writeRecord(rec *Record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if w.segmentSize > 0 && w.segmentSize+int64(len(payload))+recordHeaderSize > w.opts.SegmentSize {
+		if err := w.syncLocked(); err != nil {
+			return err
+		}
+		if err := w.segment.Close(); err != nil {
+			return err
+		}
+		if err := w.openSegment(w.segmentNum + 1); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+
+	n, err := w.segment.Write(buf)
+	w.segmentSize += int64(n)
+	if err != nil {
+		return err
+	}
+
+	w.dirty = true
+	return nil
+}
+
+// syncLocked fsyncs the current segment. Caller must hold w.mu.
+func (w *WAL) syncLocked() error {
+	if w.segment == nil || !w.dirty {
+		return nil
+	}
+	if err := w.segment.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+	return nil
+}
+
+// syncWorker periodically fsyncs for SyncInterval
+func (w *WAL) syncWorker() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			if err := w.syncLocked(); err != nil {
+				log.Printf("WAL sync failed: %v", err)
+			}
+			w.mu.Unlock()
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+// openSegment creates a new segment file. Caller must hold w.mu.
+func (w *WAL) openSegment(num int) error {
+	file, err := os.OpenFile(w.segmentPath(num), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Make the new segment's directory entry durable
+	if dir, err := os.Open(w.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	w.segment = file
+	w.segmentNum = num
+	w.segmentSize = 0
+	return nil
+}
+
+// removeFlushedSegments deletes segments older than the oldest segment
+// holding unflushed records. Caller must hold w.mu.
+func (w *WAL) removeFlushedSegments() {
+	oldest := w.segmentNum
+	for _, p := range w.pending {
+		if p.firstSegment < oldest {
+			oldest = p.firstSegment
+		}
+	}
+
+	segments, err := w.listSegments()
+	if err != nil {
+		log.Printf("WAL: failed to list segments: %v", err)
+		return
+	}
+
+	for _, num := range segments {
+		if num >= oldest {
+			break
+		}
+		if err := os.Remove(w.segmentPath(num)); err != nil {
+			log.Printf("WAL: failed to remove segment %d: %v", num, err)
+		}
+	}
+}
+
+// readSegments decodes records from segments in order. A torn or corrupt
+// record ends the segment it is in.
+func (w *WAL) readSegments(segments []int, fn func(segment int, rec *Record) error) error {
+	for _, num := range segments {
+		file, err := os.Open(w.segmentPath(num))
+		if err != nil {
+			return err
+		}
+
+		reader := bufio.NewReader(file)
+		for {
+			rec, err := readRecord(reader)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Printf("WAL: segment %d: %v, ignoring the rest of the segment", num, err)
+				break
+			}
+			if err := fn(num, rec); err != nil {
+				file.Close()
+				return err
+			}
+		}
+		file.Close()
+	}
+	return nil
+}
+
+// readRecord reads one framed record
+func readRecord(r io.Reader) (*Record, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrCorruptRecord
+		}
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return nil, ErrCorruptRecord
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, ErrCorruptRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, ErrCorruptRecord
+	}
+
+	var rec Record
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptRecord, err)
+	}
+	return &rec, nil
+}
+
+// listSegments returns existing segment numbers in ascending order
+func (w *WAL) listSegments() ([]int, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != segmentExt {
+			continue
+		}
+		num, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, num)
+	}
+
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (w *WAL) segmentPath(num int) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%08d%s", num, segmentExt))
+}
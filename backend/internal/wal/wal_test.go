@@ -0,0 +1,117 @@
+package wal
+
+import (
+	"os"
+	"testing"
+)
+
+func openTestWAL(t *testing.T, dir string, fn func(rec *Record) error) *WAL {
+	t.Helper()
+	w, err := Open(dir, Options{Sync: SyncAlways})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if fn == nil {
+		fn = func(*Record) error { return nil }
+	}
+	if err := w.Replay(fn); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	return w
+}
+
+func TestReplay_SkipsFlushedStreams(t *testing.T) {
+	dir := t.TempDir()
+	w := openTestWAL(t, dir, nil)
+
+	labels := map[string]string{"app": "nginx"}
+	if _, err := w.Append("a", labels, []Entry{{ID: "1", Line: "one"}}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	seq, err := w.Append("b", labels, []Entry{{ID: "2", Line: "two"}})
+	if err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if _, err := w.Append("a", labels, []Entry{{ID: "3", Line: "three"}}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := w.MarkFlushed("b", seq); err != nil {
+		t.Fatalf("mark flushed failed: %v", err)
+	}
+	w.Close()
+
+	var lines []string
+	w = openTestWAL(t, dir, func(rec *Record) error {
+		if rec.Stream != "a" {
+			t.Errorf("unexpected replay of stream %s", rec.Stream)
+		}
+		for _, e := range rec.Entries {
+			lines = append(lines, e.Line)
+		}
+		return nil
+	})
+	defer w.Close()
+
+	if len(lines) != 2 || lines[0] != "one" || lines[1] != "three" {
+		t.Fatalf("expected [one three], got %v", lines)
+	}
+}
+
+func TestReplay_IgnoresTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	w := openTestWAL(t, dir, nil)
+	if _, err := w.Append("a", nil, []Entry{{ID: "1", Line: "one"}}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	w.Close()
+
+	// Simulate a crash in the middle of writing a record
+	f, err := os.OpenFile(w.segmentPath(1), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("open segment failed: %v", err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+
+	count := 0
+	w = openTestWAL(t, dir, func(rec *Record) error {
+		count++
+		return nil
+	})
+	defer w.Close()
+
+	if count != 1 {
+		t.Fatalf("expected 1 replayed record, got %d", count)
+	}
+}
+
+func TestMarkFlushed_RemovesOldSegments(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(dir, Options{Sync: SyncAlways, SegmentSize: 128})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if err := w.Replay(func(*Record) error { return nil }); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	defer w.Close()
+
+	var seq uint64
+	for i := 0; i < 5; i++ {
+		seq, err = w.Append("a", nil, []Entry{{ID: "x", Line: "a fairly long log line to fill segments"}})
+		if err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	if err := w.MarkFlushed("a", seq); err != nil {
+		t.Fatalf("mark flushed failed: %v", err)
+	}
+
+	segments, err := w.listSegments()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(segments) != 1 || segments[0] != w.segmentNum {
+		t.Fatalf("expected only the current segment to remain, got %v", segments)
+	}
+}
@@ -0,0 +1,137 @@
+package zstd
+
+import "math/bits"
+
+// backwardReader reads a bitstream that was written forward and is read
+// from its end, as Huffman and FSE streams are. The last byte holds a
+// marker bit above the final bits written.
+type backwardReader struct {
+	in  []byte
+	pos int // bits left to read; negative once reads ran past the start
+}
+
+func newBackwardReader(in []byte) (*backwardReader, error) {
+	if len(in) == 0 || in[len(in)-1] == 0 {
+		return nil, ErrCorrupt
+	}
+	last := in[len(in)-1]
+	return &backwardReader{in: in, pos: (len(in)-1)*8 + bits.Len8(last) - 1}, nil
+}
+
+// load returns the bits from bit p upwards, at least 56 of them
+func (r *backwardReader) load(p int) uint64 {
+	i := p >> 3
+	var v uint64
+	for j := min(i+8, len(r.in)) - 1; j >= i; j-- {
+		v = v<<8 | uint64(r.in[j])
+	}
+	return v >> (p & 7)
+}
+
+// peek returns the next n bits, at most 32, without consuming them. Bits
+// past the start of the stream read as zeros.
+func (r *backwardReader) peek(n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	mask := uint64(1)<<n - 1
+	if p := r.pos - n; p >= 0 {
+		return r.load(p) & mask
+	}
+	if r.pos <= 0 {
+		return 0
+	}
+	return (r.load(0) & (uint64(1)<<r.pos - 1)) << (n - r.pos)
+}
+
+func (r *backwardReader) skip(n int) {
+	r.pos -= n
+}
+
+// get consumes and returns the next n bits, at most 32
+func (r *backwardReader) get(n int) uint64 {
+	v := r.peek(n)
+	r.pos -= n
+	return v
+}
+
+// overflowed reports whether more bits were read than the stream holds
+func (r *backwardReader) overflowed() bool {
+	return r.pos < 0
+}
+
+// finished reports whether every bit was read
+func (r *backwardReader) finished() bool {
+	return r.pos == 0
+}
+
+// forwardReader reads the bits of an FSE table description from the first
+// byte on, lowest bits first
+type forwardReader struct {
+	in  []byte
+	pos int // bits read so far
+}
+
+// peek returns the next n bits, at most 32. Bits past the end read as
+// zeros, so callers check overflowed.
+func (r *forwardReader) peek(n int) uint64 {
+	var v uint64
+	i := r.pos >> 3
+	for j := min(i+8, len(r.in)) - 1; j >= i; j-- {
+		v = v<<8 | uint64(r.in[j])
+	}
+	return v >> (r.pos & 7) & (uint64(1)<<n - 1)
+}
+
+func (r *forwardReader) skip(n int) {
+	r.pos += n
+}
+
+func (r *forwardReader) overflowed() bool {
+	return r.pos > len(r.in)*8
+}
+
+// bytesRead returns the bytes read so far, counting a partial byte
+func (r *forwardReader) bytesRead() int {
+	return (r.pos + 7) / 8
+}
+
+// bitWriter writes a bitstream lowest bits first
+type bitWriter struct {
+	out   []byte
+	acc   uint64
+	nbits int
+}
+
+// add writes the low n bits of v, n at most 32
+func (w *bitWriter) add(v uint64, n int) {
+	w.acc |= (v & (uint64(1)<<n - 1)) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+// flush pads the last partial byte with zeros and returns the stream
+func (w *bitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.out
+}
+
+// close writes the marker bit a backwardReader starts from and returns the
+// stream
+func (w *bitWriter) close() []byte {
+	w.add(1, 1)
+	return w.flush()
+}
+
+// highBit returns the position of the highest set bit of v, which must
+// not be zero
+func highBit(v uint32) int {
+	return bits.Len32(v) - 1
+}
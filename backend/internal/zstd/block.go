@@ -0,0 +1,391 @@
+package zstd
+
+import "encoding/binary"
+
+// Block types
+const (
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+)
+
+// Literals section types
+const (
+	literalsRaw        = 0
+	literalsRLE        = 1
+	literalsCompressed = 2
+	literalsTreeless   = 3
+)
+
+// Sequence table modes
+const (
+	modePredefined = 0
+	modeRLE        = 1
+	modeFSE        = 2
+	modeRepeat     = 3
+)
+
+// Literal length codes 0 to 15 stand for themselves; from 16 on a code is
+// a baseline plus extra bits
+var (
+	llBaselines = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	llExtraBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+)
+
+// Match length codes 0 to 31 stand for lengths 3 to 34
+var (
+	mlBaselines = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	mlExtraBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+// Limits of the three sequence tables
+const (
+	maxLLCode = 35
+	maxMLCode = 52
+	maxOFCode = 31
+
+	maxLLTableLog = 9
+	maxMLTableLog = 9
+	maxOFTableLog = 8
+)
+
+// Default distributions of the sequence codes, used in predefined mode
+var (
+	llDefaultNorm = []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	mlDefaultNorm = []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	ofDefaultNorm = []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+)
+
+const (
+	llDefaultTableLog = 6
+	mlDefaultTableLog = 6
+	ofDefaultTableLog = 5
+)
+
+var (
+	llDefaultTable = mustDecTable(llDefaultNorm, llDefaultTableLog)
+	mlDefaultTable = mustDecTable(mlDefaultNorm, mlDefaultTableLog)
+	ofDefaultTable = mustDecTable(ofDefaultNorm, ofDefaultTableLog)
+)
+
+func mustDecTable(norm []int16, tableLog int) *fseDecTable {
+	t, err := newFSEDecTable(norm, tableLog)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// frameDecoder holds the state blocks of a frame share: the output so far,
+// repeat offsets and the tables later blocks may repeat
+type frameDecoder struct {
+	out     []byte
+	start   int // where the frame's output starts in out
+	reps    [3]int
+	huffman *huffDecTable
+	llTable *fseDecTable
+	mlTable *fseDecTable
+	ofTable *fseDecTable
+
+	literals []byte
+}
+
+// decodeCompressed decodes a compressed block and appends its content
+func (d *frameDecoder) decodeCompressed(in []byte) error {
+	literals, n, err := d.decodeLiterals(in)
+	if err != nil {
+		return err
+	}
+	return d.decodeSequences(in[n:], literals)
+}
+
+// decodeLiterals decodes the literals section at the start of in and
+// returns the literals and the size of the section
+func (d *frameDecoder) decodeLiterals(in []byte) ([]byte, int, error) {
+	if len(in) == 0 {
+		return nil, 0, ErrCorrupt
+	}
+	kind := in[0] & 3
+	sizeFormat := in[0] >> 2 & 3
+
+	if kind == literalsRaw || kind == literalsRLE {
+		var size, header int
+		switch sizeFormat {
+		case 0, 2:
+			size, header = int(in[0]>>3), 1
+		case 1:
+			if len(in) < 2 {
+				return nil, 0, ErrCorrupt
+			}
+			size, header = int(in[0]>>4)+int(in[1])<<4, 2
+		case 3:
+			if len(in) < 3 {
+				return nil, 0, ErrCorrupt
+			}
+			size, header = int(in[0]>>4)+int(in[1])<<4+int(in[2])<<12, 3
+		}
+		if size > maxBlockSize {
+			return nil, 0, ErrCorrupt
+		}
+
+		if kind == literalsRaw {
+			if len(in) < header+size {
+				return nil, 0, ErrCorrupt
+			}
+			return in[header : header+size], header + size, nil
+		}
+		if len(in) < header+1 {
+			return nil, 0, ErrCorrupt
+		}
+		literals := d.literalBuffer(size)
+		for i := range literals {
+			literals[i] = in[header]
+		}
+		return literals, header + 1, nil
+	}
+
+	var regenerated, compressed, header int
+	fourStreams := sizeFormat != 0
+	switch sizeFormat {
+	case 0, 1:
+		if len(in) < 3 {
+			return nil, 0, ErrCorrupt
+		}
+		h := uint32(in[0]) | uint32(in[1])<<8 | uint32(in[2])<<16
+		regenerated, compressed, header = int(h>>4&0x3ff), int(h>>14&0x3ff), 3
+	case 2:
+		if len(in) < 4 {
+			return nil, 0, ErrCorrupt
+		}
+		h := binary.LittleEndian.Uint32(in)
+		regenerated, compressed, header = int(h>>4&0x3fff), int(h>>18), 4
+	case 3:
+		if len(in) < 5 {
+			return nil, 0, ErrCorrupt
+		}
+		h := uint64(binary.LittleEndian.Uint32(in)) | uint64(in[4])<<32
+		regenerated, compressed, header = int(h>>4&0x3ffff), int(h>>22), 5
+	}
+	if regenerated > maxBlockSize || len(in) < header+compressed {
+		return nil, 0, ErrCorrupt
+	}
+
+	data := in[header : header+compressed]
+	if kind == literalsCompressed {
+		table, n, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		d.huffman = table
+		data = data[n:]
+	} else if d.huffman == nil {
+		return nil, 0, ErrCorrupt
+	}
+
+	literals := d.literalBuffer(regenerated)
+	if err := d.huffman.decode(data, literals, fourStreams); err != nil {
+		return nil, 0, err
+	}
+	return literals, header + compressed, nil
+}
+
+// literalBuffer returns a buffer for n decoded literals
+func (d *frameDecoder) literalBuffer(n int) []byte {
+	if cap(d.literals) < n {
+		d.literals = make([]byte, n)
+	}
+	return d.literals[:n]
+}
+
+// decodeSequences decodes the sequences section and appends the block's
+// content, built from literals and matches
+func (d *frameDecoder) decodeSequences(in, literals []byte) error {
+	if len(in) == 0 {
+		return ErrCorrupt
+	}
+	nbSeq := int(in[0])
+	switch {
+	case nbSeq < 128:
+		in = in[1:]
+	case nbSeq < 255:
+		if len(in) < 2 {
+			return ErrCorrupt
+		}
+		nbSeq = (nbSeq-128)<<8 + int(in[1])
+		in = in[2:]
+	default:
+		if len(in) < 3 {
+			return ErrCorrupt
+		}
+		nbSeq = int(binary.LittleEndian.Uint16(in[1:])) + 0x7f00
+		in = in[3:]
+	}
+	if nbSeq == 0 {
+		if len(in) != 0 {
+			return ErrCorrupt
+		}
+		d.out = append(d.out, literals...)
+		return nil
+	}
+
+	if len(in) == 0 || in[0]&3 != 0 {
+		return ErrCorrupt
+	}
+	modes := in[0]
+	in = in[1:]
+
+	var err error
+	var n int
+	if d.llTable, n, err = readSeqTable(in, modes>>6, d.llTable, llDefaultTable, maxLLCode, maxLLTableLog); err != nil {
+		return err
+	}
+	in = in[n:]
+	if d.ofTable, n, err = readSeqTable(in, modes>>4&3, d.ofTable, ofDefaultTable, maxOFCode, maxOFTableLog); err != nil {
+		return err
+	}
+	in = in[n:]
+	if d.mlTable, n, err = readSeqTable(in, modes>>2&3, d.mlTable, mlDefaultTable, maxMLCode, maxMLTableLog); err != nil {
+		return err
+	}
+	in = in[n:]
+
+	r, err := newBackwardReader(in)
+	if err != nil {
+		return err
+	}
+	llState := int(r.get(d.llTable.tableLog))
+	ofState := int(r.get(d.ofTable.tableLog))
+	mlState := int(r.get(d.mlTable.tableLog))
+
+	blockStart := len(d.out)
+	for i := 0; i < nbSeq; i++ {
+		ll := d.llTable.entries[llState]
+		ml := d.mlTable.entries[mlState]
+		of := d.ofTable.entries[ofState]
+		if ll.symbol > maxLLCode || ml.symbol > maxMLCode || of.symbol > maxOFCode {
+			return ErrCorrupt
+		}
+
+		offsetValue := 1<<of.symbol + int(r.get(int(of.symbol)))
+		matchLen := int(mlBaselines[ml.symbol]) + int(r.get(int(mlExtraBits[ml.symbol])))
+		litLen := int(llBaselines[ll.symbol]) + int(r.get(int(llExtraBits[ll.symbol])))
+
+		if i < nbSeq-1 {
+			llState = int(ll.baseline) + int(r.get(int(ll.nbBits)))
+			mlState = int(ml.baseline) + int(r.get(int(ml.nbBits)))
+			ofState = int(of.baseline) + int(r.get(int(of.nbBits)))
+		}
+		if r.overflowed() {
+			return ErrCorrupt
+		}
+
+		offset := d.resolveOffset(offsetValue, litLen)
+		if litLen > len(literals) || offset <= 0 || offset > len(d.out)-d.start+litLen ||
+			len(d.out)-blockStart+litLen+matchLen > maxBlockSize {
+			return ErrCorrupt
+		}
+		d.out = append(d.out, literals[:litLen]...)
+		literals = literals[litLen:]
+
+		// Matches may overlap their own output, so go byte by byte
+		for from := len(d.out) - offset; matchLen > 0; matchLen-- {
+			d.out = append(d.out, d.out[from])
+			from++
+		}
+	}
+	if !r.finished() || len(d.out)-blockStart+len(literals) > maxBlockSize {
+		return ErrCorrupt
+	}
+	d.out = append(d.out, literals...)
+	return nil
+}
+
+// resolveOffset turns an offset value into a match offset, updating the
+// repeat offsets. Values 1 to 3 repeat a recent offset, shifted by one
+// when the sequence has no literals.
+func (d *frameDecoder) resolveOffset(offsetValue, litLen int) int {
+	if offsetValue > 3 {
+		offset := offsetValue - 3
+		d.reps = [3]int{offset, d.reps[0], d.reps[1]}
+		return offset
+	}
+
+	idx := offsetValue - 1
+	if litLen == 0 {
+		idx++
+	}
+	var offset int
+	switch idx {
+	case 0:
+		return d.reps[0]
+	case 1:
+		offset = d.reps[1]
+		d.reps[1] = d.reps[0]
+	case 2:
+		offset = d.reps[2]
+		d.reps[2], d.reps[1] = d.reps[1], d.reps[0]
+	default:
+		offset = d.reps[0] - 1
+		d.reps[2], d.reps[1] = d.reps[1], d.reps[0]
+	}
+	d.reps[0] = offset
+	return offset
+}
+
+// readSeqTable reads the table of one sequence code in the given mode from
+// the start of in, and returns it with the bytes read
+func readSeqTable(in []byte, mode byte, previous, predefined *fseDecTable, maxSymbol, maxTableLog int) (*fseDecTable, int, error) {
+	switch mode {
+	case modePredefined:
+		return predefined, 0, nil
+	case modeRLE:
+		if len(in) == 0 || int(in[0]) > maxSymbol {
+			return nil, 0, ErrCorrupt
+		}
+		return rleDecTable(in[0]), 1, nil
+	case modeFSE:
+		norm, tableLog, n, err := readNCount(in, maxSymbol, maxTableLog)
+		if err != nil {
+			return nil, 0, err
+		}
+		table, err := newFSEDecTable(norm, tableLog)
+		if err != nil {
+			return nil, 0, err
+		}
+		return table, n, nil
+	}
+	if previous == nil {
+		return nil, 0, ErrCorrupt
+	}
+	return previous, 0, nil
+}
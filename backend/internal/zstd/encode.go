@@ -0,0 +1,268 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+const (
+	// minMatch is the shortest match the encoder looks for
+	minMatch = 4
+
+	hashLog = 15
+
+	// minHuffmanLiterals is the fewest literals worth a Huffman table
+	minHuffmanLiterals = 64
+)
+
+var (
+	llEncTable = mustEncTable(llDefaultNorm, llDefaultTableLog)
+	mlEncTable = mustEncTable(mlDefaultNorm, mlDefaultTableLog)
+	ofEncTable = mustEncTable(ofDefaultNorm, ofDefaultTableLog)
+)
+
+func mustEncTable(norm []int16, tableLog int) *fseEncTable {
+	t, err := newFSEEncTable(norm, tableLog)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// sequence copies litLen literals, then matchLen bytes from offset back
+type sequence struct {
+	litLen   int
+	matchLen int
+	offset   int
+}
+
+// encoder keeps the buffers reused across the blocks of a frame
+type encoder struct {
+	table    []int32
+	seqs     []sequence
+	literals []byte
+}
+
+// appendBlock appends src, at most maxBlockSize bytes, as the smallest of
+// an RLE, compressed or raw block
+func (e *encoder) appendBlock(dst, src []byte, last bool) []byte {
+	if isRun(src) {
+		dst = appendBlockHeader(dst, blockRLE, len(src), last)
+		return append(dst, src[0])
+	}
+
+	start := len(dst)
+	dst = appendBlockHeader(dst, blockCompressed, 0, last)
+	dst = e.compressBlock(dst, src)
+	if size := len(dst) - start - 3; size < len(src) {
+		appendBlockHeader(dst[:start], blockCompressed, size, last)
+		return dst
+	}
+
+	dst = appendBlockHeader(dst[:start], blockRaw, len(src), last)
+	return append(dst, src...)
+}
+
+// compressBlock appends the literals and sequences sections of src
+func (e *encoder) compressBlock(dst, src []byte) []byte {
+	e.findSequences(src)
+	dst = appendLiterals(dst, e.literals)
+	return appendSequences(dst, e.seqs)
+}
+
+// findSequences greedily replaces repeated bytes of src with matches,
+// collecting the sequences and the literals between them
+func (e *encoder) findSequences(src []byte) {
+	e.seqs = e.seqs[:0]
+	e.literals = e.literals[:0]
+	if e.table == nil {
+		e.table = make([]int32, 1<<hashLog)
+	} else {
+		clear(e.table)
+	}
+
+	anchor := 0
+	misses := 0
+	for s := 0; s+minMatch <= len(src); {
+		cur := binary.LittleEndian.Uint32(src[s:])
+		h := hash4(cur)
+		// Positions are stored plus one so the zero value means empty
+		candidate := int(e.table[h]) - 1
+		e.table[h] = int32(s + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != cur {
+			// Skip ahead faster the longer no match has been found
+			misses++
+			s += 1 + misses>>6
+			continue
+		}
+		misses = 0
+
+		for s > anchor && candidate > 0 && src[s-1] == src[candidate-1] {
+			s--
+			candidate--
+		}
+		end := s + minMatch
+		for end < len(src) && src[end] == src[end-(s-candidate)] {
+			end++
+		}
+
+		e.seqs = append(e.seqs, sequence{litLen: s - anchor, matchLen: end - s, offset: s - candidate})
+		e.literals = append(e.literals, src[anchor:s]...)
+		if p := end - 2; p+4 <= len(src) {
+			e.table[hash4(binary.LittleEndian.Uint32(src[p:]))] = int32(p + 1)
+		}
+		s, anchor = end, end
+	}
+	e.literals = append(e.literals, src[anchor:]...)
+}
+
+func hash4(u uint32) uint32 {
+	return (u * 2654435761) >> (32 - hashLog)
+}
+
+// isRun reports whether src repeats a single byte
+func isRun(src []byte) bool {
+	for _, b := range src[1:] {
+		if b != src[0] {
+			return false
+		}
+	}
+	return len(src) > 1
+}
+
+// appendLiterals appends the literals section, Huffman coded when that is
+// smaller than storing the literals as they are
+func appendLiterals(dst, literals []byte) []byte {
+	n := len(literals)
+	if isRun(literals) {
+		return append(appendRawLiteralsHeader(dst, literalsRLE, n), literals[0])
+	}
+	if n < minHuffmanLiterals {
+		return append(appendRawLiteralsHeader(dst, literalsRaw, n), literals...)
+	}
+
+	var counts [256]int
+	for _, b := range literals {
+		counts[b]++
+	}
+	table := newHuffEncTable(&counts)
+	body, ok := table.appendDescription(nil)
+	if !ok || len(body)+table.estimateSize(&counts) >= n {
+		return append(appendRawLiteralsHeader(dst, literalsRaw, n), literals...)
+	}
+
+	fourStreams := n > 1023
+	if !fourStreams {
+		single := table.appendStream(body, literals)
+		if len(single) <= 1023 {
+			return append(appendCompressedLiteralsHeader(dst, n, len(single), false), single...)
+		}
+		fourStreams = true
+	}
+	body = table.appendStreams(body, literals)
+	if len(body) >= n {
+		return append(appendRawLiteralsHeader(dst, literalsRaw, n), literals...)
+	}
+	return append(appendCompressedLiteralsHeader(dst, n, len(body), true), body...)
+}
+
+// appendRawLiteralsHeader appends the header of raw or RLE literals
+func appendRawLiteralsHeader(dst []byte, kind, n int) []byte {
+	switch {
+	case n < 32:
+		return append(dst, byte(kind|n<<3))
+	case n < 4096:
+		h := kind | 1<<2 | n<<4
+		return append(dst, byte(h), byte(h>>8))
+	}
+	h := kind | 3<<2 | n<<4
+	return append(dst, byte(h), byte(h>>8), byte(h>>16))
+}
+
+// appendCompressedLiteralsHeader appends the header of Huffman coded
+// literals, with the smallest size fields that hold both sizes
+func appendCompressedLiteralsHeader(dst []byte, regenerated, compressed int, fourStreams bool) []byte {
+	size := max(regenerated, compressed)
+	switch {
+	case !fourStreams:
+		h := literalsCompressed | regenerated<<4 | compressed<<14
+		return append(dst, byte(h), byte(h>>8), byte(h>>16))
+	case size < 1024:
+		h := literalsCompressed | 1<<2 | regenerated<<4 | compressed<<14
+		return append(dst, byte(h), byte(h>>8), byte(h>>16))
+	case size < 16384:
+		h := uint32(literalsCompressed | 2<<2 | regenerated<<4 | compressed<<18)
+		return binary.LittleEndian.AppendUint32(dst, h)
+	}
+	h := uint64(literalsCompressed | 3<<2 | regenerated<<4 | compressed<<22)
+	return append(binary.LittleEndian.AppendUint32(dst, uint32(h)), byte(h>>32))
+}
+
+// appendSequences appends the sequences section, coded with the predefined
+// tables. Offsets are never coded as repeats.
+func appendSequences(dst []byte, seqs []sequence) []byte {
+	n := len(seqs)
+	switch {
+	case n < 128:
+		dst = append(dst, byte(n))
+	case n < 0x7f00:
+		dst = append(dst, byte(n>>8+128), byte(n))
+	default:
+		dst = binary.LittleEndian.AppendUint16(append(dst, 255), uint16(n-0x7f00))
+	}
+	if n == 0 {
+		return dst
+	}
+	dst = append(dst, modePredefined<<6|modePredefined<<4|modePredefined<<2)
+
+	// Sequences are written last first, so the decoder reads them in order
+	w := &bitWriter{out: dst}
+	var ll, ml, of fseEncoder
+	last := codesOf(seqs[n-1])
+	ml.init(mlEncTable, last.mlCode)
+	of.init(ofEncTable, last.ofCode)
+	ll.init(llEncTable, last.llCode)
+	last.addExtraBits(w)
+	for i := n - 2; i >= 0; i-- {
+		c := codesOf(seqs[i])
+		of.encode(w, c.ofCode)
+		ml.encode(w, c.mlCode)
+		ll.encode(w, c.llCode)
+		c.addExtraBits(w)
+	}
+	ml.flush(w)
+	of.flush(w)
+	ll.flush(w)
+	return w.close()
+}
+
+// sequenceCodes is a sequence as codes and the extra bits that follow them
+type sequenceCodes struct {
+	llCode, mlCode, ofCode    uint8
+	llExtra, mlExtra, ofExtra uint32
+}
+
+func codesOf(seq sequence) sequenceCodes {
+	var c sequenceCodes
+	c.llCode = uint8(codeFor(llBaselines[:], seq.litLen))
+	c.llExtra = uint32(seq.litLen) - llBaselines[c.llCode]
+	c.mlCode = uint8(codeFor(mlBaselines[:], seq.matchLen))
+	c.mlExtra = uint32(seq.matchLen) - mlBaselines[c.mlCode]
+
+	// Offset values 1 to 3 stand for repeat offsets
+	offsetValue := uint32(seq.offset + 3)
+	c.ofCode = uint8(highBit(offsetValue))
+	c.ofExtra = offsetValue - 1<<c.ofCode
+	return c
+}
+
+// codeFor returns the code with the largest baseline not above v
+func codeFor(baselines []uint32, v int) int {
+	return sort.Search(len(baselines), func(i int) bool { return int(baselines[i]) > v }) - 1
+}
+
+func (c sequenceCodes) addExtraBits(w *bitWriter) {
+	w.add(uint64(c.llExtra), int(llExtraBits[c.llCode]))
+	w.add(uint64(c.mlExtra), int(mlExtraBits[c.mlCode]))
+	w.add(uint64(c.ofExtra), int(c.ofCode))
+}
@@ -0,0 +1,318 @@
+package zstd
+
+// Finite State Entropy (tANS) coding, used for sequence codes and Huffman
+// weights. A table is described by the normalized count of every symbol,
+// which sum to 1<<tableLog; a count of -1 stands for a probability below
+// 1/tableSize that still takes one state.
+
+// minTableLog is the smallest accuracy an FSE table description can have
+const minTableLog = 5
+
+// fseDecEntry is one state of a decoding table
+type fseDecEntry struct {
+	symbol   uint8
+	nbBits   uint8
+	baseline uint16
+}
+
+// fseDecTable decodes symbols; a state indexes its entries
+type fseDecTable struct {
+	tableLog int
+	entries  []fseDecEntry
+}
+
+// readNCount reads an FSE table description from the start of in and
+// returns the normalized counts, the accuracy log and the bytes read
+func readNCount(in []byte, maxSymbol, maxTableLog int) ([]int16, int, int, error) {
+	if len(in) == 0 {
+		return nil, 0, 0, ErrCorrupt
+	}
+	r := &forwardReader{in: in}
+	tableLog := int(r.peek(4)) + minTableLog
+	r.skip(4)
+	if tableLog > maxTableLog {
+		return nil, 0, 0, ErrCorrupt
+	}
+
+	norm := make([]int16, 0, maxSymbol+1)
+	remaining := 1<<tableLog + 1
+	threshold := 1 << tableLog
+	nbBits := tableLog + 1
+	previous0 := false
+	for remaining > 1 && len(norm) <= maxSymbol {
+		if previous0 {
+			// Runs of zero counts follow a zero count as 2 bit repeats
+			for repeat := 3; repeat == 3; {
+				repeat = int(r.peek(2))
+				r.skip(2)
+				for i := 0; i < repeat; i++ {
+					norm = append(norm, 0)
+				}
+				if r.overflowed() || len(norm) > maxSymbol {
+					return nil, 0, 0, ErrCorrupt
+				}
+			}
+		}
+		lowCount := 2*threshold - 1 - remaining
+		var count int
+		if v := int(r.peek(nbBits)); v&(threshold-1) < lowCount {
+			count = v & (threshold - 1)
+			r.skip(nbBits - 1)
+		} else {
+			count = v & (2*threshold - 1)
+			if count >= threshold {
+				count -= lowCount
+			}
+			r.skip(nbBits)
+		}
+		count--
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		norm = append(norm, int16(count))
+		previous0 = count == 0
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+		if r.overflowed() {
+			return nil, 0, 0, ErrCorrupt
+		}
+	}
+	if remaining != 1 || len(norm) > maxSymbol+1 {
+		return nil, 0, 0, ErrCorrupt
+	}
+	return norm, tableLog, r.bytesRead(), nil
+}
+
+// spreadSymbols lays out the symbols of a distribution over the states of
+// a table, with low probability symbols at the top
+func spreadSymbols(norm []int16, tableLog int) ([]uint8, error) {
+	size := 1 << tableLog
+	symbols := make([]uint8, size)
+	high := size - 1
+	for s, n := range norm {
+		if n == -1 {
+			symbols[high] = uint8(s)
+			high--
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			symbols[pos] = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, ErrCorrupt
+	}
+	return symbols, nil
+}
+
+// newFSEDecTable builds the decoding table of a distribution
+func newFSEDecTable(norm []int16, tableLog int) (*fseDecTable, error) {
+	symbols, err := spreadSymbols(norm, tableLog)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 1 << tableLog
+	next := make([]int, len(norm))
+	for s, n := range norm {
+		if n == -1 {
+			next[s] = 1
+		} else {
+			next[s] = int(n)
+		}
+	}
+
+	t := &fseDecTable{tableLog: tableLog, entries: make([]fseDecEntry, size)}
+	for state, s := range symbols {
+		n := next[s]
+		next[s]++
+		nbBits := tableLog - highBit(uint32(n))
+		t.entries[state] = fseDecEntry{
+			symbol:   s,
+			nbBits:   uint8(nbBits),
+			baseline: uint16(n<<nbBits - size),
+		}
+	}
+	return t, nil
+}
+
+// rleDecTable returns a table that always decodes symbol
+func rleDecTable(symbol uint8) *fseDecTable {
+	return &fseDecTable{entries: []fseDecEntry{{symbol: symbol}}}
+}
+
+// fseEncSymbol holds the state transform of one symbol
+type fseEncSymbol struct {
+	deltaNbBits    int32
+	deltaFindState int32
+}
+
+// fseEncTable encodes symbols with the distribution of an fseDecTable
+type fseEncTable struct {
+	tableLog   int
+	stateTable []uint16
+	symbols    []fseEncSymbol
+}
+
+// newFSEEncTable builds the encoding table of a distribution
+func newFSEEncTable(norm []int16, tableLog int) (*fseEncTable, error) {
+	symbols, err := spreadSymbols(norm, tableLog)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 1 << tableLog
+	cumul := make([]int, len(norm)+1)
+	for s, n := range norm {
+		if n == -1 {
+			n = 1
+		}
+		cumul[s+1] = cumul[s] + int(n)
+	}
+
+	t := &fseEncTable{
+		tableLog:   tableLog,
+		stateTable: make([]uint16, size),
+		symbols:    make([]fseEncSymbol, len(norm)),
+	}
+	for u, s := range symbols {
+		t.stateTable[cumul[s]] = uint16(size + u)
+		cumul[s]++
+	}
+
+	total := int32(0)
+	for s, n := range norm {
+		switch n {
+		case 0:
+			t.symbols[s].deltaNbBits = int32((tableLog+1)<<16 - size)
+		case -1, 1:
+			t.symbols[s] = fseEncSymbol{
+				deltaNbBits:    int32(tableLog<<16 - size),
+				deltaFindState: total - 1,
+			}
+			total++
+		default:
+			maxBitsOut := tableLog - highBit(uint32(n-1))
+			minStatePlus := int(n) << maxBitsOut
+			t.symbols[s] = fseEncSymbol{
+				deltaNbBits:    int32(maxBitsOut<<16 - minStatePlus),
+				deltaFindState: total - int32(n),
+			}
+			total += int32(n)
+		}
+	}
+	return t, nil
+}
+
+// fseEncoder is the state of one FSE stream being written
+type fseEncoder struct {
+	table *fseEncTable
+	state int32
+}
+
+// init starts the stream with the last symbol it encodes, choosing the
+// smallest state so the symbol costs no bits of its own
+func (e *fseEncoder) init(table *fseEncTable, symbol uint8) {
+	e.table = table
+	tt := table.symbols[symbol]
+	nbBitsOut := (tt.deltaNbBits + 1<<15) >> 16
+	value := nbBitsOut<<16 - tt.deltaNbBits
+	e.state = int32(table.stateTable[value>>nbBitsOut+tt.deltaFindState])
+}
+
+// encode writes the bits that lead the decoder from symbol's state back to
+// the current one
+func (e *fseEncoder) encode(w *bitWriter, symbol uint8) {
+	tt := e.table.symbols[symbol]
+	nbBitsOut := (e.state + tt.deltaNbBits) >> 16
+	w.add(uint64(e.state), int(nbBitsOut))
+	e.state = int32(e.table.stateTable[e.state>>nbBitsOut+tt.deltaFindState])
+}
+
+// flush writes the final state, which the decoder starts from
+func (e *fseEncoder) flush(w *bitWriter) {
+	w.add(uint64(e.state), e.table.tableLog)
+}
+
+// normalizeCounts scales symbol counts to sum to 1<<tableLog, giving every
+// present symbol at least one state
+func normalizeCounts(counts []int, total, tableLog int) []int16 {
+	size := 1 << tableLog
+	norm := make([]int16, len(counts))
+	sum, largest := 0, 0
+	for s, c := range counts {
+		if c == 0 {
+			continue
+		}
+		n := max(1, (c*size+total/2)/total)
+		norm[s] = int16(n)
+		sum += n
+		if c > counts[largest] {
+			largest = s
+		}
+	}
+	// Rounding errors go to the most frequent symbol, which can afford them
+	norm[largest] += int16(size - sum)
+	return norm
+}
+
+// writeNCount appends the FSE table description of a distribution
+func writeNCount(dst []byte, norm []int16, tableLog int) []byte {
+	w := &bitWriter{out: dst}
+	w.add(uint64(tableLog-minTableLog), 4)
+
+	remaining := 1<<tableLog + 1
+	threshold := 1 << tableLog
+	nbBits := tableLog + 1
+	previous0 := false
+	for s := 0; s < len(norm) && remaining > 1; {
+		if previous0 {
+			start := s
+			for s < len(norm) && norm[s] == 0 {
+				s++
+			}
+			for s >= start+3 {
+				start += 3
+				w.add(3, 2)
+			}
+			w.add(uint64(s-start), 2)
+		}
+
+		count := int(norm[s])
+		s++
+		lowCount := 2*threshold - 1 - remaining
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		count++
+		if count >= threshold {
+			count += lowCount
+		}
+		if count < lowCount {
+			w.add(uint64(count), nbBits-1)
+		} else {
+			w.add(uint64(count), nbBits)
+		}
+		previous0 = count == 1
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	return w.flush()
+}
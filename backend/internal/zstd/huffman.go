@@ -0,0 +1,469 @@
+package zstd
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"sort"
+)
+
+const (
+	// maxHuffmanBits is the longest Huffman code
+	maxHuffmanBits = 11
+
+	// maxWeightTableLog is the largest accuracy of the FSE table that
+	// compresses Huffman weights
+	maxWeightTableLog = 6
+)
+
+// huffDecEntry is one slot of a decoding table, indexed by the next
+// maxBits bits of a stream
+type huffDecEntry struct {
+	symbol uint8
+	nbBits uint8
+}
+
+type huffDecTable struct {
+	maxBits int
+	entries []huffDecEntry
+}
+
+// readHuffmanTable reads a Huffman tree description from the start of in
+// and returns its decoding table and the bytes read
+func readHuffmanTable(in []byte) (*huffDecTable, int, error) {
+	if len(in) == 0 {
+		return nil, 0, ErrCorrupt
+	}
+	header := int(in[0])
+
+	var weights []uint8
+	var size int
+	if header >= 128 {
+		// Weights are stored directly, two per byte
+		n := header - 127
+		size = 1 + (n+1)/2
+		if len(in) < size {
+			return nil, 0, ErrCorrupt
+		}
+		weights = make([]uint8, n)
+		for i := range weights {
+			b := in[1+i/2]
+			if i%2 == 0 {
+				weights[i] = b >> 4
+			} else {
+				weights[i] = b & 0x0f
+			}
+		}
+	} else {
+		size = 1 + header
+		if len(in) < size {
+			return nil, 0, ErrCorrupt
+		}
+		var err error
+		if weights, err = decodeWeights(in[1:size]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	table, err := newHuffDecTable(weights)
+	if err != nil {
+		return nil, 0, err
+	}
+	return table, size, nil
+}
+
+// decodeWeights decodes FSE compressed Huffman weights, which two states
+// take turns to encode
+func decodeWeights(in []byte) ([]uint8, error) {
+	norm, tableLog, n, err := readNCount(in, maxHuffmanBits+1, maxWeightTableLog)
+	if err != nil {
+		return nil, err
+	}
+	table, err := newFSEDecTable(norm, tableLog)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newBackwardReader(in[n:])
+	if err != nil {
+		return nil, err
+	}
+
+	states := [2]int{int(r.get(tableLog)), int(r.get(tableLog))}
+	var weights []uint8
+	for i := 0; ; i = 1 - i {
+		if len(weights) >= 255 {
+			return nil, ErrCorrupt
+		}
+		e := table.entries[states[i]]
+		weights = append(weights, e.symbol)
+		states[i] = int(e.baseline) + int(r.get(int(e.nbBits)))
+		if r.overflowed() {
+			// The other state holds the last weight
+			weights = append(weights, table.entries[states[1-i]].symbol)
+			return weights, nil
+		}
+	}
+}
+
+// newHuffDecTable builds a decoding table from the weights of all symbols
+// but the last, whose weight completes the code
+func newHuffDecTable(weights []uint8) (*huffDecTable, error) {
+	total := 0
+	for _, w := range weights {
+		if w > maxHuffmanBits {
+			return nil, ErrCorrupt
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, ErrCorrupt
+	}
+	maxBits := highBit(uint32(total)) + 1
+	left := 1<<maxBits - total
+	if maxBits > maxHuffmanBits || left&(left-1) != 0 {
+		return nil, ErrCorrupt
+	}
+	weights = append(weights, uint8(highBit(uint32(left))+1))
+
+	// Symbols fill the table by increasing weight, each taking a slot per
+	// code that starts with its own
+	var rankStart [maxHuffmanBits + 2]int
+	for _, w := range weights {
+		if w > 0 {
+			rankStart[w+1] += 1 << (w - 1)
+		}
+	}
+	for w := 2; w < len(rankStart); w++ {
+		rankStart[w] += rankStart[w-1]
+	}
+
+	t := &huffDecTable{maxBits: maxBits, entries: make([]huffDecEntry, 1<<maxBits)}
+	for s, w := range weights {
+		if w == 0 {
+			continue
+		}
+		entry := huffDecEntry{symbol: uint8(s), nbBits: uint8(maxBits + 1 - int(w))}
+		start := rankStart[w]
+		for i := start; i < start+1<<(w-1); i++ {
+			t.entries[i] = entry
+		}
+		rankStart[w] += 1 << (w - 1)
+	}
+	return t, nil
+}
+
+// decodeStream fills out with the symbols of one Huffman stream
+func (t *huffDecTable) decodeStream(in, out []byte) error {
+	r, err := newBackwardReader(in)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		e := t.entries[r.peek(t.maxBits)]
+		out[i] = e.symbol
+		r.skip(int(e.nbBits))
+	}
+	if !r.finished() {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// decode fills out from one stream or from four, which split out into
+// equal parts after a jump table of their sizes
+func (t *huffDecTable) decode(in, out []byte, fourStreams bool) error {
+	if !fourStreams {
+		return t.decodeStream(in, out)
+	}
+	if len(in) < 6 {
+		return ErrCorrupt
+	}
+	var sizes [4]int
+	sizes[3] = len(in) - 6
+	for i := 0; i < 3; i++ {
+		sizes[i] = int(binary.LittleEndian.Uint16(in[2*i:]))
+		sizes[3] -= sizes[i]
+	}
+	if sizes[3] < 0 {
+		return ErrCorrupt
+	}
+
+	segment := (len(out) + 3) / 4
+	in = in[6:]
+	for i, size := range sizes {
+		part := out[min(i*segment, len(out)):min((i+1)*segment, len(out))]
+		if err := t.decodeStream(in[:size], part); err != nil {
+			return err
+		}
+		in = in[size:]
+	}
+	return nil
+}
+
+// huffEncTable holds the code of every symbol
+type huffEncTable struct {
+	codes  [256]uint16
+	nbBits [256]uint8
+	// maxSymbol is the highest symbol with a code
+	maxSymbol int
+	maxBits   int
+}
+
+// newHuffEncTable builds a Huffman code for the given byte counts, of which
+// at least two must be non-zero
+func newHuffEncTable(counts *[256]int) *huffEncTable {
+	lengths := huffmanLengths(counts, maxHuffmanBits)
+
+	t := &huffEncTable{}
+	for s, n := range lengths {
+		if n > 0 {
+			t.maxSymbol = s
+			t.maxBits = max(t.maxBits, int(n))
+		}
+	}
+
+	// Assign codes the way newHuffDecTable lays out the table: by weight,
+	// then by symbol
+	var rankStart [maxHuffmanBits + 2]int
+	for _, n := range lengths {
+		if n > 0 {
+			w := t.maxBits + 1 - int(n)
+			rankStart[w+1] += 1 << (w - 1)
+		}
+	}
+	for w := 2; w < len(rankStart); w++ {
+		rankStart[w] += rankStart[w-1]
+	}
+	for s, n := range lengths {
+		if n == 0 {
+			continue
+		}
+		w := t.maxBits + 1 - int(n)
+		t.codes[s] = uint16(rankStart[w] >> (w - 1))
+		t.nbBits[s] = n
+		rankStart[w] += 1 << (w - 1)
+	}
+	return t
+}
+
+// weights returns the weight of every symbol below maxSymbol
+func (t *huffEncTable) weights() []uint8 {
+	weights := make([]uint8, t.maxSymbol)
+	for s := range weights {
+		if t.nbBits[s] > 0 {
+			weights[s] = uint8(t.maxBits + 1 - int(t.nbBits[s]))
+		}
+	}
+	return weights
+}
+
+// appendDescription appends the tree description of the code, with the
+// weights stored directly where they fit and FSE compressed otherwise. It
+// reports false if the weights cannot be described.
+func (t *huffEncTable) appendDescription(dst []byte) ([]byte, bool) {
+	weights := t.weights()
+	if len(weights) <= 128 {
+		dst = append(dst, byte(127+len(weights)))
+		for i := 0; i < len(weights); i += 2 {
+			b := weights[i] << 4
+			if i+1 < len(weights) {
+				b |= weights[i+1]
+			}
+			dst = append(dst, b)
+		}
+		return dst, true
+	}
+
+	compressed, ok := encodeWeights(weights)
+	if !ok || len(compressed) >= 128 {
+		return dst, false
+	}
+	dst = append(dst, byte(len(compressed)))
+	return append(dst, compressed...), true
+}
+
+// encodeWeights FSE compresses Huffman weights with two interleaved
+// states, the inverse of decodeWeights
+func encodeWeights(weights []uint8) ([]byte, bool) {
+	counts := make([]int, maxHuffmanBits+1)
+	distinct := 0
+	for _, w := range weights {
+		if counts[w] == 0 {
+			distinct++
+		}
+		counts[w]++
+	}
+	if distinct < 2 {
+		return nil, false
+	}
+	for len(counts) > 0 && counts[len(counts)-1] == 0 {
+		counts = counts[:len(counts)-1]
+	}
+
+	norm := normalizeCounts(counts, len(weights), maxWeightTableLog)
+	table, err := newFSEEncTable(norm, maxWeightTableLog)
+	if err != nil {
+		return nil, false
+	}
+	out := writeNCount(nil, norm, maxWeightTableLog)
+
+	// The first state takes the even weights and the second the odd ones.
+	// Encoding runs backwards, starting each state with its last weight.
+	w := &bitWriter{}
+	var states [2]fseEncoder
+	i := len(weights) - 1
+	states[i%2].init(table, weights[i])
+	states[(i-1)%2].init(table, weights[i-1])
+	for i -= 2; i >= 0; i-- {
+		states[i%2].encode(w, weights[i])
+	}
+	states[1].flush(w)
+	states[0].flush(w)
+	return append(out, w.close()...), true
+}
+
+// appendStream appends the Huffman stream of src, written backwards so the
+// decoder reads the first symbol first
+func (t *huffEncTable) appendStream(dst, src []byte) []byte {
+	w := &bitWriter{out: dst}
+	for i := len(src) - 1; i >= 0; i-- {
+		s := src[i]
+		w.add(uint64(t.codes[s]), int(t.nbBits[s]))
+	}
+	return w.close()
+}
+
+// appendStreams appends src as four streams after their jump table
+func (t *huffEncTable) appendStreams(dst, src []byte) []byte {
+	segment := (len(src) + 3) / 4
+	jump := len(dst)
+	dst = append(dst, make([]byte, 6)...)
+	for i := 0; i < 4; i++ {
+		start := len(dst)
+		dst = t.appendStream(dst, src[min(i*segment, len(src)):min((i+1)*segment, len(src))])
+		if i < 3 {
+			binary.LittleEndian.PutUint16(dst[jump+2*i:], uint16(len(dst)-start))
+		}
+	}
+	return dst
+}
+
+// estimateSize returns the bytes the streams of counts take with the code
+func (t *huffEncTable) estimateSize(counts *[256]int) int {
+	n := 0
+	for s, c := range counts {
+		n += c * int(t.nbBits[s])
+	}
+	return (n + 7) / 8
+}
+
+// huffNode is a symbol or subtree while building a Huffman code
+type huffNode struct {
+	count       int
+	symbol      int // -1 for subtrees
+	left, right *huffNode
+}
+
+type huffHeap []*huffNode
+
+func (h huffHeap) Len() int { return len(h) }
+func (h huffHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].symbol < h[j].symbol
+}
+func (h huffHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffHeap) Push(x any)   { *h = append(*h, x.(*huffNode)) }
+func (h *huffHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffmanLengths returns Huffman code lengths for counts, none longer than
+// maxLen. The lengths form a complete code.
+func huffmanLengths(counts *[256]int, maxLen int) [256]uint8 {
+	var lengths [256]uint8
+	h := &huffHeap{}
+	for s, c := range counts {
+		if c > 0 {
+			*h = append(*h, &huffNode{count: c, symbol: s})
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 1 {
+		a := heap.Pop(h).(*huffNode)
+		b := heap.Pop(h).(*huffNode)
+		heap.Push(h, &huffNode{count: a.count + b.count, symbol: -1, left: a, right: b})
+	}
+	var walk func(n *huffNode, depth int)
+	walk = func(n *huffNode, depth int) {
+		if n.symbol >= 0 {
+			lengths[n.symbol] = uint8(max(depth, 1))
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk((*h)[0], 0)
+
+	limitLengths(&lengths, counts, maxLen)
+	return lengths
+}
+
+// limitLengths caps code lengths at maxLen, lengthening the codes of rare
+// symbols until the code fits and shortening frequent ones while it is
+// incomplete
+func limitLengths(lengths *[256]uint8, counts *[256]int, maxLen int) {
+	// Kraft sum in units of 2^-maxLen
+	full := 1 << maxLen
+	sum := 0
+	var symbols []int
+	for s, n := range lengths {
+		if n == 0 {
+			continue
+		}
+		if int(n) > maxLen {
+			lengths[s] = uint8(maxLen)
+		}
+		sum += 1 << (maxLen - int(lengths[s]))
+		symbols = append(symbols, s)
+	}
+	if sum == full {
+		return
+	}
+
+	// Rarest symbols first
+	sort.Slice(symbols, func(i, j int) bool {
+		if counts[symbols[i]] != counts[symbols[j]] {
+			return counts[symbols[i]] < counts[symbols[j]]
+		}
+		return symbols[i] < symbols[j]
+	})
+	for sum > full {
+		// Lengthen the rarest code that is still short of the limit, the
+		// longest first as that costs the least
+		best := -1
+		for _, s := range symbols {
+			if int(lengths[s]) < maxLen && (best < 0 || lengths[s] > lengths[best]) {
+				best = s
+			}
+		}
+		sum -= 1 << (maxLen - int(lengths[best]) - 1)
+		lengths[best]++
+	}
+	// Some code is always short enough to fill what is left, as the gap is
+	// a multiple of the smallest share
+	for sum < full {
+		for i := len(symbols) - 1; i >= 0; i-- {
+			s := symbols[i]
+			for lengths[s] > 1 && sum+1<<(maxLen-int(lengths[s])) <= full {
+				sum += 1 << (maxLen - int(lengths[s]))
+				lengths[s]--
+			}
+		}
+	}
+}
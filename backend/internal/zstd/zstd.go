@@ -0,0 +1,209 @@
+// Package zstd implements the Zstandard frame format used for chunk
+// compression. Decode reads any frame without a dictionary; Encode writes
+// single segment frames whose blocks use Huffman coded literals and the
+// predefined sequence tables.
+// See https://www.rfc-editor.org/rfc/rfc8878
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	ErrCorrupt    = errors.New("zstd: corrupt input")
+	ErrDictionary = errors.New("zstd: dictionaries are not supported")
+)
+
+const (
+	frameMagic     = 0xfd2fb528
+	skippableMagic = 0x184d2a50 // low four bits vary
+
+	// maxBlockSize is the largest content of a block
+	maxBlockSize = 128 << 10
+)
+
+// Decode returns the content of the frames in src, appending to dst[:0].
+// Empty input holds no frames and decodes to nothing.
+func Decode(dst, src []byte) ([]byte, error) {
+	out := dst[:0]
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return nil, ErrCorrupt
+		}
+		magic := binary.LittleEndian.Uint32(src)
+		if magic&^0xf == skippableMagic {
+			if len(src) < 8 {
+				return nil, ErrCorrupt
+			}
+			size := binary.LittleEndian.Uint32(src[4:])
+			if uint64(len(src)-8) < uint64(size) {
+				return nil, ErrCorrupt
+			}
+			src = src[8+int(size):]
+			continue
+		}
+		if magic != frameMagic {
+			return nil, ErrCorrupt
+		}
+
+		var err error
+		if out, src, err = decodeFrame(out, src[4:]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// decodeFrame appends the content of the frame at the start of in, which
+// follows the magic number, and returns the input after it
+func decodeFrame(out, in []byte) ([]byte, []byte, error) {
+	if len(in) == 0 {
+		return nil, nil, ErrCorrupt
+	}
+	descriptor := in[0]
+	in = in[1:]
+	if descriptor&0x08 != 0 {
+		return nil, nil, ErrCorrupt
+	}
+	singleSegment := descriptor&0x20 != 0
+	hasChecksum := descriptor&0x04 != 0
+
+	// The window size only bounds memory, as the whole output is kept
+	if !singleSegment {
+		if len(in) == 0 {
+			return nil, nil, ErrCorrupt
+		}
+		in = in[1:]
+	}
+
+	dictSize := [4]int{0, 1, 2, 4}[descriptor&3]
+	if len(in) < dictSize {
+		return nil, nil, ErrCorrupt
+	}
+	for _, b := range in[:dictSize] {
+		if b != 0 {
+			return nil, nil, ErrDictionary
+		}
+	}
+	in = in[dictSize:]
+
+	fcsSize := [4]int{0, 2, 4, 8}[descriptor>>6]
+	if fcsSize == 0 && singleSegment {
+		fcsSize = 1
+	}
+	if len(in) < fcsSize {
+		return nil, nil, ErrCorrupt
+	}
+	contentSize := uint64(math.MaxUint64)
+	switch fcsSize {
+	case 1:
+		contentSize = uint64(in[0])
+	case 2:
+		contentSize = uint64(binary.LittleEndian.Uint16(in)) + 256
+	case 4:
+		contentSize = uint64(binary.LittleEndian.Uint32(in))
+	case 8:
+		contentSize = binary.LittleEndian.Uint64(in)
+	}
+	in = in[fcsSize:]
+
+	d := &frameDecoder{out: out, start: len(out), reps: [3]int{1, 4, 8}}
+	for last := false; !last; {
+		if len(in) < 3 {
+			return nil, nil, ErrCorrupt
+		}
+		header := uint32(in[0]) | uint32(in[1])<<8 | uint32(in[2])<<16
+		in = in[3:]
+		last = header&1 != 0
+		size := int(header >> 3)
+		if size > maxBlockSize {
+			return nil, nil, ErrCorrupt
+		}
+
+		switch header >> 1 & 3 {
+		case blockRaw:
+			if len(in) < size {
+				return nil, nil, ErrCorrupt
+			}
+			d.out = append(d.out, in[:size]...)
+			in = in[size:]
+		case blockRLE:
+			if len(in) < 1 {
+				return nil, nil, ErrCorrupt
+			}
+			for i := 0; i < size; i++ {
+				d.out = append(d.out, in[0])
+			}
+			in = in[1:]
+		case blockCompressed:
+			if len(in) < size {
+				return nil, nil, ErrCorrupt
+			}
+			if err := d.decodeCompressed(in[:size]); err != nil {
+				return nil, nil, err
+			}
+			in = in[size:]
+		default:
+			return nil, nil, ErrCorrupt
+		}
+
+		if uint64(len(d.out)-d.start) > contentSize {
+			return nil, nil, ErrCorrupt
+		}
+	}
+	if contentSize != math.MaxUint64 && uint64(len(d.out)-d.start) != contentSize {
+		return nil, nil, ErrCorrupt
+	}
+
+	if hasChecksum {
+		if len(in) < 4 {
+			return nil, nil, ErrCorrupt
+		}
+		if uint32(xxhash64(d.out[d.start:])) != binary.LittleEndian.Uint32(in) {
+			return nil, nil, ErrCorrupt
+		}
+		in = in[4:]
+	}
+	return d.out, in, nil
+}
+
+// Encode returns src as a single frame, appending to dst[:0]. Chunks
+// checksum their blocks themselves, so the frame has no content checksum.
+func Encode(dst, src []byte) []byte {
+	out := binary.LittleEndian.AppendUint32(dst[:0], frameMagic)
+
+	// A single segment frame records its content size, in as few bytes
+	// as it fits
+	n := uint64(len(src))
+	switch {
+	case n < 256:
+		out = append(out, 0x20, byte(n))
+	case n < 65536+256:
+		out = binary.LittleEndian.AppendUint16(append(out, 0x60), uint16(n-256))
+	case n <= math.MaxUint32:
+		out = binary.LittleEndian.AppendUint32(append(out, 0xa0), uint32(n))
+	default:
+		out = binary.LittleEndian.AppendUint64(append(out, 0xe0), n)
+	}
+
+	if len(src) == 0 {
+		return appendBlockHeader(out, blockRaw, 0, true)
+	}
+	e := &encoder{}
+	for len(src) > 0 {
+		block := src[:min(len(src), maxBlockSize)]
+		src = src[len(block):]
+		out = e.appendBlock(out, block, len(src) == 0)
+	}
+	return out
+}
+
+func appendBlockHeader(dst []byte, kind, size int, last bool) []byte {
+	header := kind<<1 | size<<3
+	if last {
+		header |= 1
+	}
+	return append(dst, byte(header), byte(header>>8), byte(header>>16))
+}
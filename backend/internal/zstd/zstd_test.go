@@ -0,0 +1,115 @@
+package zstd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Inputs and their encoding by the reference implementation, with content
+// checksums
+var referenceVectors = []struct {
+	input   string
+	encoded string
+}{
+	{"", ""},
+	{"a", "28b52ffd0400090000615b6e8ca9"},
+	{"abcdabcdabcdabcd", "28b52ffd0400810000616263646162636461626364616263647d8033dc"},
+	{"hello hello hello hello world", "28b52ffd04009500005868656c6c6f20776f726c64015406030f09d75f93d4"},
+	{strings.Repeat("0123456789", 30), "28b52ffd44002c00950000503031323334353637383901540a032c1f0de497d51d"},
+	{
+		`level=info msg="request served" path=/api/v1/users status=200 level=info msg="request served" path=/api/v1/orders status=200`,
+		"28b52ffd04002d020012440e14b03701327db6485f6f376a038341764b9518031047d59512e4d99afd5d7d864043b40c26b1661d396eeadfdeecb0921c5e9c120c94c9cd29021006823cdcc084026a84eff6",
+	},
+}
+
+func TestDecodeReference(t *testing.T) {
+	for _, v := range referenceVectors {
+		encoded, _ := hex.DecodeString(v.encoded)
+		got, err := Decode(nil, encoded)
+		if err != nil {
+			t.Errorf("%q: decode failed: %v", v.input, err)
+			continue
+		}
+		if string(got) != v.input {
+			t.Errorf("%q: decoded to %q", v.input, got)
+		}
+	}
+}
+
+func TestDecodeSeveralFrames(t *testing.T) {
+	a, _ := hex.DecodeString(referenceVectors[1].encoded)
+	b, _ := hex.DecodeString(referenceVectors[3].encoded)
+	skippable, _ := hex.DecodeString("5a2a4d1803000000ffffff")
+
+	src := append(append(append([]byte{}, a...), skippable...), b...)
+	got, err := Decode(nil, src)
+	if err != nil || string(got) != "ahello hello hello hello world" {
+		t.Errorf("decoded to %q, %v", got, err)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, v := range referenceVectors {
+		encoded := Encode(nil, []byte(v.input))
+		got, err := Decode(nil, encoded)
+		if err != nil || string(got) != v.input {
+			t.Errorf("%q: round trip gave %q, %v", v.input, got, err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 200000)
+	r.Read(random)
+	var logs strings.Builder
+	for i := 0; logs.Len() < 300000; i++ {
+		fmt.Fprintf(&logs, "level=%s app=api msg=\"request served\" path=/api/v1/items/%d status=%d\n",
+			[]string{"info", "warn", "error"}[r.Intn(3)], r.Intn(10000), []int{200, 404, 500}[r.Intn(3)])
+	}
+
+	// Inputs spanning several blocks, which are stored as RLE, raw and
+	// compressed blocks
+	for name, input := range map[string][]byte{
+		"run":    bytes.Repeat([]byte{'x'}, 300000),
+		"random": random,
+		"logs":   []byte(logs.String()),
+	} {
+		encoded := Encode(nil, input)
+		if got, err := Decode(nil, encoded); err != nil || !bytes.Equal(got, input) {
+			t.Errorf("%s: round trip of %d bytes failed: %v", name, len(input), err)
+		}
+		if name != "random" && len(encoded) > len(input)/3 {
+			t.Errorf("%s: encoded %d bytes to %d", name, len(input), len(encoded))
+		}
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	for _, encoded := range []string{
+		"28b52f",                           // truncated magic
+		"28b52ffe2001090000",               // wrong magic
+		"28b52ffd",                         // no frame header
+		"28b52ffd2001",                     // no blocks
+		"28b52ffd2000070000",               // reserved block type
+		"28b52ffd200209000061",             // shorter than the content size
+		"28b52ffd0400090000615b6e8caa",     // checksum mismatch
+		"28b52ffd2001090000",               // raw block longer than the input
+		"28b52ffd200a3d000008610100288a10", // offset beyond the output
+		"5a2a4d1810000000ffff",             // skippable frame longer than the input
+		"28b52ffd0400090000615b6e8ca900",   // trailing garbage
+	} {
+		src, _ := hex.DecodeString(encoded)
+		if _, err := Decode(nil, src); err == nil {
+			t.Errorf("%s: expected an error", encoded)
+		}
+	}
+
+	src, _ := hex.DecodeString("28b52ffd210100090000")
+	if _, err := Decode(nil, src); !errors.Is(err, ErrDictionary) {
+		t.Errorf("frame with a dictionary: got %v", err)
+	}
+}